@@ -0,0 +1,388 @@
+package accounting
+
+import (
+	"fmt"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Lot matching methods
+const (
+	MethodFifo    = "fifo"
+	MethodLifo    = "lifo"
+	MethodHifo    = "hifo"
+	MethodAverage = "average"
+)
+
+var Methods = []string{MethodFifo, MethodLifo, MethodHifo, MethodAverage}
+
+// TransferWindow is how far apart a withdrawal and the deposit of the same amount into another wallet can be to
+// count as a transfer between wallets of the portfolio
+const TransferWindow = time.Hour * 24
+
+// PriceFunc returns the fiat price of a token at a given time
+type PriceFunc func(token string, at time.Time) (decimal.Decimal, bool)
+
+// Lot is a quantity acquired at once, disposals consume lots in the order given by the method
+type Lot struct {
+	Token    string
+	TxId     string
+	Acquired time.Time
+	Quantity decimal.Decimal
+	UnitCost decimal.Decimal
+}
+
+// Disposal is the part of a sale matched with one lot, quantities sold without a known lot have no cost
+// and a zero Acquired time
+type Disposal struct {
+	Token    string          `json:"token"`
+	TxId     string          `json:"tx_id"`
+	Acquired time.Time       `json:"acquired"`
+	Disposed time.Time       `json:"disposed"`
+	Quantity decimal.Decimal `json:"quantity"`
+	Proceeds decimal.Decimal `json:"proceeds"`
+	Cost     decimal.Decimal `json:"cost"`
+}
+
+func (d Disposal) Gain() decimal.Decimal {
+	return d.Proceeds.Sub(d.Cost)
+}
+
+// Income is a staking reward valued when received, it also becomes a lot at that value
+type Income struct {
+	Token     string          `json:"token"`
+	TxId      string          `json:"tx_id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Quantity  decimal.Decimal `json:"quantity"`
+	Value     decimal.Decimal `json:"value"`
+}
+
+// Position is what is left of a token and what it earned so far, Value is zero until SetPrices
+type Position struct {
+	Token     string          `json:"token"`
+	Quantity  decimal.Decimal `json:"quantity"`
+	Cost      decimal.Decimal `json:"cost"`
+	Value     decimal.Decimal `json:"value"`
+	Realized  decimal.Decimal `json:"realized"`
+	Income    decimal.Decimal `json:"income"`
+	Unmatched decimal.Decimal `json:"unmatched"`
+}
+
+// AverageCost returns the cost of one token still held
+func (p Position) AverageCost() decimal.Decimal {
+	if p.Quantity.IsZero() {
+		return decimal.Zero
+	}
+	return p.Cost.Div(p.Quantity)
+}
+
+func (p Position) Unrealized() decimal.Decimal {
+	return p.Value.Sub(p.Cost)
+}
+
+// Report is the result of matching all transactions, Missing counts events valued at zero for lack of a price
+type Report struct {
+	Method    string     `json:"method"`
+	Fiat      string     `json:"fiat"`
+	Positions []Position `json:"positions"`
+	Disposals []Disposal `json:"disposals"`
+	Income    []Income   `json:"income"`
+	Missing   int        `json:"missing_prices"`
+	// missing holds the time of each event counted in Missing
+	missing []time.Time
+}
+
+// Total sums all positions
+func (r Report) Total() Position {
+	t := Position{Token: "Total"}
+	for _, p := range r.Positions {
+		t.Cost = t.Cost.Add(p.Cost)
+		t.Value = t.Value.Add(p.Value)
+		t.Realized = t.Realized.Add(p.Realized)
+		t.Income = t.Income.Add(p.Income)
+	}
+	return t
+}
+
+// Tokens returns tokens of all positions
+func (r Report) Tokens() []string {
+	tokens := make([]string, 0)
+	for _, p := range r.Positions {
+		tokens = append(tokens, p.Token)
+	}
+	return tokens
+}
+
+// SetPrices values positions at the given prices and sorts them by value
+func (r *Report) SetPrices(prices data.TokenPrices) {
+	for i, p := range r.Positions {
+		r.Positions[i].Value = p.Quantity.Mul(prices.GetPrice(p.Token))
+	}
+	sort.SliceStable(r.Positions, func(i, j int) bool {
+		return r.Positions[i].Value.GreaterThan(r.Positions[j].Value)
+	})
+}
+
+// ledger holds open lots and positions while transactions are replayed
+type ledger struct {
+	method    string
+	lots      map[string][]*Lot
+	positions map[string]*Position
+	report    *Report
+}
+
+// Compute replays transactions oldest first, all wallets share the same lots so internal transfers change
+// nothing, a withdrawal matched with a deposit into another wallet keeps its lots. Trades with a fiat side are
+// valued at the fiat amount, everything else at the price of the time
+func Compute(transactions []data.Transaction, method string, fiat string, priceAt PriceFunc) (Report, error) {
+	method = strings.ToLower(method)
+	if !tools.StringInSlice(method, Methods) {
+		return Report{}, fmt.Errorf("unknown cost basis method '%v', use one of %v", method, strings.Join(Methods, ", "))
+	}
+	sorted := make([]data.Transaction, len(transactions))
+	copy(sorted, transactions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+	report := Report{Method: method, Fiat: fiat, Disposals: make([]Disposal, 0), Income: make([]Income, 0)}
+	l := ledger{
+		method:    method,
+		lots:      make(map[string][]*Lot),
+		positions: make(map[string]*Position),
+		report:    &report,
+	}
+	trades := groupTrades(sorted, fiat)
+	moves := matchTransfers(sorted)
+	for i, tx := range sorted {
+		token := strings.ToUpper(tx.Token)
+		if strings.EqualFold(token, fiat) || tx.Type == data.TxTransfer {
+			continue
+		}
+		if moves[i] {
+			// Tokens stay in the portfolio, only the fee is lost
+			if tx.Fee.IsPositive() {
+				l.dispose(token, tx, tx.Fee, decimal.Zero, true)
+			}
+			continue
+		}
+		value := func() decimal.Decimal {
+			if v, ok := trades[tx.RefId].value(tx); ok && tx.Type == data.TxTrade {
+				return v
+			}
+			price, ok := priceAt(token, tx.Timestamp)
+			if !ok {
+				report.Missing++
+				report.missing = append(report.missing, tx.Timestamp)
+				return decimal.Zero
+			}
+			return tx.Amount.Abs().Mul(price)
+		}
+		switch {
+		case tx.Amount.IsPositive():
+			v := value()
+			l.acquire(token, tx, v)
+			if tx.Type == data.TxReward {
+				l.position(token).Income = l.position(token).Income.Add(v)
+				report.Income = append(report.Income, Income{
+					Token: token, TxId: tx.TxId, Timestamp: tx.Timestamp, Quantity: tx.Amount, Value: v,
+				})
+			}
+		case tx.Amount.IsNegative() && tx.Type == data.TxWithdrawal:
+			// Leaves the portfolio without being sold
+			l.dispose(token, tx, tx.Amount.Neg(), decimal.Zero, false)
+		case tx.Amount.IsNegative() && tx.Type == data.TxTrade:
+			l.dispose(token, tx, tx.Amount.Neg(), value(), true)
+		case tx.Amount.IsNegative():
+			// Fees and slashes are lost
+			l.dispose(token, tx, tx.Amount.Neg(), decimal.Zero, true)
+		}
+		if tx.Fee.IsPositive() {
+			l.dispose(token, tx, tx.Fee, decimal.Zero, true)
+		}
+	}
+	// Remaining lots
+	for token, p := range l.positions {
+		for _, lot := range l.lots[token] {
+			p.Quantity = p.Quantity.Add(lot.Quantity)
+			p.Cost = p.Cost.Add(lot.Quantity.Mul(lot.UnitCost))
+		}
+		report.Positions = append(report.Positions, *p)
+	}
+	sort.Slice(report.Positions, func(i, j int) bool {
+		return report.Positions[i].Token < report.Positions[j].Token
+	})
+	return report, nil
+}
+
+func (l *ledger) position(token string) *Position {
+	p, ok := l.positions[token]
+	if !ok {
+		p = &Position{Token: token}
+		l.positions[token] = p
+	}
+	return p
+}
+
+func (l *ledger) acquire(token string, tx data.Transaction, cost decimal.Decimal) {
+	l.position(token)
+	l.lots[token] = append(l.lots[token], &Lot{
+		Token:    token,
+		TxId:     tx.TxId,
+		Acquired: tx.Timestamp,
+		Quantity: tx.Amount,
+		UnitCost: cost.Div(tx.Amount),
+	})
+}
+
+// dispose consumes lots for quantity, realize records the gain, otherwise the cost just leaves with the tokens
+func (l *ledger) dispose(token string, tx data.Transaction, quantity decimal.Decimal, proceeds decimal.Decimal, realize bool) {
+	p := l.position(token)
+	lots := l.lots[token]
+	if l.method == MethodAverage {
+		// Every lot costs the average, lots are still consumed in order for holding periods
+		qty, cost := decimal.Zero, decimal.Zero
+		for _, lot := range lots {
+			qty = qty.Add(lot.Quantity)
+			cost = cost.Add(lot.Quantity.Mul(lot.UnitCost))
+		}
+		if qty.IsPositive() {
+			for _, lot := range lots {
+				lot.UnitCost = cost.Div(qty)
+			}
+		}
+	}
+	remaining := quantity
+	for remaining.IsPositive() && len(lots) > 0 {
+		i := l.next(lots)
+		lot := lots[i]
+		take := decimal.Min(lot.Quantity, remaining)
+		d := Disposal{
+			Token:    token,
+			TxId:     tx.TxId,
+			Acquired: lot.Acquired,
+			Disposed: tx.Timestamp,
+			Quantity: take,
+			Proceeds: proceeds.Mul(take).Div(quantity),
+			Cost:     take.Mul(lot.UnitCost),
+		}
+		lot.Quantity = lot.Quantity.Sub(take)
+		remaining = remaining.Sub(take)
+		if lot.Quantity.IsZero() {
+			lots = append(lots[:i], lots[i+1:]...)
+		}
+		if realize {
+			p.Realized = p.Realized.Add(d.Gain())
+			l.report.Disposals = append(l.report.Disposals, d)
+		}
+	}
+	l.lots[token] = lots
+	// Sold more than ever acquired, history is incomplete
+	if remaining.IsPositive() {
+		p.Unmatched = p.Unmatched.Add(remaining)
+		if realize {
+			d := Disposal{
+				Token:    token,
+				TxId:     tx.TxId,
+				Disposed: tx.Timestamp,
+				Quantity: remaining,
+				Proceeds: proceeds.Mul(remaining).Div(quantity),
+				Cost:     decimal.Zero,
+			}
+			p.Realized = p.Realized.Add(d.Gain())
+			l.report.Disposals = append(l.report.Disposals, d)
+		}
+	}
+}
+
+// next returns the index of the lot to consume first
+func (l *ledger) next(lots []*Lot) int {
+	switch l.method {
+	case MethodLifo:
+		return len(lots) - 1
+	case MethodHifo:
+		r := 0
+		for i, lot := range lots {
+			if lot.UnitCost.GreaterThan(lots[r].UnitCost) {
+				r = i
+			}
+		}
+		return r
+	default:
+		return 0
+	}
+}
+
+// trade is the fiat side of a trade, legs sharing a RefId
+type trade struct {
+	fiat   decimal.Decimal
+	fee    decimal.Decimal
+	crypto int
+	priced bool
+}
+
+// value returns what the only crypto leg of a trade cost or yielded in fiat, fiat fees included
+func (t *trade) value(tx data.Transaction) (decimal.Decimal, bool) {
+	if t == nil || !t.priced || t.crypto != 1 {
+		return decimal.Zero, false
+	}
+	if tx.Amount.IsPositive() {
+		return t.fiat.Neg().Add(t.fee), true
+	}
+	return t.fiat.Sub(t.fee), true
+}
+
+// matchTransfers pairs every withdrawal with the closest unmatched deposit of the same token and amount into
+// another wallet within TransferWindow, transactions must be sorted. It returns indexes of both sides
+func matchTransfers(transactions []data.Transaction) map[int]bool {
+	r := make(map[int]bool)
+	for i, w := range transactions {
+		if w.Type != data.TxWithdrawal || !w.Amount.IsNegative() {
+			continue
+		}
+		best := -1
+		start := sort.Search(len(transactions), func(j int) bool {
+			return !transactions[j].Timestamp.Before(w.Timestamp.Add(-TransferWindow))
+		})
+		for j := start; j < len(transactions) && !transactions[j].Timestamp.After(w.Timestamp.Add(TransferWindow)); j++ {
+			d := transactions[j]
+			if r[j] || d.Type != data.TxDeposit || !d.Amount.Equal(w.Amount.Neg()) ||
+				!strings.EqualFold(d.Token, w.Token) || strings.EqualFold(d.Wallet, w.Wallet) {
+				continue
+			}
+			gap := tools.AbsDuration(d.Timestamp.Sub(w.Timestamp))
+			if best < 0 || gap < tools.AbsDuration(transactions[best].Timestamp.Sub(w.Timestamp)) {
+				best = j
+			}
+		}
+		if best >= 0 {
+			r[i], r[best] = true, true
+		}
+	}
+	return r
+}
+
+func groupTrades(transactions []data.Transaction, fiat string) map[string]*trade {
+	r := make(map[string]*trade)
+	for _, tx := range transactions {
+		if tx.Type != data.TxTrade || tx.RefId == "" {
+			continue
+		}
+		t, ok := r[tx.RefId]
+		if !ok {
+			t = &trade{}
+			r[tx.RefId] = t
+		}
+		if strings.EqualFold(tx.Token, fiat) {
+			t.fiat = t.fiat.Add(tx.Amount)
+			t.fee = t.fee.Add(tx.Fee)
+			t.priced = true
+		} else {
+			t.crypto++
+		}
+	}
+	return r
+}
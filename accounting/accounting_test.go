@@ -0,0 +1,147 @@
+package accounting
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testTransactions() []data.Transaction {
+	day := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	leg := func(days int, ref string, token string, amount int64, fee string) data.Transaction {
+		return data.Transaction{
+			Timestamp: day.AddDate(0, 0, days), TxId: ref + token, RefId: ref, Type: data.TxTrade, Token: token,
+			Amount: decimal.NewFromInt(amount), Fee: decimal.RequireFromString(fee),
+		}
+	}
+	return []data.Transaction{
+		leg(0, "t1", "EUR", -100, "0"),
+		leg(0, "t1", "BTC", 1, "0"),
+		leg(1, "t2", "EUR", -298, "2"),
+		leg(1, "t2", "BTC", 1, "0"),
+		leg(2, "t3", "BTC", -1, "0"),
+		leg(2, "t3", "EUR", 400, "0"),
+	}
+}
+
+func TestCompute_Methods(t *testing.T) {
+	noPrice := func(token string, at time.Time) (decimal.Decimal, bool) {
+		return decimal.Zero, false
+	}
+	cases := map[string][2]int64{
+		MethodFifo:    {300, 300},
+		MethodLifo:    {100, 100},
+		MethodHifo:    {100, 100},
+		MethodAverage: {200, 200},
+	}
+	for method, expected := range cases {
+		r, err := Compute(testTransactions(), method, "EUR", noPrice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Positions) != 1 || r.Missing != 0 {
+			t.Fatalf("%v: unexpected report %+v", method, r)
+		}
+		p := r.Positions[0]
+		if !p.Realized.Equal(decimal.NewFromInt(expected[0])) || !p.Cost.Equal(decimal.NewFromInt(expected[1])) || !p.Quantity.Equal(decimal.NewFromInt(1)) {
+			t.Errorf("%v: expected realized %v and cost %v got %v and %v", method, expected[0], expected[1], p.Realized, p.Cost)
+		}
+	}
+	if _, err := Compute(nil, "random", "EUR", noPrice); err == nil {
+		t.Error("Expected an error for unknown method")
+	}
+}
+
+func TestCompute_RewardsAndWithdrawals(t *testing.T) {
+	day := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	price := func(token string, at time.Time) (decimal.Decimal, bool) {
+		return decimal.NewFromInt(10), token == "DOT"
+	}
+	r, err := Compute([]data.Transaction{
+		{Timestamp: day, TxId: "a", Type: data.TxDeposit, Token: "dot", Amount: decimal.NewFromInt(10)},
+		{Timestamp: day.Add(time.Hour), TxId: "b", Type: data.TxReward, Token: "dot", Amount: decimal.NewFromInt(1)},
+		{Timestamp: day.Add(2 * time.Hour), TxId: "c", Type: data.TxWithdrawal, Token: "dot", Amount: decimal.NewFromInt(-5), Fee: decimal.NewFromInt(1)},
+		{Timestamp: day.Add(3 * time.Hour), TxId: "d", Type: data.TxDeposit, Token: "ksm", Amount: decimal.NewFromInt(1)},
+	}, MethodFifo, "EUR", price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Missing != 1 || len(r.Income) != 1 || !r.Income[0].Value.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Unexpected income %v missing %v", r.Income, r.Missing)
+	}
+	dot := r.Positions[0]
+	// Fee is a realized loss, withdrawn tokens just leave
+	if dot.Token != "DOT" || !dot.Quantity.Equal(decimal.NewFromInt(5)) || !dot.Realized.Equal(decimal.NewFromInt(-10)) {
+		t.Errorf("Unexpected position %+v", dot)
+	}
+	r.SetPrices(data.TokenPrices{Entries: []data.TokenPrice{{Token: "DOT", Price: decimal.NewFromInt(12)}}})
+	if !r.Positions[0].Unrealized().Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Expected unrealized 10 got %v", r.Positions[0].Unrealized())
+	}
+}
+
+func TestCompute_TransferBetweenWallets(t *testing.T) {
+	day := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Market is well above cost when tokens move to cold storage
+	price := func(token string, at time.Time) (decimal.Decimal, bool) {
+		return decimal.NewFromInt(50), true
+	}
+	transactions := []data.Transaction{
+		{Timestamp: day, Wallet: "kraken", RefId: "t1", TxId: "t1eur", Type: data.TxTrade, Token: "EUR", Amount: decimal.NewFromInt(-100)},
+		{Timestamp: day, Wallet: "kraken", RefId: "t1", TxId: "t1btc", Type: data.TxTrade, Token: "BTC", Amount: decimal.NewFromInt(10)},
+		{Timestamp: day.AddDate(0, 0, 30), Wallet: "kraken", TxId: "w", Type: data.TxWithdrawal, Token: "BTC", Amount: decimal.NewFromInt(-4), Fee: decimal.NewFromInt(1)},
+		{Timestamp: day.AddDate(0, 0, 30).Add(time.Hour), Wallet: "cold", TxId: "d", Type: data.TxDeposit, Token: "btc", Amount: decimal.NewFromInt(4)},
+		// Too late to be the same transfer, comes from outside
+		{Timestamp: day.AddDate(0, 0, 40), Wallet: "cold", TxId: "e", Type: data.TxDeposit, Token: "BTC", Amount: decimal.NewFromInt(4)},
+	}
+	r, err := Compute(transactions, MethodFifo, "EUR", price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	btc := r.Positions[0]
+	// 9 BTC kept at 10 each plus 4 external at 50, only the fee is realized
+	if !btc.Quantity.Equal(decimal.NewFromInt(13)) || !btc.Cost.Equal(decimal.NewFromInt(290)) || !btc.Realized.Equal(decimal.NewFromInt(-10)) {
+		t.Errorf("Unexpected position %+v", btc)
+	}
+	if len(r.Disposals) != 1 || r.Disposals[0].TxId != "w" || !r.Disposals[0].Quantity.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("Expected only the fee disposed got %+v", r.Disposals)
+	}
+}
+
+func TestCompute_BalanceHistoryPrices(t *testing.T) {
+	// Databases older than the price table only hold balances
+	d, err := data.FromFile(filepath.Join(t.TempDir(), "coinwatch.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	bought, sold := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for at, value := range map[time.Time]int64{bought: 50, sold: 80} {
+		_, err := d.InsertSnapshot(data.Snapshot{Timestamp: at, Status: data.SnapshotComplete, Fiat: "EUR"}, []data.Balance{
+			{Wallet: "w", Token: "DOT", Balance: decimal.NewFromInt(10), FiatValue: decimal.NewFromInt(value)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	price := func(token string, at time.Time) (decimal.Decimal, bool) {
+		p, found, err := d.GetPriceAt(token, "EUR", at, time.Hour*24)
+		return p.Price, found && err == nil
+	}
+	r, err := Compute([]data.Transaction{
+		{Timestamp: bought.Add(time.Hour), TxId: "d", Type: data.TxDeposit, Wallet: "w", Token: "DOT", Amount: decimal.NewFromInt(10)},
+		// Swap without a fiat leg, valued at the price of the day
+		{Timestamp: sold.Add(time.Hour), TxId: "s", RefId: "s", Type: data.TxTrade, Wallet: "w", Token: "DOT", Amount: decimal.NewFromInt(-10)},
+	}, MethodFifo, "EUR", price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Missing != 0 || len(r.Disposals) != 1 || !r.Disposals[0].Proceeds.Equal(decimal.NewFromInt(80)) ||
+		!r.Disposals[0].Cost.Equal(decimal.NewFromInt(50)) {
+		t.Errorf("Expected disposal of 80 bought for 50 got %+v missing %d", r.Disposals, r.Missing)
+	}
+}
@@ -0,0 +1,99 @@
+package accounting
+
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
+
+// Holding periods
+const (
+	HoldingShort   = "short"
+	HoldingLong    = "long"
+	HoldingUnknown = "unknown"
+)
+
+// DefaultLongTerm is the holding period after which gains are long term in most jurisdictions
+const DefaultLongTerm = time.Hour * 24 * 365
+
+// TaxDisposal is a disposal with its holding period
+type TaxDisposal struct {
+	Disposal
+	Gain    decimal.Decimal `json:"gain"`
+	Holding string          `json:"holding"`
+}
+
+// TaxReport lists disposals and income of one calendar year
+type TaxReport struct {
+	Year      int           `json:"year"`
+	Method    string        `json:"method"`
+	Fiat      string        `json:"fiat"`
+	Disposals []TaxDisposal `json:"disposals"`
+	Income    []Income      `json:"income"`
+	Missing   int           `json:"missing_prices"`
+}
+
+// TaxTotals sums a tax report
+type TaxTotals struct {
+	Proceeds  decimal.Decimal
+	Cost      decimal.Decimal
+	ShortGain decimal.Decimal
+	LongGain  decimal.Decimal
+	Income    decimal.Decimal
+}
+
+// NewTaxReport keeps what happened during year in loc, gains are long term when held longer than longTerm
+func NewTaxReport(r Report, year int, longTerm time.Duration, loc *time.Location) TaxReport {
+	from := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+	to := from.AddDate(1, 0, 0)
+	in := func(t time.Time) bool {
+		return !t.Before(from) && t.Before(to)
+	}
+	tr := TaxReport{
+		Year:      year,
+		Method:    r.Method,
+		Fiat:      r.Fiat,
+		Disposals: make([]TaxDisposal, 0),
+		Income:    make([]Income, 0),
+	}
+	for _, t := range r.missing {
+		if in(t) {
+			tr.Missing++
+		}
+	}
+	for _, d := range r.Disposals {
+		if !in(d.Disposed) {
+			continue
+		}
+		holding := HoldingShort
+		switch {
+		case d.Acquired.IsZero():
+			holding = HoldingUnknown
+		case d.Disposed.Sub(d.Acquired) > longTerm:
+			holding = HoldingLong
+		}
+		tr.Disposals = append(tr.Disposals, TaxDisposal{Disposal: d, Gain: d.Gain(), Holding: holding})
+	}
+	for _, i := range r.Income {
+		if in(i.Timestamp) {
+			tr.Income = append(tr.Income, i)
+		}
+	}
+	return tr
+}
+
+func (r TaxReport) Totals() TaxTotals {
+	var t TaxTotals
+	for _, d := range r.Disposals {
+		t.Proceeds = t.Proceeds.Add(d.Proceeds)
+		t.Cost = t.Cost.Add(d.Cost)
+		if d.Holding == HoldingLong {
+			t.LongGain = t.LongGain.Add(d.Gain)
+		} else {
+			t.ShortGain = t.ShortGain.Add(d.Gain)
+		}
+	}
+	for _, i := range r.Income {
+		t.Income = t.Income.Add(i.Value)
+	}
+	return t
+}
@@ -0,0 +1,59 @@
+package accounting
+
+import (
+	"bytes"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTaxReport(t *testing.T) {
+	transactions := append(testTransactions(), []data.Transaction{
+		{Timestamp: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), TxId: "s1", RefId: "t4", Type: data.TxTrade, Token: "BTC", Amount: decimal.NewFromInt(-1)},
+		{Timestamp: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), TxId: "s2", RefId: "t4", Type: data.TxTrade, Token: "EUR", Amount: decimal.NewFromInt(500)},
+		{Timestamp: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), TxId: "r1", Type: data.TxReward, Token: "BTC", Amount: decimal.RequireFromString("0.01")},
+	}...)
+	price := func(token string, at time.Time) (decimal.Decimal, bool) {
+		return decimal.NewFromInt(1000), true
+	}
+	r, err := Compute(transactions, MethodFifo, "EUR", price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTaxReport(r, 2023, DefaultLongTerm, time.UTC)
+	if len(tr.Disposals) != 1 || tr.Disposals[0].Holding != HoldingLong || !tr.Disposals[0].Gain.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Unexpected disposals %+v", tr.Disposals)
+	}
+	totals := tr.Totals()
+	if !totals.LongGain.Equal(decimal.NewFromInt(200)) || !totals.Income.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Unexpected totals %+v", totals)
+	}
+	// 2022 only has the short term sale
+	tr = NewTaxReport(r, 2022, DefaultLongTerm, time.UTC)
+	if len(tr.Disposals) != 1 || tr.Disposals[0].Holding != HoldingShort || len(tr.Income) != 0 {
+		t.Errorf("Unexpected 2022 report %+v", tr)
+	}
+	var buf bytes.Buffer
+	if err := tr.WriteDisposalsCsv(&buf); err != nil || !strings.Contains(buf.String(), "BTC,1,2022-01-01,2022-01-03,400.00,100.00,300.00,short") {
+		t.Errorf("Unexpected CSV %v %v", buf.String(), err)
+	}
+	buf.Reset()
+	if err := tr.WriteHtml(&buf); err != nil || !strings.Contains(buf.String(), "<td class=\"n\">300.00</td>") {
+		t.Errorf("Unexpected HTML %v", err)
+	}
+	// Only the 2023 reward lacks a price
+	r, err = Compute(transactions, MethodFifo, "EUR", func(token string, at time.Time) (decimal.Decimal, bool) {
+		return decimal.NewFromInt(1000), at.Year() < 2023
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr = NewTaxReport(r, 2022, DefaultLongTerm, time.UTC); tr.Missing != 0 {
+		t.Errorf("Expected no missing price in 2022 got %d", tr.Missing)
+	}
+	if tr = NewTaxReport(r, 2023, DefaultLongTerm, time.UTC); tr.Missing != 1 {
+		t.Errorf("Expected 1 missing price in 2023 got %d", tr.Missing)
+	}
+}
@@ -0,0 +1,115 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"github.com/shopspring/decimal"
+	"html/template"
+	"io"
+	"time"
+)
+
+const taxDateLayout = "2006-01-02"
+
+// WriteDisposalsCsv writes one row per disposed lot, amounts in fiat are rounded to cents
+func (r TaxReport) WriteDisposalsCsv(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"token", "quantity", "acquired", "disposed", "proceeds", "cost", "gain", "holding", "tx_id"})
+	if err != nil {
+		return err
+	}
+	for _, d := range r.Disposals {
+		err := cw.Write([]string{
+			d.Token, d.Quantity.String(), taxDate(d.Acquired), taxDate(d.Disposed),
+			d.Proceeds.StringFixed(2), d.Cost.StringFixed(2), d.Gain.StringFixed(2), d.Holding, d.TxId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteIncomeCsv writes one row per staking reward valued when received
+func (r TaxReport) WriteIncomeCsv(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"token", "quantity", "received", "value", "tx_id"}); err != nil {
+		return err
+	}
+	for _, i := range r.Income {
+		err := cw.Write([]string{i.Token, i.Quantity.String(), taxDate(i.Timestamp), i.Value.StringFixed(2), i.TxId})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteHtml writes both reports in a single page meant to be printed to PDF from a browser
+func (r TaxReport) WriteHtml(w io.Writer) error {
+	return taxTemplate.Execute(w, struct {
+		TaxReport
+		Totals    TaxTotals
+		Generated string
+	}{r, r.Totals(), time.Now().Format(taxDateLayout)})
+}
+
+func taxDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(taxDateLayout)
+}
+
+var taxTemplate = template.Must(template.New("tax").Funcs(template.FuncMap{
+	"date": taxDate,
+	"money": func(v decimal.Decimal) string {
+		return v.StringFixed(2)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Tax report {{.Year}}</title>
+<style>
+body { font-family: sans-serif; font-size: 10pt; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border-bottom: 1px solid #ccc; padding: 4px 6px; text-align: left; }
+td.n, th.n { text-align: right; font-variant-numeric: tabular-nums; }
+tfoot td { font-weight: bold; border-top: 2px solid #333; }
+h2 { page-break-before: auto; }
+@page { size: A4 landscape; margin: 1.5cm; }
+@media print { body { margin: 0; } tr { page-break-inside: avoid; } }
+</style>
+</head>
+<body>
+<h1>Tax report {{.Year}}</h1>
+<p>Amounts in {{.Fiat}}, lots matched with {{.Method}}, generated {{.Generated}}.
+{{if .Missing}}{{.Missing}} transactions had no stored price and are valued at zero.{{end}}</p>
+<table>
+<tr><th>Proceeds</th><td class="n">{{money .Totals.Proceeds}}</td></tr>
+<tr><th>Cost</th><td class="n">{{money .Totals.Cost}}</td></tr>
+<tr><th>Short term gain</th><td class="n">{{money .Totals.ShortGain}}</td></tr>
+<tr><th>Long term gain</th><td class="n">{{money .Totals.LongGain}}</td></tr>
+<tr><th>Staking income</th><td class="n">{{money .Totals.Income}}</td></tr>
+</table>
+<h2>Disposals</h2>
+<table>
+<thead><tr><th>Token</th><th class="n">Quantity</th><th>Acquired</th><th>Disposed</th><th class="n">Proceeds</th><th class="n">Cost</th><th class="n">Gain</th><th>Holding</th></tr></thead>
+<tbody>
+{{range .Disposals}}<tr><td>{{.Token}}</td><td class="n">{{.Quantity}}</td><td>{{date .Acquired}}</td><td>{{date .Disposed}}</td><td class="n">{{money .Proceeds}}</td><td class="n">{{money .Cost}}</td><td class="n">{{money .Gain}}</td><td>{{.Holding}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><td colspan="4">Total</td><td class="n">{{money .Totals.Proceeds}}</td><td class="n">{{money .Totals.Cost}}</td><td class="n">{{money (.Totals.ShortGain.Add .Totals.LongGain)}}</td><td></td></tr></tfoot>
+</table>
+<h2>Staking income</h2>
+<table>
+<thead><tr><th>Token</th><th class="n">Quantity</th><th>Received</th><th class="n">Value</th></tr></thead>
+<tbody>
+{{range .Income}}<tr><td>{{.Token}}</td><td class="n">{{.Quantity}}</td><td>{{date .Timestamp}}</td><td class="n">{{money .Value}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><td colspan="3">Total</td><td class="n">{{money .Totals.Income}}</td></tr></tfoot>
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,274 @@
+package analytics
+
+import (
+	"encoding/json"
+	"github.com/zooper-corp/CoinWatch/data"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PeriodsPerYear annualizes daily figures, crypto markets never close
+const PeriodsPerYear = 365
+
+// year is the length PeriodsPerYear days add up to
+const year = time.Hour * 24 * PeriodsPerYear
+
+// Benchmarks are the tokens the portfolio is compared with
+var Benchmarks = []string{"BTC", "ETH"}
+
+// Point is a value at a given time
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Options of Compute, Window is the amount of periods of rolling volatility and RiskFree an annual rate
+type Options struct {
+	Window   int
+	RiskFree float64
+}
+
+// Benchmark compares portfolio returns with the ones of a token over the periods both are known
+type Benchmark struct {
+	Token       string  `json:"token"`
+	Return      float64 `json:"return"`
+	Volatility  float64 `json:"volatility"`
+	Beta        float64 `json:"beta"`
+	Correlation float64 `json:"correlation"`
+	Periods     int     `json:"periods"`
+}
+
+// Stats are risk and performance figures of a series, volatility and ratios are annualized from the mean length of
+// the periods, drawdown is negative. Sortino is +Inf without any downside and null in JSON
+type Stats struct {
+	From              time.Time   `json:"from"`
+	To                time.Time   `json:"to"`
+	Periods           int         `json:"periods"`
+	Return            float64     `json:"return"`
+	MaxDrawdown       float64     `json:"max_drawdown"`
+	DrawdownPeak      time.Time   `json:"drawdown_peak"`
+	DrawdownTrough    time.Time   `json:"drawdown_trough"`
+	Volatility        float64     `json:"volatility"`
+	RollingVolatility []Point     `json:"rolling_volatility"`
+	Sharpe            float64     `json:"sharpe"`
+	Sortino           float64     `json:"sortino"`
+	Benchmarks        []Benchmark `json:"benchmarks"`
+}
+
+// MarshalJSON writes an infinite Sortino as null, JSON has no infinity
+func (s Stats) MarshalJSON() ([]byte, error) {
+	type stats Stats
+	r := struct {
+		stats
+		Sortino *float64 `json:"sortino"`
+	}{stats: stats(s)}
+	if !math.IsInf(s.Sortino, 0) {
+		r.Sortino = &s.Sortino
+	}
+	return json.Marshal(r)
+}
+
+// period is the return between two points
+type period struct {
+	from   time.Time
+	to     time.Time
+	change float64
+}
+
+// returns computes the return of every interval between points, flows are not counted as performance and
+// intervals starting from nothing are skipped
+func returns(points []Point, flows []data.Flow) []period {
+	r := make([]period, 0)
+	for i := 1; i < len(points); i++ {
+		prev, cur := points[i-1], points[i]
+		if change, ok := data.IntervalReturn(prev.Timestamp, prev.Value, cur.Timestamp, cur.Value, flows); ok {
+			r = append(r, period{from: prev.Timestamp, to: cur.Timestamp, change: change})
+		}
+	}
+	return r
+}
+
+// periodsPerYear is how many periods of the mean length of pr make a year, PeriodsPerYear without any
+func periodsPerYear(pr []period) float64 {
+	total := time.Duration(0)
+	for _, p := range pr {
+		total += p.to.Sub(p.from)
+	}
+	if total <= 0 {
+		return PeriodsPerYear
+	}
+	return float64(year) / (float64(total) / float64(len(pr)))
+}
+
+// Compute returns stats of portfolio, points must be sorted oldest first and benchmark points must be sampled at
+// the same times as the portfolio ones, missing benchmark points only reduce the compared periods
+func Compute(portfolio []Point, flows []data.Flow, benchmarks map[string][]Point, options Options) Stats {
+	s := Stats{RollingVolatility: make([]Point, 0), Benchmarks: make([]Benchmark, 0)}
+	if len(portfolio) == 0 {
+		return s
+	}
+	s.From = portfolio[0].Timestamp
+	s.To = portfolio[len(portfolio)-1].Timestamp
+	pr := returns(portfolio, flows)
+	changes := make([]float64, len(pr))
+	for i, p := range pr {
+		changes[i] = p.change
+	}
+	s.Periods = len(pr)
+	s.Return = compound(changes)
+	// Drawdown of the flow adjusted index, deposits would hide it otherwise
+	peak, index := 1.0, 1.0
+	peakTs := s.From
+	for _, p := range pr {
+		index *= 1 + p.change
+		if index > peak {
+			peak = index
+			peakTs = p.to
+		}
+		if dd := index/peak - 1; dd < s.MaxDrawdown {
+			s.MaxDrawdown = dd
+			s.DrawdownPeak = peakTs
+			s.DrawdownTrough = p.to
+		}
+	}
+	perYear := periodsPerYear(pr)
+	s.Volatility = Volatility(changes, perYear)
+	if options.Window > 1 {
+		for i := options.Window; i <= len(pr); i++ {
+			s.RollingVolatility = append(s.RollingVolatility, Point{
+				Timestamp: pr[i-1].to,
+				Value:     Volatility(changes[i-options.Window:i], periodsPerYear(pr[i-options.Window:i])),
+			})
+		}
+	}
+	s.Sharpe = Sharpe(changes, options.RiskFree, perYear)
+	s.Sortino = Sortino(changes, options.RiskFree, perYear)
+	// Benchmarks
+	tokens := make([]string, 0)
+	for token := range benchmarks {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	for _, token := range tokens {
+		values := make(map[int64]float64)
+		for _, p := range benchmarks[token] {
+			values[p.Timestamp.UnixNano()] = p.Value
+		}
+		portfolioChanges, benchmarkChanges, compared := make([]float64, 0), make([]float64, 0), make([]period, 0)
+		for _, p := range pr {
+			from, okFrom := values[p.from.UnixNano()]
+			to, okTo := values[p.to.UnixNano()]
+			if okFrom && okTo && from > 0 {
+				portfolioChanges = append(portfolioChanges, p.change)
+				benchmarkChanges = append(benchmarkChanges, to/from-1)
+				compared = append(compared, p)
+			}
+		}
+		s.Benchmarks = append(s.Benchmarks, Benchmark{
+			Token:       strings.ToUpper(token),
+			Return:      compound(benchmarkChanges),
+			Volatility:  Volatility(benchmarkChanges, periodsPerYear(compared)),
+			Beta:        Beta(portfolioChanges, benchmarkChanges),
+			Correlation: Correlation(portfolioChanges, benchmarkChanges),
+			Periods:     len(benchmarkChanges),
+		})
+	}
+	return s
+}
+
+// Volatility is the annualized standard deviation of returns, perYear is how many of their periods make a year
+func Volatility(changes []float64, perYear float64) float64 {
+	return stdDev(changes) * math.Sqrt(perYear)
+}
+
+// Sharpe is the annualized excess return over volatility, riskFree is an annual rate
+func Sharpe(changes []float64, riskFree float64, perYear float64) float64 {
+	sd := stdDev(changes)
+	if sd == 0 {
+		return 0
+	}
+	return (mean(changes) - riskFree/perYear) / sd * math.Sqrt(perYear)
+}
+
+// Sortino is like Sharpe but only returns below the risk free rate count as risk, it is +Inf when no return is
+// below and the mean is above
+func Sortino(changes []float64, riskFree float64, perYear float64) float64 {
+	if len(changes) < 2 {
+		return 0
+	}
+	target := riskFree / perYear
+	downside := 0.0
+	for _, c := range changes {
+		if c < target {
+			downside += (c - target) * (c - target)
+		}
+	}
+	excess := mean(changes) - target
+	if downside == 0 {
+		if excess > 0 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return excess / math.Sqrt(downside/float64(len(changes))) * math.Sqrt(perYear)
+}
+
+// Beta is how much the portfolio moves for a move of the benchmark
+func Beta(changes []float64, benchmark []float64) float64 {
+	v := variance(benchmark)
+	if v == 0 {
+		return 0
+	}
+	return covariance(changes, benchmark) / v
+}
+
+// Correlation of the portfolio and benchmark returns, -1.0 to 1.0
+func Correlation(changes []float64, benchmark []float64) float64 {
+	d := stdDev(changes) * stdDev(benchmark)
+	if d == 0 {
+		return 0
+	}
+	return covariance(changes, benchmark) / d
+}
+
+func compound(changes []float64) float64 {
+	r := 1.0
+	for _, c := range changes {
+		r *= 1 + c
+	}
+	return r - 1
+}
+
+func mean(x []float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range x {
+		sum += v
+	}
+	return sum / float64(len(x))
+}
+
+// covariance of two samples of the same size
+func covariance(x []float64, y []float64) float64 {
+	if len(x) < 2 || len(x) != len(y) {
+		return 0
+	}
+	mx, my := mean(x), mean(y)
+	sum := 0.0
+	for i := range x {
+		sum += (x[i] - mx) * (y[i] - my)
+	}
+	return sum / float64(len(x)-1)
+}
+
+func variance(x []float64) float64 {
+	return covariance(x, x)
+}
+
+func stdDev(x []float64) float64 {
+	return math.Sqrt(variance(x))
+}
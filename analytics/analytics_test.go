@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"encoding/json"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPoints(start time.Time, values ...float64) []Point {
+	r := make([]Point, len(values))
+	for i, v := range values {
+		r[i] = Point{Timestamp: start.AddDate(0, 0, i), Value: v}
+	}
+	return r
+}
+
+func TestCompute(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Portfolio moves twice as much as BTC, a deposit on day 3 is not a gain
+	portfolio := testPoints(start, 1000, 1100, 990, 2039, 2141)
+	btc := testPoints(start, 100, 105, 99.75, 102.24375, 104.7998)
+	flows := []data.Flow{{Timestamp: start.AddDate(0, 0, 3), Value: decimal.NewFromInt(1000)}}
+	s := Compute(portfolio, flows, map[string][]Point{"btc": btc}, Options{Window: 2})
+	if s.Periods != 4 {
+		t.Errorf("Expected 4 periods got %v", s.Periods)
+	}
+	if math.Abs(s.MaxDrawdown+0.1) > 1e-9 || !s.DrawdownTrough.Equal(start.AddDate(0, 0, 2)) {
+		t.Errorf("Expected -10%% drawdown on day 2 got %v at %v", s.MaxDrawdown, s.DrawdownTrough)
+	}
+	if len(s.RollingVolatility) != 3 || s.Volatility <= 0 {
+		t.Errorf("Unexpected volatility %v %v", s.Volatility, s.RollingVolatility)
+	}
+	if len(s.Benchmarks) != 1 || s.Benchmarks[0].Token != "BTC" || s.Benchmarks[0].Periods != 4 {
+		t.Fatalf("Unexpected benchmarks %v", s.Benchmarks)
+	}
+	b := s.Benchmarks[0]
+	if math.Abs(b.Beta-2) > 0.01 || math.Abs(b.Correlation-1) > 0.01 {
+		t.Errorf("Expected beta 2 and correlation 1 got %v and %v", b.Beta, b.Correlation)
+	}
+	// Same returns a week apart are less volatile in a year
+	weekly := make([]Point, len(portfolio))
+	for i, p := range portfolio {
+		weekly[i] = Point{Timestamp: start.AddDate(0, 0, 7*i), Value: p.Value}
+	}
+	w := Compute(weekly, []data.Flow{{Timestamp: start.AddDate(0, 0, 21), Value: decimal.NewFromInt(1000)}}, nil, Options{})
+	if math.Abs(w.Volatility*math.Sqrt(7)-s.Volatility) > 1e-9 || math.Abs(w.Sharpe*math.Sqrt(7)-s.Sharpe) > 1e-9 {
+		t.Errorf("Expected weekly figures annualized by 52 periods got %v and %v", w.Volatility, w.Sharpe)
+	}
+}
+
+func TestRatios(t *testing.T) {
+	changes := []float64{0.01, -0.02, 0.03, -0.01, 0.02}
+	if s := Sharpe(changes, 0, PeriodsPerYear); s <= 0 {
+		t.Errorf("Expected positive sharpe got %v", s)
+	}
+	// Only losses count as risk for Sortino
+	if Sortino(changes, 0, PeriodsPerYear) <= Sharpe(changes, 0, PeriodsPerYear) {
+		t.Errorf("Expected sortino above sharpe")
+	}
+	// No downside is infinite, not zero, and null in JSON
+	if !math.IsInf(Sortino([]float64{0.01, 0.02}, 0, PeriodsPerYear), 1) || Sortino([]float64{0, 0}, 0, PeriodsPerYear) != 0 {
+		t.Errorf("Expected infinite sortino without losses")
+	}
+	if b, err := json.Marshal(Stats{Sortino: math.Inf(1)}); err != nil || !strings.Contains(string(b), `"sortino":null`) {
+		t.Errorf("Unexpected JSON %s %v", b, err)
+	}
+	if Sharpe([]float64{0.01, 0.01}, 0, PeriodsPerYear) != 0 || Volatility(nil, PeriodsPerYear) != 0 {
+		t.Errorf("Expected zero ratios without variance")
+	}
+	if math.Abs(Correlation(changes, changes)-1) > 1e-9 || math.Abs(Beta(changes, changes)-1) > 1e-9 {
+		t.Errorf("Expected a series to follow itself")
+	}
+}
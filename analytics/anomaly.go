@@ -0,0 +1,89 @@
+package analytics
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"sort"
+	"strings"
+)
+
+// AnomalyOptions of DetectAnomalies, Drop is the relative quantity drop (0.0 to 1.0) flagged, MinValue the fiat
+// value a drop or missing balance must exceed and FiatMin the value a new token must exceed. Only Wallets are
+// checked, all of them when empty. Held lists tokens reported before, dust and unpriced ones included, no token
+// is new until it is known
+type AnomalyOptions struct {
+	Drop     float64
+	MinValue decimal.Decimal
+	FiatMin  decimal.Decimal
+	Wallets  []string
+	Held     []data.HeldToken
+}
+
+// DetectAnomalies compares balances of a snapshot with the previous one by Balance.Id, quantities are compared so
+// price moves are never flagged. Current must hold every balance reported by providers, also the ones too small to
+// be stored, so that a balance is only missing when its address is gone
+func DetectAnomalies(previous []data.Balance, current []data.Balance, options AnomalyOptions) []data.Event {
+	r := make([]data.Event, 0)
+	watched := func(b data.Balance) bool {
+		return len(options.Wallets) == 0 || tools.StringInSlice(strings.ToLower(b.Wallet), options.Wallets)
+	}
+	now := make(map[string]data.Balance)
+	tokens := make(map[string]bool)
+	for _, b := range current {
+		now[b.Id()] = b
+	}
+	for _, h := range options.Held {
+		tokens[tokenKey(data.Balance{Wallet: h.Wallet, Token: h.Token})] = true
+	}
+	for _, b := range previous {
+		tokens[tokenKey(b)] = true
+		if !watched(b) {
+			continue
+		}
+		c, ok := now[b.Id()]
+		if !ok {
+			if b.FiatValue.GreaterThan(options.MinValue) {
+				r = append(r, event(data.EventMissing, b, decimal.Zero, b.FiatValue))
+			}
+			continue
+		}
+		if !b.Balance.IsPositive() {
+			continue
+		}
+		drop := b.Balance.Sub(c.Balance)
+		value := drop.Mul(b.PricePerToken())
+		if drop.Div(b.Balance).InexactFloat64() > options.Drop && value.GreaterThan(options.MinValue) {
+			r = append(r, event(data.EventDrop, b, c.Balance, value))
+		}
+	}
+	// Tokens never held by a wallet, dust is left out as it is never stored
+	for _, b := range current {
+		if !tokens[tokenKey(b)] && watched(b) && len(previous) > 0 && len(options.Held) > 0 && b.FiatValue.GreaterThan(options.FiatMin) {
+			tokens[tokenKey(b)] = true
+			e := event(data.EventNewToken, b, b.Balance, b.FiatValue)
+			e.Previous = decimal.Zero
+			r = append(r, e)
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].FiatValue.GreaterThan(r[j].FiatValue)
+	})
+	return r
+}
+
+func tokenKey(b data.Balance) string {
+	return strings.ToLower(b.Wallet) + "/" + strings.ToUpper(b.Token)
+}
+
+func event(kind string, b data.Balance, current decimal.Decimal, value decimal.Decimal) data.Event {
+	return data.Event{
+		Kind:      kind,
+		Wallet:    b.Wallet,
+		Token:     strings.ToUpper(b.Token),
+		Address:   b.Address,
+		Previous:  b.Balance,
+		Current:   current,
+		FiatValue: value,
+	}
+}
@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"testing"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	balance := func(wallet string, token string, address string, quantity int64, value int64) data.Balance {
+		return data.Balance{Wallet: wallet, Token: token, Address: address, Balance: decimal.NewFromInt(quantity), FiatValue: decimal.NewFromInt(value)}
+	}
+	previous := []data.Balance{
+		balance("w", "dot", "a", 100, 1000),
+		balance("w", "dot", "b", 10, 100),
+		balance("w", "eth", "a", 2, 4000),
+		balance("w", "usdc", "a", 50, 50),
+		balance("x", "btc", "a", 1, 20000),
+	}
+	current := []data.Balance{
+		// 20% drop while price doubles
+		balance("w", "dot", "a", 80, 1600),
+		// 5% drop is below threshold
+		balance("w", "dot", "b", 9, 90),
+		// eth address gone, usdc drop is below min value
+		balance("w", "usdc", "a", 10, 10),
+		// New token and dust
+		balance("w", "atom", "a", 10, 100),
+		balance("w", "shib", "a", 1000, 1),
+		// Wallet not watched
+		balance("x", "btc", "a", 0, 0),
+	}
+	held := []data.HeldToken{{Wallet: "w", Token: "DOT"}, {Wallet: "w", Token: "ETH"}, {Wallet: "w", Token: "USDC"}}
+	options := AnomalyOptions{Drop: 0.1, MinValue: decimal.NewFromInt(50), FiatMin: decimal.NewFromInt(5), Wallets: []string{"w"}, Held: held}
+	events := DetectAnomalies(previous, current, options)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events got %+v", events)
+	}
+	missing, drop, token := events[0], events[1], events[2]
+	if missing.Kind != data.EventMissing || missing.Token != "ETH" || !missing.FiatValue.Equal(decimal.NewFromInt(4000)) {
+		t.Errorf("Unexpected missing event %+v", missing)
+	}
+	// Valued at the previous price
+	if drop.Kind != data.EventDrop || drop.Address != "a" || !drop.Current.Equal(decimal.NewFromInt(80)) || !drop.FiatValue.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Unexpected drop event %+v", drop)
+	}
+	if token.Kind != data.EventNewToken || token.Token != "ATOM" || !token.Previous.IsZero() || token.Change() != 0 || !token.Current.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Unexpected new token event %+v", token)
+	}
+	// All wallets when none is set
+	options.Wallets = nil
+	if events = DetectAnomalies(previous, current, options); len(events) != 4 || events[0].Wallet != "x" {
+		t.Errorf("Expected btc drop first got %+v", events)
+	}
+	// First snapshot has nothing to compare
+	if events = DetectAnomalies(nil, current, options); len(events) != 0 {
+		t.Errorf("Expected no event on first snapshot got %+v", events)
+	}
+	// Nothing is new before held tokens are known
+	options.Held = nil
+	if events = DetectAnomalies(previous, current, options); len(events) != 3 || events[2].Kind != data.EventDrop {
+		t.Errorf("Expected no new token got %+v", events)
+	}
+}
+
+func TestDetectAnomalies_HeldDust(t *testing.T) {
+	// Dust below fiat min is not in the previous snapshot but was reported and held
+	previous := []data.Balance{
+		{Wallet: "w", Token: "dot", Address: "a", Balance: decimal.NewFromInt(1), FiatValue: decimal.NewFromInt(10)},
+	}
+	current := []data.Balance{
+		{Wallet: "w", Token: "dot", Address: "a", Balance: decimal.NewFromInt(1), FiatValue: decimal.NewFromInt(10)},
+		{Wallet: "w", Token: "shib", Address: "a", Balance: decimal.NewFromInt(1000), FiatValue: decimal.NewFromInt(20)},
+		{Wallet: "w", Token: "atom", Address: "a", Balance: decimal.NewFromInt(10), FiatValue: decimal.NewFromInt(100)},
+	}
+	options := AnomalyOptions{
+		Drop: 0.1, MinValue: decimal.NewFromInt(50), FiatMin: decimal.NewFromInt(5),
+		Held: []data.HeldToken{{Wallet: "W", Token: "dot"}, {Wallet: "w", Token: "SHIB"}},
+	}
+	events := DetectAnomalies(previous, current, options)
+	if len(events) != 1 || events[0].Kind != data.EventNewToken || events[0].Token != "ATOM" {
+		t.Errorf("Expected only atom to be new got %+v", events)
+	}
+}
@@ -0,0 +1,130 @@
+package analytics
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PriceFunc returns the fiat price of a token at a given time
+type PriceFunc func(token string, at time.Time) (decimal.Decimal, bool)
+
+// Basket is a benchmark holding tokens with the given weights, weights are normalized
+type Basket struct {
+	Name    string
+	Weights map[string]float64
+}
+
+// Series is the fiat value of a portfolio or benchmark over time and its flow adjusted return
+type Series struct {
+	Name   string  `json:"name"`
+	Points []Point `json:"points"`
+	Return float64 `json:"return"`
+}
+
+// Comparison of the portfolio with benchmarks, Missing lists baskets without a price at the start
+type Comparison struct {
+	Portfolio  Series   `json:"portfolio"`
+	Benchmarks []Series `json:"benchmarks"`
+	Missing    []string `json:"missing"`
+}
+
+// BasketsOf returns a basket holding only token for every token
+func BasketsOf(tokens []string) []Basket {
+	r := make([]Basket, len(tokens))
+	for i, token := range tokens {
+		r[i] = Basket{Name: strings.ToUpper(token), Weights: map[string]float64{token: 1}}
+	}
+	return r
+}
+
+// Compare buys every basket with the portfolio value at the first point, then every deposit is invested in and
+// every withdrawal taken out of the basket when the portfolio got it so both start from and receive the same money
+func Compare(portfolio []Point, flows []data.Flow, baskets []Basket, priceAt PriceFunc) Comparison {
+	c := Comparison{
+		Portfolio:  Series{Name: "Portfolio", Points: portfolio},
+		Benchmarks: make([]Series, 0),
+		Missing:    make([]string, 0),
+	}
+	pr := returns(portfolio, flows)
+	changes := make([]float64, len(pr))
+	for i, p := range pr {
+		changes[i] = p.change
+	}
+	c.Portfolio.Return = compound(changes)
+	for _, b := range baskets {
+		if s, ok := simulate(portfolio, flows, b, priceAt); ok {
+			c.Benchmarks = append(c.Benchmarks, s)
+		} else {
+			c.Missing = append(c.Missing, b.Name)
+		}
+	}
+	return c
+}
+
+// simulate holds the basket at the times of the portfolio points, prices missing after the start are carried
+func simulate(portfolio []Point, flows []data.Flow, b Basket, priceAt PriceFunc) (Series, bool) {
+	s := Series{Name: b.Name, Points: make([]Point, 0, len(portfolio))}
+	tokens := make([]string, 0)
+	total := 0.0
+	for token, w := range b.Weights {
+		tokens = append(tokens, token)
+		total += w
+	}
+	sort.Strings(tokens)
+	if total <= 0 {
+		return s, false
+	}
+	prices := make(map[string]float64)
+	units := make(map[string]float64)
+	value := func() float64 {
+		v := 0.0
+		for _, token := range tokens {
+			v += units[token] * prices[token]
+		}
+		return v
+	}
+	r := 1.0
+	for i, p := range portfolio {
+		prev := value()
+		for _, token := range tokens {
+			if price, ok := priceAt(token, p.Timestamp); ok && price.IsPositive() {
+				prices[token] = price.InexactFloat64()
+			}
+			if prices[token] == 0 {
+				return s, false
+			}
+		}
+		before := value()
+		if i > 0 && prev > 0 {
+			r *= before / prev
+		}
+		// Money in or out since the last point
+		invest := p.Value
+		if i > 0 {
+			invest = 0
+			for _, f := range flows {
+				if f.Timestamp.After(portfolio[i-1].Timestamp) && !f.Timestamp.After(p.Timestamp) {
+					invest += f.Value.InexactFloat64()
+				}
+			}
+		}
+		switch {
+		case invest > 0:
+			for _, token := range tokens {
+				units[token] += invest * b.Weights[token] / total / prices[token]
+			}
+		case invest < 0 && before > 0:
+			ratio := math.Max(0, before+invest) / before
+			for _, token := range tokens {
+				units[token] *= ratio
+			}
+		}
+		s.Points = append(s.Points, Point{Timestamp: p.Timestamp, Value: value()})
+	}
+	s.Return = r - 1
+	return s, true
+}
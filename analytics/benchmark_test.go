@@ -0,0 +1,51 @@
+package analytics
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	prices := map[string][]float64{
+		"BTC": {100, 110, 121},
+		"ETH": {10, 10, 10},
+	}
+	priceAt := func(token string, at time.Time) (decimal.Decimal, bool) {
+		p, ok := prices[strings.ToUpper(token)]
+		if !ok {
+			return decimal.Zero, false
+		}
+		return decimal.NewFromFloat(p[int(at.Sub(start).Hours()/24)]), true
+	}
+	// 1000 deposited on day 2, portfolio does not move otherwise
+	portfolio := testPoints(start, 1000, 1000, 2000)
+	flows := []data.Flow{{Timestamp: start.AddDate(0, 0, 2), Value: decimal.NewFromInt(1000)}}
+	baskets := append(BasketsOf([]string{"btc", "eth"}),
+		Basket{Name: "half", Weights: map[string]float64{"btc": 1, "eth": 1}},
+		Basket{Name: "missing", Weights: map[string]float64{"dot": 1}},
+	)
+	c := Compare(portfolio, flows, baskets, priceAt)
+	if math.Abs(c.Portfolio.Return) > 1e-9 {
+		t.Errorf("Expected flat portfolio got %v", c.Portfolio.Return)
+	}
+	if len(c.Benchmarks) != 3 || len(c.Missing) != 1 || c.Missing[0] != "missing" {
+		t.Fatalf("Unexpected benchmarks %v missing %v", c.Benchmarks, c.Missing)
+	}
+	btc := c.Benchmarks[0]
+	// 10 BTC grow to 1210, the deposit buys 1000 more
+	if btc.Name != "BTC" || math.Abs(btc.Return-0.21) > 1e-9 || math.Abs(btc.Points[2].Value-2210) > 1e-6 {
+		t.Errorf("Unexpected BTC benchmark %v", btc)
+	}
+	if eth := c.Benchmarks[1]; math.Abs(eth.Return) > 1e-9 || math.Abs(eth.Points[2].Value-2000) > 1e-6 {
+		t.Errorf("Unexpected ETH benchmark %v", eth)
+	}
+	// 500 in each, 605 + 500 after two days
+	if half := c.Benchmarks[2]; math.Abs(half.Points[2].Value-2105) > 1e-6 {
+		t.Errorf("Unexpected basket benchmark %v", half)
+	}
+}
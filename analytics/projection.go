@@ -0,0 +1,179 @@
+package analytics
+
+import (
+	"github.com/zooper-corp/CoinWatch/data"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Percentiles of simulated values shown as bands
+const (
+	lowPercentile  = 0.1
+	highPercentile = 0.9
+)
+
+// MaxProjectionDays is the longest horizon callers taking user input should allow, 50 years
+const MaxProjectionDays = 365 * 50
+
+// ProjectionOptions of Project, Contribution is added every Every days (a negative one withdraws), Goal is
+// ignored when zero and Seed picks a random one when zero
+type ProjectionOptions struct {
+	Days         int
+	Contribution float64
+	Every        int
+	Goal         float64
+	Runs         int
+	Seed         int64
+}
+
+// Band holds the 10th, 50th and 90th percentiles of simulated values at a day, Invested is the start value plus
+// contributions so far
+type Band struct {
+	Timestamp time.Time `json:"timestamp"`
+	Low       float64   `json:"low"`
+	Median    float64   `json:"median"`
+	High      float64   `json:"high"`
+	Invested  float64   `json:"invested"`
+}
+
+// GoalReach is the share of runs reaching the goal within the horizon and the 10th, 50th and 90th percentiles of
+// days it takes, -1 when not reached
+type GoalReach struct {
+	Goal        float64 `json:"goal"`
+	Probability float64 `json:"probability"`
+	Fast        int     `json:"fast"`
+	Median      int     `json:"median"`
+	Slow        int     `json:"slow"`
+}
+
+// Projection of the portfolio value, Returns is the amount of historical daily returns runs are drawn from
+type Projection struct {
+	Start   float64    `json:"start"`
+	Returns int        `json:"returns"`
+	Runs    int        `json:"runs"`
+	Bands   []Band     `json:"bands"`
+	Goal    *GoalReach `json:"goal,omitempty"`
+}
+
+// Project runs Monte Carlo simulations of the portfolio from its last point, every day of a run draws one of the
+// flow adjusted daily returns of history so runs share its volatility and fat tails. Points must be sorted oldest
+// first, ok is false without any return to draw from
+func Project(history []Point, flows []data.Flow, options ProjectionOptions) (Projection, bool) {
+	p := Projection{Runs: options.Runs, Bands: make([]Band, 0)}
+	daily := dailyReturns(returns(history, flows))
+	p.Returns = len(daily)
+	if len(daily) == 0 || options.Runs <= 0 || options.Days <= 0 {
+		return p, false
+	}
+	last := history[len(history)-1]
+	p.Start = last.Value
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	values := make([]float64, options.Runs)
+	reached := make([]int, options.Runs)
+	for i := range values {
+		values[i] = p.Start
+		reached[i] = -1
+		if options.Goal > 0 && p.Start >= options.Goal {
+			reached[i] = 0
+		}
+	}
+	invested := p.Start
+	sorted := make([]float64, options.Runs)
+	copy(sorted, values)
+	p.Bands = append(p.Bands, band(last.Timestamp, sorted, invested))
+	for day := 1; day <= options.Days; day++ {
+		contribution := 0.0
+		if options.Every > 0 && day%options.Every == 0 {
+			contribution = options.Contribution
+		}
+		invested += contribution
+		for i := range values {
+			values[i] = math.Max(0, values[i]*(1+daily[rnd.Intn(len(daily))])+contribution)
+			if reached[i] < 0 && options.Goal > 0 && values[i] >= options.Goal {
+				reached[i] = day
+			}
+		}
+		copy(sorted, values)
+		p.Bands = append(p.Bands, band(last.Timestamp.AddDate(0, 0, day), sorted, invested))
+	}
+	if options.Goal > 0 {
+		p.Goal = goalReach(options.Goal, reached)
+	}
+	return p, true
+}
+
+// dailyReturns spreads returns of periods longer than a day, like gaps in history, over their days so that each
+// day weighs the same in the draws
+func dailyReturns(periods []period) []float64 {
+	r := make([]float64, 0, len(periods))
+	for _, p := range periods {
+		days := int(math.Max(1, math.Round(p.to.Sub(p.from).Hours()/24)))
+		// A total loss happens once, the other days of the period are flat
+		if p.change <= -1 {
+			r = append(r, -1)
+			r = append(r, make([]float64, days-1)...)
+			continue
+		}
+		daily := math.Pow(1+p.change, 1/float64(days)) - 1
+		for i := 0; i < days; i++ {
+			r = append(r, daily)
+		}
+	}
+	return r
+}
+
+// band sorts values in place
+func band(ts time.Time, values []float64, invested float64) Band {
+	sort.Float64s(values)
+	return Band{
+		Timestamp: ts,
+		Low:       percentile(values, lowPercentile),
+		Median:    percentile(values, 0.5),
+		High:      percentile(values, highPercentile),
+		Invested:  invested,
+	}
+}
+
+func goalReach(goal float64, reached []int) *GoalReach {
+	r := &GoalReach{Goal: goal}
+	// Runs not reaching the goal are the slowest
+	days := make([]float64, len(reached))
+	hits := 0
+	for i, d := range reached {
+		days[i] = math.Inf(1)
+		if d >= 0 {
+			days[i] = float64(d)
+			hits++
+		}
+	}
+	sort.Float64s(days)
+	r.Probability = float64(hits) / float64(len(reached))
+	toDays := func(v float64) int {
+		if math.IsInf(v, 1) {
+			return -1
+		}
+		return int(math.Ceil(v))
+	}
+	r.Fast = toDays(percentile(days, lowPercentile))
+	r.Median = toDays(percentile(days, 0.5))
+	r.Slow = toDays(percentile(days, highPercentile))
+	return r
+}
+
+// percentile of sorted values, nearest rank
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,54 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestProject(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Every day gains 10%, the gap of two days as well
+	history := append(testPoints(start, 100, 110), Point{Timestamp: start.AddDate(0, 0, 3), Value: 1000 * 1.21})
+	history[1].Value = 1000
+	history[0].Value = 1000 / 1.1
+	p, ok := Project(history, nil, ProjectionOptions{Days: 3, Contribution: 10, Every: 1, Goal: 1600, Runs: 20, Seed: 1})
+	// The two days gap counts twice
+	if !ok || p.Returns != 3 || len(p.Bands) != 4 {
+		t.Fatalf("Unexpected projection %+v", p)
+	}
+	last := p.Bands[3]
+	// 1210 -> 1341 -> 1485.1 -> 1643.61
+	if math.Abs(last.Median-1643.61) > 1e-6 || last.High-last.Low > 1e-6 || last.Invested != 1240 {
+		t.Errorf("Unexpected last band %+v", last)
+	}
+	if p.Goal == nil || p.Goal.Probability != 1 || p.Goal.Median != 3 || p.Goal.Slow != 3 {
+		t.Errorf("Unexpected goal reach %+v", p.Goal)
+	}
+	// Mixed returns spread runs
+	history = testPoints(start, 100, 110, 99, 108.9, 98.01)
+	p, _ = Project(history, nil, ProjectionOptions{Days: 60, Goal: 1e6, Runs: 200, Seed: 1})
+	last = p.Bands[len(p.Bands)-1]
+	if !(last.Low < last.Median && last.Median < last.High) {
+		t.Errorf("Expected bands to spread got %+v", last)
+	}
+	if p.Goal.Probability != 0 || p.Goal.Median != -1 {
+		t.Errorf("Expected unreachable goal got %+v", p.Goal)
+	}
+	if _, ok := Project(testPoints(start, 100), nil, ProjectionOptions{Days: 10, Runs: 10}); ok {
+		t.Errorf("Expected no projection without history")
+	}
+}
+
+func TestProject_Gap(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	// One day gains 10%, then nothing moves for 30 days without samples
+	history := []Point{{Timestamp: start, Value: 100}, {Timestamp: start.AddDate(0, 0, 1), Value: 110}, {Timestamp: start.AddDate(0, 0, 31), Value: 110}}
+	p, ok := Project(history, nil, ProjectionOptions{Days: 1, Runs: 100, Seed: 1})
+	if !ok || p.Returns != 31 {
+		t.Fatalf("Expected 31 daily returns got %+v", p)
+	}
+	if median := p.Bands[1].Median; median != 110 {
+		t.Errorf("Expected flat days to dominate got median %v", median)
+	}
+}
@@ -0,0 +1,97 @@
+package analytics
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"math"
+	"sort"
+	"strings"
+)
+
+// OtherTarget groups tokens without a target
+const OtherTarget = "Other"
+
+// Target is the weight (0.0 to 1.0) wanted for a token or a group of tokens
+type Target struct {
+	Name   string
+	Tokens []string
+	Weight float64
+}
+
+// Drift compares the weight of a target with the wanted one, Trade is the fiat amount to buy (positive) or sell
+// (negative) to get back to the target, zero while the drift is within the band
+type Drift struct {
+	Name    string          `json:"name"`
+	Tokens  []string        `json:"tokens"`
+	Value   decimal.Decimal `json:"value"`
+	Current float64         `json:"current"`
+	Target  float64         `json:"target"`
+	Drift   float64         `json:"drift"`
+	Trade   decimal.Decimal `json:"trade"`
+}
+
+// OutOfBand is true if a trade is suggested
+func (d Drift) OutOfBand() bool {
+	return !d.Trade.IsZero()
+}
+
+// RebalanceReport lists drifts by decreasing distance from targets
+type RebalanceReport struct {
+	Total  decimal.Decimal `json:"total"`
+	Band   float64         `json:"band"`
+	Drifts []Drift         `json:"drifts"`
+}
+
+// Rebalance compares the last sample of balances with targets, tokens without a target are grouped in
+// OtherTarget with the weight left to 1.0
+func Rebalance(balances data.Balances, targets []Target, band float64) RebalanceReport {
+	entries := balances.LastSample().GroupBySymbol().Entries()
+	r := RebalanceReport{Total: decimal.Zero, Band: band, Drifts: make([]Drift, 0)}
+	values := make(map[string]decimal.Decimal)
+	for _, b := range entries {
+		token := strings.ToUpper(b.Token)
+		values[token] = values[token].Add(b.FiatValue)
+		r.Total = r.Total.Add(b.FiatValue)
+	}
+	// Targets
+	targeted := make(map[string]bool)
+	left := 1.0
+	for _, t := range targets {
+		d := Drift{Name: t.Name, Tokens: make([]string, 0), Value: decimal.Zero, Target: t.Weight}
+		for _, token := range t.Tokens {
+			token = strings.ToUpper(token)
+			targeted[token] = true
+			d.Tokens = append(d.Tokens, token)
+			d.Value = d.Value.Add(values[token])
+		}
+		left -= t.Weight
+		r.Drifts = append(r.Drifts, d)
+	}
+	// Everything else
+	other := Drift{Name: OtherTarget, Tokens: make([]string, 0), Value: decimal.Zero, Target: math.Max(left, 0)}
+	for token, v := range values {
+		if !targeted[token] {
+			other.Tokens = append(other.Tokens, token)
+			other.Value = other.Value.Add(v)
+		}
+	}
+	sort.Strings(other.Tokens)
+	if len(other.Tokens) > 0 || other.Target > 1e-9 {
+		r.Drifts = append(r.Drifts, other)
+	}
+	// Drift and trades
+	for i, d := range r.Drifts {
+		if r.Total.IsPositive() {
+			r.Drifts[i].Current = d.Value.Div(r.Total).InexactFloat64()
+		}
+		r.Drifts[i].Drift = r.Drifts[i].Current - d.Target
+		r.Drifts[i].Trade = decimal.Zero
+		if math.Abs(r.Drifts[i].Drift) > band {
+			r.Drifts[i].Trade = r.Total.Mul(decimal.NewFromFloat(d.Target)).Sub(d.Value).Round(2)
+		}
+	}
+	sort.SliceStable(r.Drifts, func(i, j int) bool {
+		return math.Abs(r.Drifts[i].Drift) > math.Abs(r.Drifts[j].Drift)
+	})
+	return r
+}
@@ -0,0 +1,40 @@
+package analytics
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"testing"
+)
+
+func TestRebalance(t *testing.T) {
+	balances := data.NewBalances([]data.Balance{
+		{Wallet: "a", Token: "btc", Address: "x", FiatValue: decimal.NewFromInt(600), SnapshotId: 1},
+		{Wallet: "b", Token: "BTC", Address: "y", FiatValue: decimal.NewFromInt(100), SnapshotId: 1},
+		{Wallet: "a", Token: "usdc", Address: "x", FiatValue: decimal.NewFromInt(100), SnapshotId: 1},
+		{Wallet: "a", Token: "usdt", Address: "x", FiatValue: decimal.NewFromInt(150), SnapshotId: 1},
+		{Wallet: "a", Token: "dot", Address: "x", FiatValue: decimal.NewFromInt(50), SnapshotId: 1},
+	})
+	r := Rebalance(balances, []Target{
+		{Name: "BTC", Tokens: []string{"btc"}, Weight: 0.5},
+		{Name: "stable", Tokens: []string{"usdc", "usdt"}, Weight: 0.3},
+	}, 0.05)
+	if !r.Total.Equal(decimal.NewFromInt(1000)) || len(r.Drifts) != 3 {
+		t.Fatalf("Unexpected report %v", r)
+	}
+	drifts := make(map[string]Drift)
+	for _, d := range r.Drifts {
+		drifts[d.Name] = d
+	}
+	// 70% instead of 50%, sell 200
+	if btc := drifts["BTC"]; !btc.Trade.Equal(decimal.NewFromInt(-200)) || r.Drifts[0].Name != "BTC" {
+		t.Errorf("Expected to sell 200 BTC first got %v", r.Drifts)
+	}
+	// 25% instead of 30% is within the band
+	if stable := drifts["stable"]; stable.OutOfBand() || !stable.Value.Equal(decimal.NewFromInt(250)) {
+		t.Errorf("Expected stable within band got %v", stable)
+	}
+	// DOT has 5% instead of the 20% left
+	if other := drifts[OtherTarget]; !other.Trade.Equal(decimal.NewFromInt(150)) || len(other.Tokens) != 1 {
+		t.Errorf("Expected to buy 150 of other tokens got %v", other)
+	}
+}
@@ -0,0 +1,154 @@
+package analytics
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TransferThreshold is the change between two snapshots, relative to the balance, above which it is a transfer
+// and not a reward. Rewards are paid at most weekly so they stay well below it. Only used for wallets without a
+// stored ledger
+const TransferThreshold = 0.01
+
+// minYieldPeriod is the shortest history a yield is annualized from
+const minYieldPeriod = time.Hour * 24
+
+// Yield is what a staked balance earned, Rewards is the growth left once transfers are removed and Apy its
+// compounded yearly rate over the time weighted average balance
+type Yield struct {
+	Id        string          `json:"id"`
+	Token     string          `json:"token"`
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Rewards   decimal.Decimal `json:"rewards"`
+	Transfers decimal.Decimal `json:"transfers"`
+	Apy       float64         `json:"apy"`
+}
+
+// Ledger holds stored transactions of wallets with a transaction provider keyed by lower case wallet name, every
+// movement but rewards is a transfer for their balances
+type Ledger map[string][]data.Transaction
+
+// StakingYields returns the yield of every balance with a locked amount in the last sample, keyed by Balance.Id
+func StakingYields(balances data.Balances, ledger Ledger) map[string]Yield {
+	return stakingYields(balances, data.Balance.Id, func(b data.Balance) ([]data.Transaction, bool) {
+		txs, ok := ledger[strings.ToLower(b.Wallet)]
+		r := make([]data.Transaction, 0)
+		for _, tx := range txs {
+			if strings.EqualFold(tx.Token, b.Token) && strings.EqualFold(tx.Address, b.Address) {
+				r = append(r, tx)
+			}
+		}
+		return r, ok
+	})
+}
+
+// StakingYieldsByToken is like StakingYields on balances grouped by token, keyed by upper case token, moves
+// between addresses of the same token cancel out. The ledger is used when every wallet holding the token has one
+func StakingYieldsByToken(balances data.Balances, ledger Ledger) map[string]Yield {
+	wallets := make(map[string]map[string]bool)
+	for _, b := range balances.Entries() {
+		token := strings.ToUpper(b.Token)
+		if wallets[token] == nil {
+			wallets[token] = make(map[string]bool)
+		}
+		wallets[token][strings.ToLower(b.Wallet)] = true
+	}
+	return stakingYields(balances.GroupBySymbol(), func(b data.Balance) string {
+		return strings.ToUpper(b.Token)
+	}, func(b data.Balance) ([]data.Transaction, bool) {
+		r := make([]data.Transaction, 0)
+		for wallet := range wallets[strings.ToUpper(b.Token)] {
+			txs, ok := ledger[wallet]
+			if !ok {
+				return nil, false
+			}
+			for _, tx := range txs {
+				if strings.EqualFold(tx.Token, b.Token) {
+					r = append(r, tx)
+				}
+			}
+		}
+		return r, true
+	})
+}
+
+// stakingYields measures series of staked balances, transactions returns the ledger of a series or false when
+// transfers must be guessed with TransferThreshold
+func stakingYields(balances data.Balances, key func(data.Balance) string, transactions func(data.Balance) ([]data.Transaction, bool)) map[string]Yield {
+	r := make(map[string]Yield)
+	series := make(map[string][]data.Balance)
+	staked := make(map[string]bool)
+	for _, b := range balances.LastSample().Entries() {
+		if b.BalanceLocked.IsPositive() {
+			staked[key(b)] = true
+		}
+	}
+	for _, b := range balances.Entries() {
+		if staked[key(b)] {
+			series[key(b)] = append(series[key(b)], b)
+		}
+	}
+	for k, s := range series {
+		txs, ledger := transactions(s[0])
+		if y, ok := yield(s, txs, ledger); ok {
+			y.Id = k
+			r[k] = y
+		}
+	}
+	return r
+}
+
+// yield measures one balance series, transfers come from transactions when ledger is set. Ok is false without
+// enough history
+func yield(series []data.Balance, transactions []data.Transaction, ledger bool) (Yield, bool) {
+	sort.SliceStable(series, func(i, j int) bool {
+		return series[i].Timestamp.Before(series[j].Timestamp)
+	})
+	first, last := series[0], series[len(series)-1]
+	period := last.Timestamp.Sub(first.Timestamp)
+	if period < minYieldPeriod {
+		return Yield{}, false
+	}
+	y := Yield{Token: first.Token, From: first.Timestamp, To: last.Timestamp, Rewards: decimal.Zero, Transfers: decimal.Zero}
+	weighted := 0.0
+	threshold := decimal.NewFromFloat(TransferThreshold)
+	for i := 1; i < len(series); i++ {
+		prev, cur := series[i-1], series[i]
+		delta := cur.Balance.Sub(prev.Balance)
+		switch {
+		case ledger:
+			moved := ledgerFlow(transactions, prev.Timestamp, cur.Timestamp)
+			y.Transfers = y.Transfers.Add(moved)
+			y.Rewards = y.Rewards.Add(delta.Sub(moved))
+		case delta.Abs().GreaterThan(prev.Balance.Mul(threshold)):
+			y.Transfers = y.Transfers.Add(delta)
+		default:
+			y.Rewards = y.Rewards.Add(delta)
+		}
+		weighted += prev.Balance.InexactFloat64() * cur.Timestamp.Sub(prev.Timestamp).Seconds()
+	}
+	average := weighted / period.Seconds()
+	if average <= 0 {
+		return Yield{}, false
+	}
+	rate := y.Rewards.InexactFloat64() / average
+	y.Apy = math.Pow(1+rate, (time.Hour*24*365).Seconds()/period.Seconds()) - 1
+	return y, true
+}
+
+// ledgerFlow sums what transactions other than rewards moved in (from, to], fees included
+func ledgerFlow(transactions []data.Transaction, from time.Time, to time.Time) decimal.Decimal {
+	r := decimal.Zero
+	for _, tx := range transactions {
+		if tx.Type == data.TxReward || !tx.Timestamp.After(from) || tx.Timestamp.After(to) {
+			continue
+		}
+		r = r.Add(tx.Amount).Sub(tx.Fee)
+	}
+	return r
+}
@@ -0,0 +1,79 @@
+package analytics
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStakingYields(t *testing.T) {
+	now := time.Now()
+	// Newest first, 0.1% a day on 1000 DOT with a 500 DOT deposit halfway, plus an unstaked token
+	entries := make([]data.Balance, 0)
+	balance := decimal.NewFromInt(1000)
+	series := make([]decimal.Decimal, 0)
+	for day := 0; day <= 30; day++ {
+		if day == 15 {
+			balance = balance.Add(decimal.NewFromInt(500))
+		}
+		series = append(series, balance)
+		balance = balance.Mul(decimal.NewFromFloat(1.001))
+	}
+	for day := 30; day >= 0; day-- {
+		ts := now.AddDate(0, 0, day-30)
+		entries = append(entries,
+			data.Balance{Timestamp: ts, Wallet: "w", Token: "dot", Address: "a", Balance: series[day], BalanceLocked: series[day], SnapshotId: int64(day + 1)},
+			data.Balance{Timestamp: ts, Wallet: "w", Token: "dot", Address: "b", Balance: decimal.NewFromInt(10), SnapshotId: int64(day + 1)},
+			data.Balance{Timestamp: ts, Wallet: "w", Token: "usdc", Address: "a", Balance: decimal.NewFromInt(100), SnapshotId: int64(day + 1)},
+		)
+	}
+	yields := StakingYields(data.NewBalances(entries), nil)
+	if len(yields) != 1 {
+		t.Fatalf("Expected only the staked balance got %v", yields)
+	}
+	y, ok := yields["w/dot/a"]
+	if !ok || y.Transfers.LessThan(decimal.NewFromInt(500)) || y.Transfers.GreaterThan(decimal.NewFromInt(502)) {
+		t.Fatalf("Expected the deposit to be a transfer got %v", y)
+	}
+	// The reward of the deposit day is counted with it
+	expected := math.Pow(1.001, 365) - 1
+	if math.Abs(y.Apy-expected) > 0.03 {
+		t.Errorf("Expected APY close to %v got %v", expected, y.Apy)
+	}
+	// The unstaked address dilutes the token yield
+	byToken := StakingYieldsByToken(data.NewBalances(entries), nil)
+	if dot, ok := byToken["DOT"]; !ok || dot.Apy >= y.Apy || dot.Apy <= 0 {
+		t.Errorf("Unexpected token yield %v", byToken)
+	}
+}
+
+func TestStakingYields_Ledger(t *testing.T) {
+	now := time.Now()
+	// 1000 DOT earning nothing with a 5 DOT deposit, below TransferThreshold, on day 10
+	entries := make([]data.Balance, 0)
+	for day := 30; day >= 0; day-- {
+		balance := decimal.NewFromInt(1000)
+		if day >= 10 {
+			balance = balance.Add(decimal.NewFromInt(5))
+		}
+		entries = append(entries, data.Balance{
+			Timestamp: now.AddDate(0, 0, day-30), Wallet: "W", Token: "dot", Address: "a", Balance: balance, BalanceLocked: balance, SnapshotId: int64(day + 1),
+		})
+	}
+	deposit := data.Transaction{
+		Timestamp: now.AddDate(0, 0, -20).Add(-time.Hour), Wallet: "w", Type: data.TxDeposit, Token: "DOT", Address: "a", Amount: decimal.NewFromInt(5),
+	}
+	// Guessed as a reward without a ledger
+	if y := StakingYields(data.NewBalances(entries), nil)["W/dot/a"]; y.Apy <= 0 {
+		t.Errorf("Expected the small deposit to count as reward got %+v", y)
+	}
+	ledger := Ledger{"w": {deposit}}
+	if y := StakingYields(data.NewBalances(entries), ledger)["W/dot/a"]; !y.Rewards.IsZero() || !y.Transfers.Equal(decimal.NewFromInt(5)) || y.Apy != 0 {
+		t.Errorf("Expected the deposit as transfer got %+v", y)
+	}
+	if y := StakingYieldsByToken(data.NewBalances(entries), ledger)["DOT"]; !y.Rewards.IsZero() || y.Apy != 0 {
+		t.Errorf("Expected no token reward got %+v", y)
+	}
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/accounting"
+	"github.com/zooper-corp/CoinWatch/analytics"
 	"github.com/zooper-corp/CoinWatch/client"
 	"github.com/zooper-corp/CoinWatch/config"
 	"github.com/zooper-corp/CoinWatch/data"
@@ -30,9 +34,11 @@ func NewApiServer(c *client.Client, cfg config.ApiServerConfig) ApiServer {
 }
 
 func (s *ApiServer) Start() {
-	http.HandleFunc("/api/v1/balance", s.corsMiddleware(s.authMiddleware(s.handleBalance)))
-	http.HandleFunc("/api/v1/history", s.corsMiddleware(s.authMiddleware(s.handleHistory)))
-	http.HandleFunc("/api/v1/query", s.corsMiddleware(s.authMiddleware(s.handleQuery)))
+	for name, handler := range s.routes() {
+		http.HandleFunc("/api/v1/"+name, s.corsMiddleware(s.authMiddleware(handler)))
+	}
+	http.HandleFunc("/api/v1/portfolios", s.corsMiddleware(s.authMiddleware(s.handlePortfolios)))
+	http.HandleFunc("/api/v1/portfolios/", s.corsMiddleware(s.authMiddleware(s.handlePortfolios)))
 	http.HandleFunc("/metrics", s.corsMiddleware(s.authMiddleware(s.handleMetrics)))
 	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
 	log.Printf("Starting API server on %s", addr)
@@ -41,6 +47,63 @@ func (s *ApiServer) Start() {
 	}
 }
 
+// routes are the endpoints served under /api/v1/ for the default portfolio and under
+// /api/v1/portfolios/<name>/ for any of them
+func (s *ApiServer) routes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"balance":     s.handleBalance,
+		"history":     s.handleHistory,
+		"query":       s.handleQuery,
+		"prices":      s.handlePrices,
+		"pnl":         s.handlePnl,
+		"performance": s.handlePerformance,
+		"stats":       s.handleStats,
+		"rebalance":   s.handleRebalance,
+		"benchmark":   s.handleBenchmark,
+		"projection":  s.handleProjection,
+		"events":      s.handleEvents,
+	}
+}
+
+// portfolioKey holds the client of the portfolio in the request path in the request context
+type portfolioKey struct{}
+
+// clientOf returns the client of the portfolio in the request path, the default one otherwise
+func (s *ApiServer) clientOf(r *http.Request) *client.Client {
+	if c, ok := r.Context().Value(portfolioKey{}).(*client.Client); ok {
+		return c
+	}
+	return s.client
+}
+
+// handlePortfolios lists portfolios or serves /api/v1/portfolios/<name>/<endpoint> with the client of the portfolio
+func (s *ApiServer) handlePortfolios(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/portfolios"), "/")
+	if path == "" {
+		s.writeJSONResponse(w, ApiResponse{
+			Message: "Portfolios retrieved successfully",
+			Data:    s.client.GetPortfolios(),
+		})
+		return
+	}
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	handler, ok := s.routes()[parts[1]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	c, err := s.client.WithPortfolio(parts[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	handler(w, r.WithContext(context.WithValue(r.Context(), portfolioKey{}, &c)))
+}
+
 func (s *ApiServer) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Received request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
@@ -89,16 +152,70 @@ func (s *ApiServer) writeJSONResponse(w http.ResponseWriter, response ApiRespons
 	}
 }
 
+// balanceEntry is a balance with the staking yield of the last days when it is staked
+type balanceEntry struct {
+	data.Balance
+	Apy *float64 `json:"apy,omitempty"`
+}
+
 func (s *ApiServer) handleBalance(w http.ResponseWriter, r *http.Request) {
-	balance := s.client.GetLastBalance()
+	days := 30
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid days parameter", http.StatusBadRequest)
+			return
+		}
+		days = d
+	}
+	balance := s.clientOf(r).GetLastBalance()
+	if groupBy := r.URL.Query().Get("group_by"); groupBy != "" {
+		grouped, err := s.clientOf(r).GroupBalances(balance, groupBy)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.writeJSONResponse(w, ApiResponse{
+			Message: "Balance retrieved successfully",
+			Updated: s.clientOf(r).GetLastBalanceUpdate(),
+			Data:    groupEntries(grouped),
+		})
+		return
+	}
+	yields, err := s.clientOf(r).GetStakingYields(days)
+	if err != nil {
+		log.Printf("Unable to compute staking yields: %v", err)
+	}
+	entries := make([]balanceEntry, 0)
+	for _, b := range balance.Entries() {
+		e := balanceEntry{Balance: b}
+		if y, ok := yields[b.Id()]; ok {
+			apy := y.Apy
+			e.Apy = &apy
+		}
+		entries = append(entries, e)
+	}
 	response := ApiResponse{
 		Message: "Balance retrieved successfully",
-		Updated: s.client.GetLastBalanceUpdate(),
-		Data:    balance.Entries(),
+		Updated: s.clientOf(r).GetLastBalanceUpdate(),
+		Data:    entries,
 	}
 	s.writeJSONResponse(w, response)
 }
 
+// groupEntries lists grouped balances by name, quantities of different tokens do not add up so only values are kept
+func groupEntries(grouped data.Balances) []map[string]interface{} {
+	r := make([]map[string]interface{}, 0)
+	for _, b := range grouped.Entries() {
+		r = append(r, map[string]interface{}{
+			"group":      b.Token,
+			"timestamp":  b.Timestamp,
+			"fiat_value": b.FiatValue,
+		})
+	}
+	return r
+}
+
 func (s *ApiServer) handleHistory(w http.ResponseWriter, r *http.Request) {
 	amountStr := r.URL.Query().Get("amount")
 	intervalStr := r.URL.Query().Get("interval")
@@ -112,19 +229,34 @@ func (s *ApiServer) handleHistory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid interval parameter", http.StatusBadRequest)
 		return
 	}
-	totalHours := amount * interval
-	totalDays := (totalHours + 23) / 24 // ceil division to ensure full coverage
-	bs, err := s.client.QueryBalance(data.BalanceQueryOptions{Days: totalDays})
+	groupBy := r.URL.Query().Get("group_by")
+	seriesGroupBy := data.GroupByToken
+	if groupBy != "" && groupBy != data.GroupByToken {
+		// Other groups are computed from balances of each bucket
+		seriesGroupBy = data.GroupByNone
+	}
+	entries, err := s.clientOf(r).GetTimeSeries(data.TimeSeriesOptions{
+		Amount:   amount,
+		Interval: time.Duration(interval) * time.Hour,
+		GroupBy:  seriesGroupBy,
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Unable to query balances: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if seriesGroupBy == data.GroupByNone {
+		for i := range entries {
+			if entries[i], err = s.clientOf(r).GroupBalances(entries[i], groupBy); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
 	// Get tokens
-	unsortedTokens := bs.Tokens()
-	entries := bs.GetTimeSeries(amount, time.Duration(interval)*time.Hour)
+	unsortedTokens := data.SeriesTokens(entries)
 	lastSampleTotals := make([]float64, len(unsortedTokens))
 	for i, t := range unsortedTokens {
-		lastSampleTotals[i] = entries[0].FilterToken(t).TotalFiatValue()
+		lastSampleTotals[i] = entries[0].FilterToken(t).TotalFiatValue().InexactFloat64()
 	}
 	order := tools.ReverseIntArray(tools.SortAndReturnIndex(lastSampleTotals))
 	tokens := make([]string, len(unsortedTokens))
@@ -154,33 +286,43 @@ func (s *ApiServer) handleHistory(w http.ResponseWriter, r *http.Request) {
 	}
 	response := ApiResponse{
 		Message: "History retrieved successfully",
-		Updated: s.client.GetLastBalanceUpdate(),
+		Updated: s.clientOf(r).GetLastBalanceUpdate(),
 		Data:    dataSeries,
 	}
 	s.writeJSONResponse(w, response)
 }
 
 func (s *ApiServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
-	balance := s.client.GetLastBalance()
+	balance := s.clientOf(r).GetLastBalance()
 	// Set headers
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(s.config.CacheTTL.Seconds())))
 	w.Header().Set("Content-Type", "text/plain")
 	// Find BTC value first
-	btcValue := balance.FilterToken("BTC").TotalFiatValue()
-	btcPrice := btcValue / balance.FilterToken("BTC").TokenBalance("BTC")
+	btcPrice := decimal.Zero
+	if btcAmount := balance.FilterToken("BTC").TokenBalance("BTC"); !btcAmount.IsZero() {
+		btcPrice = balance.FilterToken("BTC").TotalFiatValue().Div(btcAmount)
+	}
 	// Write metrics
 	tokens := balance.Tokens()
 	for _, token := range tokens {
 		bd := balance.FilterToken(token)
 		amount := bd.TokenBalance(token)
 		value := bd.TotalFiatValue()
-		price := value / amount
+		price := decimal.Zero
+		if !amount.IsZero() {
+			price = value.Div(amount)
+		}
 		metrics := []string{
-			fmt.Sprintf("crypto_balance{token=\"%s\",type=\"balance\"} %f\n", token, amount),
-			fmt.Sprintf("crypto_balance{token=\"%s\",type=\"value\"} %f\n", token, value),
-			fmt.Sprintf("crypto_balance{token=\"%s\",type=\"price\"} %f\n", token, price),
-			fmt.Sprintf("crypto_balance{token=\"%s\",type=\"price_btc\"} %f\n", token, price/btcPrice),
-			fmt.Sprintf("crypto_balance{token=\"%s\",type=\"value_btc\"} %f\n", token, value/btcPrice),
+			fmt.Sprintf("crypto_balance{token=\"%s\",type=\"balance\"} %s\n", token, amount),
+			fmt.Sprintf("crypto_balance{token=\"%s\",type=\"value\"} %s\n", token, value),
+			fmt.Sprintf("crypto_balance{token=\"%s\",type=\"price\"} %s\n", token, price),
+		}
+		// Without BTC there is no BTC denominated value
+		if !btcPrice.IsZero() {
+			metrics = append(metrics,
+				fmt.Sprintf("crypto_balance{token=\"%s\",type=\"price_btc\"} %s\n", token, price.Div(btcPrice)),
+				fmt.Sprintf("crypto_balance{token=\"%s\",type=\"value_btc\"} %s\n", token, value.Div(btcPrice)),
+			)
 		}
 		for _, metric := range metrics {
 			if _, err := w.Write([]byte(metric)); err != nil {
@@ -189,6 +331,286 @@ func (s *ApiServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	// Price cache
+	stats := s.clientOf(r).GetPriceCacheStats()
+	metrics := []string{
+		fmt.Sprintf("coinwatch_price_cache{type=\"hits\"} %d\n", stats.Hits),
+		fmt.Sprintf("coinwatch_price_cache{type=\"misses\"} %d\n", stats.Misses),
+		fmt.Sprintf("coinwatch_price_cache{type=\"fetches\"} %d\n", stats.Fetches),
+		fmt.Sprintf("coinwatch_price_cache{type=\"entries\"} %d\n", stats.Entries),
+	}
+	for _, metric := range metrics {
+		if _, err := w.Write([]byte(metric)); err != nil {
+			log.Printf("Error writing price cache metric: %v", err)
+			return
+		}
+	}
+}
+
+func (s *ApiServer) handlePrices(w http.ResponseWriter, r *http.Request) {
+	tokens := s.clientOf(r).GetLastBalance().Tokens()
+	if tokensStr := r.URL.Query().Get("tokens"); tokensStr != "" {
+		tokens = strings.Split(strings.ToUpper(tokensStr), ",")
+	}
+	prices, err := s.clientOf(r).GetPrices(tokens)
+	if err != nil && len(prices.Entries) == 0 {
+		http.Error(w, fmt.Sprintf("Unable to get prices: %v", err), http.StatusInternalServerError)
+		return
+	}
+	result := make([]map[string]interface{}, 0)
+	for _, p := range prices.Entries {
+		result = append(result, map[string]interface{}{
+			"token":     strings.ToLower(p.Token),
+			"price":     p.Price,
+			"fiat":      strings.ToLower(s.clientOf(r).GetFiat()),
+			"timestamp": p.Timestamp,
+			"stale":     p.Stale,
+		})
+	}
+	response := ApiResponse{
+		Message: "Prices retrieved successfully",
+		Updated: time.Now(),
+		Data:    result,
+	}
+	s.writeJSONResponse(w, response)
+}
+
+func (s *ApiServer) handlePnl(w http.ResponseWriter, r *http.Request) {
+	report, err := s.clientOf(r).GetCostBasis(r.URL.Query().Get("method"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to compute cost basis: %v", err), http.StatusBadRequest)
+		return
+	}
+	position := func(p accounting.Position) map[string]interface{} {
+		return map[string]interface{}{
+			"token":        strings.ToLower(p.Token),
+			"quantity":     p.Quantity,
+			"average_cost": p.AverageCost(),
+			"cost":         p.Cost,
+			"value":        p.Value,
+			"unrealized":   p.Unrealized(),
+			"realized":     p.Realized,
+			"income":       p.Income,
+			"unmatched":    p.Unmatched,
+		}
+	}
+	positions := make([]map[string]interface{}, 0)
+	for _, p := range report.Positions {
+		positions = append(positions, position(p))
+	}
+	total := position(report.Total())
+	delete(total, "token")
+	delete(total, "quantity")
+	delete(total, "average_cost")
+	delete(total, "unmatched")
+	response := ApiResponse{
+		Message: "Cost basis computed successfully",
+		Updated: time.Now(),
+		Data: map[string]interface{}{
+			"method":         report.Method,
+			"fiat":           strings.ToLower(report.Fiat),
+			"positions":      positions,
+			"total":          total,
+			"missing_prices": report.Missing,
+		},
+	}
+	s.writeJSONResponse(w, response)
+}
+
+func (s *ApiServer) handlePerformance(w http.ResponseWriter, r *http.Request) {
+	days := 7
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid days parameter", http.StatusBadRequest)
+			return
+		}
+		days = d
+	}
+	p, err := s.clientOf(r).GetPerformance(days)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to compute performance: %v", err), http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{
+		Message: "Performance computed successfully",
+		Updated: s.clientOf(r).GetLastBalanceUpdate(),
+		Data: map[string]interface{}{
+			"days":           days,
+			"from":           p.From,
+			"to":             p.To,
+			"start":          p.Start,
+			"end":            p.End,
+			"net_flows":      p.NetFlows,
+			"gain":           p.Gain(),
+			"time_weighted":  p.TimeWeighted,
+			"money_weighted": p.MoneyWeighted,
+		},
+	}
+	s.writeJSONResponse(w, response)
+}
+
+func (s *ApiServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	days, window, riskFree := 90, 30, 0.0
+	for name, v := range map[string]*int{"days": &days, "window": &window} {
+		if str := r.URL.Query().Get(name); str != "" {
+			i, err := strconv.Atoi(str)
+			if err != nil || i < 2 {
+				http.Error(w, fmt.Sprintf("Invalid %s parameter", name), http.StatusBadRequest)
+				return
+			}
+			*v = i
+		}
+	}
+	if str := r.URL.Query().Get("risk_free"); str != "" {
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			http.Error(w, "Invalid risk_free parameter", http.StatusBadRequest)
+			return
+		}
+		riskFree = f
+	}
+	stats, err := s.clientOf(r).GetStats(days, window, riskFree)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to compute stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{
+		Message: "Stats computed successfully",
+		Updated: s.clientOf(r).GetLastBalanceUpdate(),
+		Data:    stats,
+	}
+	s.writeJSONResponse(w, response)
+}
+
+func (s *ApiServer) handleBenchmark(w http.ResponseWriter, r *http.Request) {
+	days := 90
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid days parameter", http.StatusBadRequest)
+			return
+		}
+		days = d
+	}
+	comparison, err := s.clientOf(r).GetBenchmarks(days)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to compute benchmarks: %v", err), http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{
+		Message: "Benchmarks computed successfully",
+		Updated: s.clientOf(r).GetLastBalanceUpdate(),
+		Data:    comparison,
+	}
+	s.writeJSONResponse(w, response)
+}
+
+// Projection limits keep a single request from running for too long, draws is days times runs
+const (
+	maxProjectionRuns    = 10000
+	maxProjectionHistory = 365 * 10
+	maxProjectionDraws   = 365 * 5 * maxProjectionRuns
+)
+
+func (s *ApiServer) handleProjection(w http.ResponseWriter, r *http.Request) {
+	c := s.clientOf(r)
+	goal := c.GetGoal()
+	options := analytics.ProjectionOptions{
+		Days:         365 * 5,
+		Contribution: goal.Contribution,
+		Every:        goal.EveryDays(),
+		Goal:         goal.Value,
+		Runs:         1000,
+	}
+	history := 365
+	for name, v := range map[string]*int{"days": &options.Days, "history": &history, "runs": &options.Runs, "every": &options.Every} {
+		if str := r.URL.Query().Get(name); str != "" {
+			i, err := strconv.Atoi(str)
+			if err != nil || i < 1 {
+				http.Error(w, fmt.Sprintf("Invalid %s parameter", name), http.StatusBadRequest)
+				return
+			}
+			*v = i
+		}
+	}
+	for name, v := range map[string]*float64{"contribution": &options.Contribution, "goal": &options.Goal} {
+		if str := r.URL.Query().Get(name); str != "" {
+			f, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid %s parameter", name), http.StatusBadRequest)
+				return
+			}
+			*v = f
+		}
+	}
+	if options.Runs > maxProjectionRuns {
+		http.Error(w, fmt.Sprintf("Runs must not exceed %d", maxProjectionRuns), http.StatusBadRequest)
+		return
+	}
+	if options.Days > analytics.MaxProjectionDays {
+		http.Error(w, fmt.Sprintf("Days must not exceed %d", analytics.MaxProjectionDays), http.StatusBadRequest)
+		return
+	}
+	if history > maxProjectionHistory {
+		http.Error(w, fmt.Sprintf("History must not exceed %d", maxProjectionHistory), http.StatusBadRequest)
+		return
+	}
+	if options.Days*options.Runs > maxProjectionDraws {
+		http.Error(w, fmt.Sprintf("Days times runs must not exceed %d", maxProjectionDraws), http.StatusBadRequest)
+		return
+	}
+	if options.Every == 0 {
+		options.Every = 30
+	}
+	projection, err := c.GetProjection(history, options)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to project: %v", err), http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{
+		Message: "Projection computed successfully",
+		Updated: c.GetLastBalanceUpdate(),
+		Data:    projection,
+	}
+	s.writeJSONResponse(w, response)
+}
+
+func (s *ApiServer) handleRebalance(w http.ResponseWriter, r *http.Request) {
+	report, err := s.clientOf(r).GetRebalance()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to compute rebalance: %v", err), http.StatusBadRequest)
+		return
+	}
+	response := ApiResponse{
+		Message: "Rebalance computed successfully",
+		Updated: s.clientOf(r).GetLastBalanceUpdate(),
+		Data:    report,
+	}
+	s.writeJSONResponse(w, response)
+}
+
+func (s *ApiServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if str := r.URL.Query().Get("days"); str != "" {
+		i, err := strconv.Atoi(str)
+		if err != nil || i < 1 {
+			http.Error(w, "Invalid days parameter", http.StatusBadRequest)
+			return
+		}
+		days = i
+	}
+	events, err := s.clientOf(r).GetEvents(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unable to get events: %v", err), http.StatusInternalServerError)
+		return
+	}
+	response := ApiResponse{
+		Message: "Events retrieved successfully",
+		Updated: s.clientOf(r).GetLastBalanceUpdate(),
+		Data:    events,
+	}
+	s.writeJSONResponse(w, response)
 }
 
 func (s *ApiServer) handleQuery(w http.ResponseWriter, r *http.Request) {
@@ -211,13 +633,7 @@ func (s *ApiServer) handleQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	interval := time.Duration(intervalHours) * time.Hour
-	// Fetch raw balances for [from, to]
-	rawBalances, err := s.client.GetBalancesFromDate(from)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to fetch balances: %v", err), http.StatusInternalServerError)
-		return
-	}
-	// Build a time-series via GetTimeSeries.
+	// Build a time-series for [from, to]
 	to := time.Now()
 	totalDuration := to.Sub(from)
 	if totalDuration < 0 {
@@ -228,12 +644,20 @@ func (s *ApiServer) handleQuery(w http.ResponseWriter, r *http.Request) {
 	if steps < 1 {
 		steps = 1
 	}
-	entries := rawBalances.GetTimeSeries(steps, interval)
+	entries, err := s.clientOf(r).GetTimeSeries(data.TimeSeriesOptions{
+		Amount:   steps,
+		Interval: interval,
+		GroupBy:  data.GroupByToken,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch balances: %v", err), http.StatusInternalServerError)
+		return
+	}
 	// Get tokens
-	unsortedTokens := rawBalances.Tokens()
+	unsortedTokens := data.SeriesTokens(entries)
 	lastSampleTotals := make([]float64, len(unsortedTokens))
 	for i, t := range unsortedTokens {
-		lastSampleTotals[i] = entries[0].FilterToken(t).TotalFiatValue()
+		lastSampleTotals[i] = entries[0].FilterToken(t).TotalFiatValue().InexactFloat64()
 	}
 	order := tools.ReverseIntArray(tools.SortAndReturnIndex(lastSampleTotals))
 	tokens := make([]string, len(unsortedTokens))
@@ -256,8 +680,8 @@ func (s *ApiServer) handleQuery(w http.ResponseWriter, r *http.Request) {
 					point[token] = tokenData.TokenBalance(token)
 				} else if //goland:noinspection GoDfaConstantCondition
 				mode == "price" {
-					if tokenData.TokenBalance(token) > 0 {
-						point[token] = tokenData.TotalFiatValue() / tokenData.TokenBalance(token)
+					if tokenData.TokenBalance(token).IsPositive() {
+						point[token] = tokenData.TotalFiatValue().Div(tokenData.TokenBalance(token))
 					} else {
 						continue
 					}
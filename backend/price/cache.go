@@ -0,0 +1,139 @@
+package price
+
+import (
+	"fmt"
+	"github.com/zooper-corp/CoinWatch/data"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStats counts cache usage per token lookup
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Fetches uint64
+	Entries int
+}
+
+// CachedProvider keeps recent quotes so concurrent callers share them, all missing tokens are fetched in a
+// single batch. The lock is not held while fetching, callers needing a token being fetched wait for that fetch only
+type CachedProvider struct {
+	source   Provider
+	ttl      time.Duration
+	mu       *sync.Mutex
+	entries  map[string]data.TokenPrice
+	inflight map[string]chan struct{}
+	stats    *CacheStats
+}
+
+func NewCachedProvider(source Provider, ttl time.Duration) CachedProvider {
+	return CachedProvider{
+		source:   source,
+		ttl:      ttl,
+		mu:       &sync.Mutex{},
+		entries:  make(map[string]data.TokenPrice),
+		inflight: make(map[string]chan struct{}),
+		stats:    &CacheStats{},
+	}
+}
+
+func (p CachedProvider) Name() string {
+	return fmt.Sprintf("Cached%s", p.source.Name())
+}
+
+// GetPrices returns cached quotes marked as Cached and fetches the others
+func (p CachedProvider) GetPrices(tokens []string, fiat string) (data.TokenPrices, error) {
+	now := time.Now()
+	result := data.TokenPrices{}
+	missing := make([]string, 0)
+	waiting := make(map[string]chan struct{})
+	done := make(chan struct{})
+	p.mu.Lock()
+	for _, t := range tokens {
+		key := cacheKey(t, fiat)
+		if e, ok := p.entries[key]; ok && now.Sub(e.Timestamp) < p.ttl {
+			e.Token = t
+			e.Cached = true
+			result.Entries = append(result.Entries, e)
+			p.stats.Hits++
+		} else if ch, ok := p.inflight[key]; ok {
+			waiting[t] = ch
+			p.stats.Hits++
+		} else {
+			missing = append(missing, t)
+			p.inflight[key] = done
+			p.stats.Misses++
+		}
+	}
+	if len(missing) > 0 {
+		p.stats.Fetches++
+	}
+	p.mu.Unlock()
+	var err error
+	if len(missing) > 0 {
+		var fetched data.TokenPrices
+		fetched, err = p.fetch(missing, fiat, now, done)
+		result.Entries = append(result.Entries, fetched.Entries...)
+	}
+	// Tokens fetched by another caller, fetched again if that fetch failed
+	retry := make([]string, 0)
+	for t, ch := range waiting {
+		<-ch
+		p.mu.Lock()
+		e, ok := p.entries[cacheKey(t, fiat)]
+		p.mu.Unlock()
+		if !ok {
+			retry = append(retry, t)
+			continue
+		}
+		e.Token = t
+		e.Cached = true
+		result.Entries = append(result.Entries, e)
+	}
+	if len(retry) > 0 {
+		tp, retryErr := p.source.GetPrices(retry, fiat)
+		result.Entries = append(result.Entries, tp.Entries...)
+		if retryErr != nil {
+			err = retryErr
+		}
+	}
+	return result, err
+}
+
+// fetch gets tokens from the source and caches them, done is closed once they are
+func (p CachedProvider) fetch(tokens []string, fiat string, now time.Time, done chan struct{}) (data.TokenPrices, error) {
+	log.Printf("Price cache miss for %v", tokens)
+	tp, err := p.source.GetPrices(tokens, fiat)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer close(done)
+	for i, e := range tp.Entries {
+		// Stale prices are not cached so live sources are retried next time
+		if !e.Stale {
+			if e.Timestamp.IsZero() {
+				e.Timestamp = now
+				tp.Entries[i].Timestamp = now
+			}
+			p.entries[cacheKey(e.Token, fiat)] = e
+		}
+	}
+	for _, t := range tokens {
+		delete(p.inflight, cacheKey(t, fiat))
+	}
+	return tp, err
+}
+
+// Stats returns a copy of the current cache counters
+func (p CachedProvider) Stats() CacheStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := *p.stats
+	s.Entries = len(p.entries)
+	return s
+}
+
+func cacheKey(token string, fiat string) string {
+	return fmt.Sprintf("%s/%s", strings.ToUpper(token), strings.ToUpper(fiat))
+}
@@ -0,0 +1,84 @@
+package price
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingProvider struct {
+	staticProvider
+	calls *int
+}
+
+func (p countingProvider) GetPrices(tokens []string, fiat string) (data.TokenPrices, error) {
+	*p.calls++
+	return p.staticProvider.GetPrices(tokens, fiat)
+}
+
+func TestCachedProvider_GetPrices(t *testing.T) {
+	calls := 0
+	p := NewCachedProvider(countingProvider{
+		staticProvider{map[string]float64{"BTC": 100, "DOT": 10}},
+		&calls,
+	}, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ps, err := p.GetPrices([]string{"btc", "dot"}, "eur")
+			if err != nil || !ps.GetPrice("dot").Equal(decimal.NewFromInt(10)) {
+				t.Errorf("Unexpected prices %v %v", ps, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("Expected 1 source call got %v", calls)
+	}
+	// Only missing token is fetched
+	_, _ = p.GetPrices([]string{"btc", "eth"}, "eur")
+	stats := p.Stats()
+	if calls != 2 || stats.Hits != 19 || stats.Misses != 3 {
+		t.Errorf("Unexpected stats %+v calls %v", stats, calls)
+	}
+}
+
+type blockingProvider struct {
+	staticProvider
+	release chan struct{}
+}
+
+func (p blockingProvider) GetPrices(tokens []string, fiat string) (data.TokenPrices, error) {
+	for _, t := range tokens {
+		if t == "slow" {
+			<-p.release
+		}
+	}
+	return p.staticProvider.GetPrices(tokens, fiat)
+}
+
+func TestCachedProvider_SlowFetch(t *testing.T) {
+	release := make(chan struct{})
+	p := NewCachedProvider(blockingProvider{staticProvider{map[string]float64{"BTC": 100, "SLOW": 1}}, release}, time.Minute)
+	if ps, _ := p.GetPrices([]string{"btc"}, "eur"); len(ps.Entries) != 1 || ps.Entries[0].Cached {
+		t.Fatalf("Expected a fetched price got %+v", ps)
+	}
+	slow := make(chan data.TokenPrices)
+	go func() {
+		ps, _ := p.GetPrices([]string{"slow"}, "eur")
+		slow <- ps
+	}()
+	// Hits are served while the slow token is fetched, and marked as cached so they are not stored twice
+	ps, _ := p.GetPrices([]string{"btc"}, "eur")
+	if len(ps.Entries) != 1 || !ps.Entries[0].Cached {
+		t.Errorf("Expected a cached price got %+v", ps)
+	}
+	close(release)
+	if ps := <-slow; !ps.GetPrice("slow").Equal(decimal.NewFromInt(1)) {
+		t.Errorf("Unexpected slow price %+v", ps)
+	}
+}
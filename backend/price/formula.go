@@ -0,0 +1,214 @@
+package price
+
+import (
+	"fmt"
+	"github.com/shopspring/decimal"
+	"strings"
+	"unicode"
+)
+
+// Formula is a parsed arithmetic expression over token prices like "0.5 * eth + 0.5 * btc"
+type Formula struct {
+	source string
+	root   formulaNode
+}
+
+type formulaNode interface {
+	eval(prices map[string]decimal.Decimal) (decimal.Decimal, error)
+}
+
+type formulaNumber decimal.Decimal
+
+type formulaToken string
+
+type formulaBinary struct {
+	op    rune
+	left  formulaNode
+	right formulaNode
+}
+
+type formulaNegate struct {
+	node formulaNode
+}
+
+type formulaParser struct {
+	input []rune
+	pos   int
+}
+
+// ParseFormula parses an expression supporting numbers, token symbols, + - * / and parentheses
+func ParseFormula(source string) (Formula, error) {
+	p := formulaParser{input: []rune(source)}
+	root, err := p.parseExpression()
+	if err != nil {
+		return Formula{}, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return Formula{}, fmt.Errorf("unexpected '%c' at %d in formula '%s'", p.input[p.pos], p.pos, source)
+	}
+	return Formula{source: source, root: root}, nil
+}
+
+// Tokens returns all token symbols referenced by the formula
+func (f Formula) Tokens() []string {
+	r := make([]string, 0)
+	var walk func(n formulaNode)
+	walk = func(n formulaNode) {
+		switch v := n.(type) {
+		case formulaToken:
+			r = append(r, string(v))
+		case formulaBinary:
+			walk(v.left)
+			walk(v.right)
+		case formulaNegate:
+			walk(v.node)
+		}
+	}
+	walk(f.root)
+	return r
+}
+
+// Eval computes the formula given prices keyed by upper case symbol
+func (f Formula) Eval(prices map[string]decimal.Decimal) (decimal.Decimal, error) {
+	return f.root.eval(prices)
+}
+
+func (f Formula) String() string {
+	return f.source
+}
+
+func (n formulaNumber) eval(_ map[string]decimal.Decimal) (decimal.Decimal, error) {
+	return decimal.Decimal(n), nil
+}
+
+func (n formulaToken) eval(prices map[string]decimal.Decimal) (decimal.Decimal, error) {
+	p, ok := prices[string(n)]
+	if !ok {
+		return decimal.Zero, fmt.Errorf("missing price for %s", string(n))
+	}
+	return p, nil
+}
+
+func (n formulaNegate) eval(prices map[string]decimal.Decimal) (decimal.Decimal, error) {
+	v, err := n.node.eval(prices)
+	return v.Neg(), err
+}
+
+func (n formulaBinary) eval(prices map[string]decimal.Decimal) (decimal.Decimal, error) {
+	l, err := n.left.eval(prices)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	r, err := n.right.eval(prices)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	switch n.op {
+	case '+':
+		return l.Add(r), nil
+	case '-':
+		return l.Sub(r), nil
+	case '*':
+		return l.Mul(r), nil
+	default:
+		if r.IsZero() {
+			return decimal.Zero, fmt.Errorf("division by zero")
+		}
+		return l.Div(r), nil
+	}
+}
+
+func (p *formulaParser) parseExpression() (formulaNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) || (p.input[p.pos] != '+' && p.input[p.pos] != '-') {
+			return left, nil
+		}
+		op := p.input[p.pos]
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = formulaBinary{op: op, left: left, right: right}
+	}
+}
+
+func (p *formulaParser) parseTerm() (formulaNode, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) || (p.input[p.pos] != '*' && p.input[p.pos] != '/') {
+			return left, nil
+		}
+		op := p.input[p.pos]
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = formulaBinary{op: op, left: left, right: right}
+	}
+}
+
+func (p *formulaParser) parseFactor() (formulaNode, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return nil, fmt.Errorf("unexpected end of formula")
+	}
+	c := p.input[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		node, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return nil, fmt.Errorf("missing ')' at %d", p.pos)
+		}
+		p.pos++
+		return node, nil
+	case c == '-':
+		p.pos++
+		node, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return formulaNegate{node}, nil
+	case unicode.IsDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.input) && (unicode.IsDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		v, err := decimal.NewFromString(string(p.input[start:p.pos]))
+		if err != nil {
+			return nil, err
+		}
+		return formulaNumber(v), nil
+	case unicode.IsLetter(c):
+		start := p.pos
+		for p.pos < len(p.input) && (unicode.IsLetter(p.input[p.pos]) || unicode.IsDigit(p.input[p.pos]) ||
+			p.input[p.pos] == '_') {
+			p.pos++
+		}
+		return formulaToken(strings.ToUpper(string(p.input[start:p.pos]))), nil
+	default:
+		return nil, fmt.Errorf("unexpected '%c' at %d", c, p.pos)
+	}
+}
+
+func (p *formulaParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
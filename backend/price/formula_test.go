@@ -0,0 +1,46 @@
+package price
+
+import (
+	"github.com/shopspring/decimal"
+	"testing"
+)
+
+func TestParseFormula(t *testing.T) {
+	f, err := ParseFormula("0.5 * eth + (btc - 10) / 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := f.Tokens()
+	if len(tokens) != 2 || tokens[0] != "ETH" || tokens[1] != "BTC" {
+		t.Errorf("Expected [ETH BTC] got %v", tokens)
+	}
+	v, err := f.Eval(map[string]decimal.Decimal{"ETH": decimal.NewFromInt(100), "BTC": decimal.NewFromInt(30)})
+	if err != nil {
+		t.Error(err)
+	}
+	if !v.Equal(decimal.NewFromInt(60)) {
+		t.Errorf("Expected 60 got %v", v)
+	}
+	if _, err := f.Eval(map[string]decimal.Decimal{"ETH": decimal.NewFromInt(100)}); err == nil {
+		t.Errorf("Expected error for missing BTC price")
+	}
+}
+
+func TestParseFormula_Invalid(t *testing.T) {
+	for _, source := range []string{"", "eth +", "(btc", "btc $ 2", "2 eth"} {
+		if _, err := ParseFormula(source); err == nil {
+			t.Errorf("Expected error parsing '%v'", source)
+		}
+	}
+}
+
+func TestFormula_EvalExact(t *testing.T) {
+	f, err := ParseFormula("0.1 + 0.2 * btc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := f.Eval(map[string]decimal.Decimal{"BTC": decimal.NewFromInt(1)})
+	if err != nil || v.String() != "0.3" {
+		t.Errorf("Expected 0.3 got %v %v", v, err)
+	}
+}
@@ -1,22 +1,31 @@
 package gecko
 
 import (
+	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
 	gecko "github.com/superoo7/go-gecko/v3"
 	"github.com/superoo7/go-gecko/v3/types"
 	"github.com/upper/db/v4"
 	"github.com/zooper-corp/CoinWatch/config"
 	"github.com/zooper-corp/CoinWatch/data"
 	"log"
+	"net/url"
 	"strings"
 )
 
+const apiEndpoint = "https://api.coingecko.com/api/v3"
+
+// unlistedGeckoId marks tokens that must not be looked up on CoinGecko, like fiat currencies
+const unlistedGeckoId = "none"
+
 type Provider struct {
 	client   *gecko.Client
 	builtins []config.TokenConfig
-	db       data.Db
+	db       data.Store
 }
 
-func New(builtins []config.TokenConfig, db data.Db) Provider {
+func New(builtins []config.TokenConfig, db data.Store) Provider {
 	client := gecko.NewClient(nil)
 	return Provider{
 		client:   client,
@@ -35,15 +44,18 @@ func (cg Provider) GetPrices(tokens []string, fiat string) (data.TokenPrices, er
 	if err != nil {
 		return data.TokenPrices{}, err
 	}
-	sp, err := cg.client.SimplePrice(coins.GetTokens(), vc)
+	if len(coins.Coins) == 0 {
+		return data.TokenPrices{}, nil
+	}
+	sp, err := cg.simplePrice(coins.GetTokens(), vc)
 	if err != nil {
 		return data.TokenPrices{}, err
 	}
 	log.Printf("CoinGecko prices for tokens %v -> r: %v", coins.GetTokens(), sp)
 	prices := make([]data.TokenPrice, 0)
 	for _, coin := range coins.Coins {
-		price := (*sp)[coin.CoinId][strings.ToLower(fiat)]
-		if price != 0 {
+		price := sp[coin.CoinId][strings.ToLower(fiat)]
+		if !price.IsZero() {
 			prices = append(prices, data.TokenPrice{
 				Token: coin.Symbol,
 				Price: price,
@@ -54,6 +66,22 @@ func (cg Provider) GetPrices(tokens []string, fiat string) (data.TokenPrices, er
 	return data.TokenPrices{Entries: prices}, nil
 }
 
+// simplePrice queries /simple/price keeping the exact decimals, the client one decodes them as float32
+func (cg Provider) simplePrice(ids []string, vsCurrencies []string) (map[string]map[string]decimal.Decimal, error) {
+	params := url.Values{}
+	params.Add("ids", strings.Join(ids, ","))
+	params.Add("vs_currencies", strings.Join(vsCurrencies, ","))
+	resp, err := cg.client.MakeReq(fmt.Sprintf("%s/simple/price?%s", apiEndpoint, params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[string]map[string]decimal.Decimal)
+	if err := json.Unmarshal(resp, &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
 func (cl CoinList) GetTokens() []string {
 	var r = make([]string, 0)
 	for _, c := range cl.Coins {
@@ -63,103 +91,160 @@ func (cl CoinList) GetTokens() []string {
 }
 
 func (cg Provider) getCoinList(tokens []string) (CoinList, error) {
+	resolutions, err := cg.Resolve(tokens)
+	if err != nil {
+		return CoinList{}, err
+	}
 	result := make([]Coin, 0)
-	// Check builtins
-	for _, tg := range cg.builtins {
-		// No gecko id provided
-		if strings.Trim(tg.GeckoId, " ") == "" {
-			continue
+	for _, r := range resolutions {
+		if r.Coin.CoinId != "" {
+			result = append(result, r.Coin)
 		}
-		// Check if requested
-		for i, t := range tokens {
-			if strings.EqualFold(t, tg.Symbol) {
-				result = append(result, Coin{
-					CoinId: tg.GeckoId,
-					Name:   tg.GeckoId,
-					Symbol: tg.Symbol,
-				})
-				// Delete without preserving order
-				tokens[i] = tokens[len(tokens)-1]
-				tokens = tokens[:len(tokens)-1]
-				break
-			}
+	}
+	log.Printf("CoinGecko symbols: %v", result)
+	return CoinList{Coins: result}, nil
+}
+
+// Resolve maps each token to a CoinGecko id, ambiguous symbols are resolved by market cap
+func (cg Provider) Resolve(tokens []string) ([]Resolution, error) {
+	result := make([]Resolution, 0)
+	pending := make([]string, 0)
+	for _, t := range tokens {
+		if r, ok := cg.resolveBuiltin(t); ok {
+			result = append(result, r)
+		} else {
+			pending = append(pending, t)
 		}
 	}
 	// No token left
-	if len(tokens) == 0 {
-		return CoinList{Coins: result}, nil
+	if len(pending) == 0 {
+		return result, nil
 	}
 	// Check DB now
 	sess, err := cg.db.GetSession()
 	if err != nil {
-		return CoinList{}, err
+		return nil, err
 	}
 	defer func(sess db.Session) {
 		_ = sess.Close()
 	}(sess)
-	collection := sess.Collection("gecko_coins")
-	// Update collection if needed
-	exists, _ := collection.Exists()
-	if !exists {
-		log.Printf("Create gecko coin map cache table")
-		_, err = sess.SQL().Exec(`
-        CREATE TABLE gecko_coins (
-            symbol TEXT,
-			name TEXT,
-			coin_id TEXT
-        )`)
-		if err != nil {
-			log.Fatalf("Unable to create coins gecko cache table")
-			return CoinList{}, err
-		}
-	}
+	collection := sess.Collection(symbolsCollection)
 	// Look for coins
 	var coinList types.CoinList
-	for _, token := range tokens {
-		r := collection.Find("symbol", strings.ToLower(token))
-		exists, err = r.Exists()
-		if err != nil || !exists {
-			if coinList == nil {
-				log.Printf("Fetching symbols: %v\n", tokens)
-				list, err := cg.client.CoinsList()
-				if err != nil {
-					log.Fatalf("Unable to load data from coin gecko")
-					return CoinList{}, err
-				}
-				coinList = *list
-			}
-			found := false
-			for _, c := range coinList {
-				if strings.EqualFold(c.Symbol, token) {
-					found = true
-					coin := Coin{
-						CoinId: c.ID,
-						Name:   c.Name,
-						Symbol: c.Symbol,
-					}
-					_, err := collection.Insert(coin)
-					if err != nil {
-						log.Fatalf("Unable to insert coin %v", c)
-						return CoinList{}, err
-					}
-					result = append(result, coin)
-					break
-				}
-			}
-			if !found {
-				log.Fatalf("Unable to find token %v on coin gecko", token)
-				return CoinList{}, err
+	for _, token := range pending {
+		var cached []cachedSymbol
+		err := collection.Find(db.Cond{"symbol": strings.ToLower(token)}).All(&cached)
+		if err == nil && len(cached) > 0 && !cached[0].expired() {
+			result = append(result, cached[0].resolution(token))
+			continue
+		}
+		// Load full list once
+		if coinList == nil {
+			log.Printf("Fetching symbols: %v\n", pending)
+			list, err := cg.client.CoinsList()
+			if err != nil {
+				log.Printf("Unable to load coin list from coin gecko: %v", err)
+				return nil, err
 			}
+			coinList = *list
 		}
-		// Coin is present in DB
-		var coin Coin
-		err = r.One(&coin)
+		// Unknown and ambiguous symbols are cached for a shorter time, unless market data could not be fetched
+		r, err := cg.resolveFromList(token, coinList)
 		if err != nil {
-			return CoinList{}, err
+			result = append(result, r)
+			continue
 		}
-		result = append(result, coin)
+		if err := collection.Find(db.Cond{"symbol": strings.ToLower(token)}).Delete(); err != nil {
+			log.Printf("Unable to clear cached symbol %v: %v", token, err)
+		}
+		if _, err := collection.Insert(newCachedSymbol(r)); err != nil {
+			log.Printf("Unable to cache symbol %v: %v", token, err)
+		}
+		result = append(result, r)
 	}
 	// All good
-	log.Printf("CoinGecko symbols: %v", result)
-	return CoinList{Coins: result}, nil
+	return result, nil
+}
+
+func (cg Provider) resolveBuiltin(token string) (Resolution, bool) {
+	for _, tg := range cg.builtins {
+		// No gecko id provided
+		if strings.Trim(tg.GeckoId, " ") == "" || !strings.EqualFold(token, tg.Symbol) {
+			continue
+		}
+		// Token is known not to be listed, leave it to other sources
+		if strings.EqualFold(tg.GeckoId, unlistedGeckoId) {
+			return Resolution{Symbol: token, Source: SourceUnlisted}, true
+		}
+		return Resolution{
+			Symbol: token,
+			Coin: Coin{
+				CoinId: tg.GeckoId,
+				Name:   tg.GeckoId,
+				Symbol: tg.Symbol,
+			},
+			Source: SourceConfig,
+		}, true
+	}
+	return Resolution{}, false
+}
+
+// resolveFromList picks the coin of token, the error is set when market data of ambiguous symbols failed to load
+func (cg Provider) resolveFromList(token string, coinList types.CoinList) (Resolution, error) {
+	candidates := make([]Coin, 0)
+	for _, c := range coinList {
+		if strings.EqualFold(c.Symbol, token) {
+			candidates = append(candidates, Coin{
+				CoinId: c.ID,
+				Name:   c.Name,
+				Symbol: c.Symbol,
+			})
+		}
+	}
+	r := Resolution{Symbol: token, Candidates: candidates}
+	switch len(candidates) {
+	case 0:
+		log.Printf("Unable to find token %v on coin gecko", token)
+		r.Source = SourceUnknown
+	case 1:
+		r.Coin = candidates[0]
+		r.Source = SourceUnique
+	default:
+		coin, found, err := cg.pickByMarketCap(candidates)
+		if err != nil || !found {
+			log.Printf("Token %v is ambiguous on coin gecko, set its geckoid in config: %v", token, err)
+			r.Source = SourceAmbiguous
+			return r, err
+		}
+		log.Printf("Token %v is ambiguous on coin gecko, picked %v by market cap", token, coin.CoinId)
+		r.Coin = coin
+		r.Source = SourceMarketCap
+	}
+	return r, nil
+}
+
+// pickByMarketCap returns the candidate with the largest market cap, found is false when none has market data
+func (cg Provider) pickByMarketCap(candidates []Coin) (Coin, bool, error) {
+	ids := make([]string, 0)
+	for _, c := range candidates {
+		ids = append(ids, c.CoinId)
+	}
+	market, err := cg.client.CoinsMarket("usd", ids, types.OrderTypeObject.MarketCapDesc, 250, 1, false, nil)
+	if err != nil {
+		return Coin{}, false, err
+	}
+	best := ""
+	bestCap := 0.0
+	for _, m := range *market {
+		if m.MarketCap > bestCap {
+			best = m.ID
+			bestCap = m.MarketCap
+		}
+	}
+	for _, c := range candidates {
+		if c.CoinId == best {
+			return c, true, nil
+		}
+	}
+	return Coin{}, false, nil
 }
@@ -19,12 +19,12 @@ func TestProvider_GetPrices(t *testing.T) {
 		t.Error(err)
 	}
 	for _, p := range ps.Entries {
-		if p.Price == 0.0 {
+		if p.Price.IsZero() {
 			t.Errorf("Price is zero for %v", p)
 		}
 	}
 	kp := ps.GetPrice("KSM")
-	if kp == 0.0 {
+	if kp.IsZero() {
 		t.Errorf("Price is zero for GetPrice(KSM)")
 	}
 	_ = os.Remove(data.GetTestDbPath())
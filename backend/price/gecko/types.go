@@ -1,5 +1,27 @@
 package gecko
 
+import (
+	"strings"
+	"time"
+)
+
+const (
+	symbolsCollection = "gecko_symbols"
+	symbolsTtl        = time.Hour * 24 * 30
+	// Unknown and ambiguous symbols may get listed or resolved soon
+	unresolvedTtl = time.Hour * 6
+)
+
+// Sources describing how a symbol was resolved
+const (
+	SourceConfig    = "config"
+	SourceUnique    = "unique"
+	SourceMarketCap = "market_cap"
+	SourceAmbiguous = "ambiguous"
+	SourceUnknown   = "unknown"
+	SourceUnlisted  = "unlisted"
+)
+
 type Coin struct {
 	Symbol string `db:"symbol"`
 	CoinId string `db:"coin_id"`
@@ -9,3 +31,68 @@ type Coin struct {
 type CoinList struct {
 	Coins []Coin
 }
+
+// Resolution describes how a token symbol was mapped to a CoinGecko coin
+type Resolution struct {
+	Symbol     string
+	Coin       Coin
+	Candidates []Coin
+	Source     string
+}
+
+type cachedSymbol struct {
+	Symbol     string    `db:"symbol"`
+	CoinId     string    `db:"coin_id"`
+	Name       string    `db:"name"`
+	Candidates string    `db:"candidates"`
+	Source     string    `db:"source"`
+	Updated    time.Time `db:"updated"`
+}
+
+// Ambiguous is true if more than one coin shares the symbol
+func (r Resolution) Ambiguous() bool {
+	return len(r.Candidates) > 1
+}
+
+func newCachedSymbol(r Resolution) cachedSymbol {
+	ids := make([]string, 0)
+	for _, c := range r.Candidates {
+		ids = append(ids, c.CoinId)
+	}
+	return cachedSymbol{
+		Symbol:     strings.ToLower(r.Symbol),
+		CoinId:     r.Coin.CoinId,
+		Name:       r.Coin.Name,
+		Candidates: strings.Join(ids, ","),
+		Source:     r.Source,
+		Updated:    time.Now(),
+	}
+}
+
+// expired is true once the cached resolution must be looked up again
+func (cs cachedSymbol) expired() bool {
+	ttl := symbolsTtl
+	if cs.CoinId == "" {
+		ttl = unresolvedTtl
+	}
+	return time.Since(cs.Updated) >= ttl
+}
+
+func (cs cachedSymbol) resolution(token string) Resolution {
+	candidates := make([]Coin, 0)
+	for _, id := range strings.Split(cs.Candidates, ",") {
+		if id != "" {
+			candidates = append(candidates, Coin{CoinId: id, Symbol: cs.Symbol})
+		}
+	}
+	return Resolution{
+		Symbol: token,
+		Coin: Coin{
+			Symbol: cs.Symbol,
+			CoinId: cs.CoinId,
+			Name:   cs.Name,
+		},
+		Candidates: candidates,
+		Source:     cs.Source,
+	}
+}
@@ -0,0 +1,212 @@
+package kraken
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/upper/db/v4"
+	"github.com/zooper-corp/CoinWatch/data"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiAssets        = "Assets"
+	apiAssetPairs    = "AssetPairs"
+	assetsCollection = "kraken_assets"
+	pairsCollection  = "kraken_pairs"
+	assetsTtl        = time.Hour * 24
+)
+
+// assetAliases maps Kraken specific alt names to the symbol used everywhere else
+var assetAliases = map[string]string{
+	"XBT":  "BTC",
+	"XDG":  "DOGE",
+	"ETH2": "ETH",
+}
+
+// unknownAssets holds asset names already logged as unknown, assets are loaded again for every lookup
+var unknownAssets sync.Map
+
+type Asset struct {
+	Name    string    `db:"name"`
+	AltName string    `db:"alt_name"`
+	Updated time.Time `db:"updated"`
+}
+
+type AssetPair struct {
+	Name    string    `db:"name"`
+	AltName string    `db:"alt_name"`
+	Base    string    `db:"base"`
+	Quote   string    `db:"quote"`
+	Updated time.Time `db:"updated"`
+}
+
+// Assets resolves Kraken asset and pair names to plain symbols, pairs are keyed by base and quote symbols
+type Assets struct {
+	assets map[string]Asset
+	pairs  map[string]AssetPair
+}
+
+// NewAssets creates a resolver from a known set of assets and pairs
+func NewAssets(assets []Asset, pairs []AssetPair) Assets {
+	a := Assets{
+		assets: make(map[string]Asset, len(assets)),
+		pairs:  make(map[string]AssetPair, len(pairs)),
+	}
+	for _, asset := range assets {
+		a.assets[strings.ToUpper(asset.Name)] = asset
+	}
+	for _, p := range pairs {
+		// Skip dark pool pairs
+		if strings.HasSuffix(p.Name, ".d") {
+			continue
+		}
+		base, _ := a.symbol(p.Base)
+		quote, _ := a.symbol(p.Quote)
+		if _, ok := a.pairs[pairKey(base, quote)]; !ok {
+			a.pairs[pairKey(base, quote)] = p
+		}
+	}
+	return a
+}
+
+// LoadAssets returns Kraken assets and pairs from the DB cache, refreshing them from the API when expired
+func LoadAssets(d data.Store, httpClient *http.Client) (Assets, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return Assets{}, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	// Check cache
+	var assets []Asset
+	var pairs []AssetPair
+	if err := sess.Collection(assetsCollection).Find().All(&assets); err != nil {
+		return Assets{}, err
+	}
+	if err := sess.Collection(pairsCollection).Find().All(&pairs); err != nil {
+		return Assets{}, err
+	}
+	if len(assets) > 0 && len(pairs) > 0 && time.Since(assets[0].Updated) < assetsTtl {
+		return NewAssets(assets, pairs), nil
+	}
+	// Refresh
+	p := New(nil, d, httpClient)
+	freshAssets, freshPairs, err := p.fetchAssets()
+	if err != nil {
+		if len(assets) > 0 && len(pairs) > 0 {
+			log.Printf("Unable to refresh kraken assets, using cached ones: %v", err)
+			return NewAssets(assets, pairs), nil
+		}
+		return Assets{}, err
+	}
+	err = sess.Tx(func(tx db.Session) error {
+		if err := tx.Collection(assetsCollection).Truncate(); err != nil {
+			return err
+		}
+		if err := tx.Collection(pairsCollection).Truncate(); err != nil {
+			return err
+		}
+		for _, a := range freshAssets {
+			if _, err := tx.Collection(assetsCollection).Insert(a); err != nil {
+				return err
+			}
+		}
+		for _, ap := range freshPairs {
+			if _, err := tx.Collection(pairsCollection).Insert(ap); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Unable to cache kraken assets: %v", err)
+	}
+	return NewAssets(freshAssets, freshPairs), nil
+}
+
+// Symbol returns the plain symbol for a Kraken asset name like XXBT or DOT.S, the modifier is dropped. Unknown
+// assets are logged once
+func (a Assets) Symbol(name string) string {
+	symbol, known := a.symbol(name)
+	if !known {
+		if _, logged := unknownAssets.LoadOrStore(strings.ToUpper(name), true); !logged {
+			log.Printf("Unknown kraken asset %v", name)
+		}
+	}
+	return symbol
+}
+
+// symbol is Symbol without logging, known is false when the asset is not listed
+func (a Assets) symbol(name string) (string, bool) {
+	base := strings.ToUpper(strings.Split(name, ".")[0])
+	altName := base
+	asset, known := a.assets[base]
+	if known {
+		altName = strings.ToUpper(asset.AltName)
+	}
+	if alias, ok := assetAliases[altName]; ok {
+		return alias, known
+	}
+	return altName, known
+}
+
+// Pair returns the pair trading token against fiat
+func (a Assets) Pair(token string, fiat string) (AssetPair, bool) {
+	p, ok := a.pairs[pairKey(token, fiat)]
+	return p, ok
+}
+
+func pairKey(base string, quote string) string {
+	return strings.ToUpper(base) + "/" + strings.ToUpper(quote)
+}
+
+func (p Provider) fetchAssets() ([]Asset, []AssetPair, error) {
+	now := time.Now()
+	d, err := p.call(apiAssets, "", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var au assetsUnmarshal
+	if err := json.Unmarshal(d, &au); err != nil {
+		return nil, nil, err
+	}
+	if len(au.Error) > 0 {
+		return nil, nil, fmt.Errorf("kraken API call failed: %v", au.Error[0])
+	}
+	assets := make([]Asset, 0)
+	for name, v := range au.Result {
+		assets = append(assets, Asset{
+			Name:    name,
+			AltName: v.AltName,
+			Updated: now,
+		})
+	}
+	d, err = p.call(apiAssetPairs, "", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var pu assetPairsUnmarshal
+	if err := json.Unmarshal(d, &pu); err != nil {
+		return nil, nil, err
+	}
+	if len(pu.Error) > 0 {
+		return nil, nil, fmt.Errorf("kraken API call failed: %v", pu.Error[0])
+	}
+	pairs := make([]AssetPair, 0)
+	for name, v := range pu.Result {
+		pairs = append(pairs, AssetPair{
+			Name:    name,
+			AltName: v.AltName,
+			Base:    v.Base,
+			Quote:   v.Quote,
+			Updated: now,
+		})
+	}
+	log.Printf("Kraken loaded %d assets and %d pairs", len(assets), len(pairs))
+	return assets, pairs, nil
+}
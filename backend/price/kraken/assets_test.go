@@ -0,0 +1,88 @@
+package kraken
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func getTestAssets() Assets {
+	return NewAssets([]Asset{
+		{Name: "XXBT", AltName: "XBT"},
+		{Name: "XXDG", AltName: "XDG"},
+		{Name: "ZEUR", AltName: "EUR"},
+		{Name: "DOT", AltName: "DOT"},
+		{Name: "DOT.S", AltName: "DOT.S"},
+		{Name: "ETH2.S", AltName: "ETH2.S"},
+		{Name: "ETH2", AltName: "ETH2"},
+		{Name: "XETH", AltName: "ETH"},
+	}, []AssetPair{
+		{Name: "XXBTZEUR", AltName: "XBTEUR", Base: "XXBT", Quote: "ZEUR"},
+		{Name: "XXBTZEUR.d", AltName: "XBTEUR.d", Base: "XXBT", Quote: "ZEUR"},
+		{Name: "XDGEUR", AltName: "XDGEUR", Base: "XXDG", Quote: "ZEUR"},
+		{Name: "DOTEUR", AltName: "DOTEUR", Base: "DOT", Quote: "ZEUR"},
+		{Name: "XETHZEUR", AltName: "ETHEUR", Base: "XETH", Quote: "ZEUR"},
+	})
+}
+
+func TestAssets_Symbol(t *testing.T) {
+	a := getTestAssets()
+	cases := map[string]string{
+		"XXBT":   "BTC",
+		"XXDG":   "DOGE",
+		"ZEUR":   "EUR",
+		"DOT.S":  "DOT",
+		"ETH2.S": "ETH",
+		"XETH":   "ETH",
+	}
+	for name, expected := range cases {
+		if s := a.Symbol(name); s != expected {
+			t.Errorf("Expected '%v' for '%v' got '%v'", expected, name, s)
+		}
+	}
+}
+
+func TestAssets_Pair(t *testing.T) {
+	a := getTestAssets()
+	cases := map[string]string{
+		"btc":  "XXBTZEUR",
+		"doge": "XDGEUR",
+		"dot":  "DOTEUR",
+		"eth":  "XETHZEUR",
+	}
+	for token, expected := range cases {
+		p, ok := a.Pair(token, "eur")
+		if !ok || p.Name != expected {
+			t.Errorf("Expected pair '%v' for '%v' got '%v'", expected, token, p.Name)
+		}
+	}
+	// Symbols containing other symbols must not match
+	if p, ok := a.Pair("t", "eur"); ok {
+		t.Errorf("Unexpected pair '%v' for 't'", p.Name)
+	}
+	if _, ok := a.Pair("btc", "usd"); ok {
+		t.Errorf("Unexpected pair for 'btc/usd'")
+	}
+}
+
+func TestAssets_LogUnknownOnce(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	a := NewAssets([]Asset{{Name: "ZEUR", AltName: "EUR"}}, []AssetPair{
+		{Name: "NEWEUR", AltName: "NEWEUR", Base: "NEW", Quote: "ZEUR"},
+	})
+	if p, ok := a.Pair("new", "eur"); !ok || p.Name != "NEWEUR" {
+		t.Errorf("Expected pair of unknown asset got %v", p)
+	}
+	for i := 0; i < 3; i++ {
+		if s := a.Symbol("OTHER"); s != "OTHER" {
+			t.Errorf("Expected unknown asset name got %v", s)
+		}
+	}
+	if n := strings.Count(buf.String(), "Unknown kraken asset"); n != 1 {
+		t.Errorf("Expected one unknown asset log got %d: %v", n, buf.String())
+	}
+}
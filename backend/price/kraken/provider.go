@@ -5,12 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/scylladb/go-set"
+	"github.com/shopspring/decimal"
 	"github.com/zooper-corp/CoinWatch/config"
 	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/tools"
 	"log"
 	"net/http"
-	"strconv"
 	"strings"
 )
 
@@ -22,12 +22,17 @@ const (
 type Provider struct {
 	httpClient *http.Client
 	builtins   []config.TokenConfig
+	db         data.Store
 }
 
-func New(builtins []config.TokenConfig, httpClient *http.Client) Provider {
+func New(builtins []config.TokenConfig, db data.Store, httpClient *http.Client) Provider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
 	return Provider{
 		httpClient: httpClient,
 		builtins:   builtins,
+		db:         db,
 	}
 }
 
@@ -37,64 +42,71 @@ func (p Provider) Name() string {
 
 func (p Provider) GetPrices(tokens []string, fiat string) (data.TokenPrices, error) {
 	r := make([]data.TokenPrice, 0)
+	assets, err := LoadAssets(p.db, p.httpClient)
+	if err != nil {
+		return data.TokenPrices{}, err
+	}
+	// Resolve pairs, tokens not traded against fiat are skipped
 	seen := set.NewStringSet()
-	pairs := make([]string, 0)
+	pairs := make(map[string]string)
 	for _, token := range tokens {
 		if seen.Has(strings.ToUpper(token)) {
 			continue
 		}
 		seen.Add(strings.ToUpper(token))
-		pairs = append(pairs, fmt.Sprintf("%s%s", strings.ToUpper(token), strings.ToUpper(fiat)))
-	}
-	pairParam := strings.Join(pairs, ",")
-	log.Printf("Kraken query prices for: %v", pairParam)
-	// Query
-	d, err := p.call(apiTicker, fmt.Sprintf("pair=%s", pairParam), nil)
-	if err != nil {
-		return data.TokenPrices{}, err
-	}
-	var ticker tickerUnmarshal
-	err = json.Unmarshal(d, &ticker)
-	if err != nil {
-		log.Printf("Unable to unmarshal kraken data: %v\n", err)
-		return data.TokenPrices{}, err
+		if pair, ok := assets.Pair(token, fiat); ok {
+			pairs[pair.Name] = token
+		} else if !strings.EqualFold(token, fiat) {
+			log.Printf("Kraken has no %s/%s pair", strings.ToUpper(token), strings.ToUpper(fiat))
+		}
 	}
-	for pair, value := range ticker.Result {
-		token := ""
-		for _, t := range tokens {
-			// BTC special name
-			if strings.EqualFold(t, "BTC") && strings.Contains(pair, "XXBT") {
-				token = t
-				break
-			}
-			// Others
-			if strings.Contains(pair, strings.ToUpper(t)) {
-				token = t
-				break
-			}
+	if len(pairs) > 0 {
+		names := make([]string, 0)
+		for name := range pairs {
+			names = append(names, name)
 		}
-		if token == "" {
-			continue
+		pairParam := strings.Join(names, ",")
+		log.Printf("Kraken query prices for: %v", pairParam)
+		// Query
+		d, err := p.call(apiTicker, fmt.Sprintf("pair=%s", pairParam), nil)
+		if err != nil {
+			return data.TokenPrices{}, err
 		}
-		price, err := strconv.ParseFloat(value.B[0], 32)
+		var ticker tickerUnmarshal
+		err = json.Unmarshal(d, &ticker)
 		if err != nil {
-			log.Printf("Unable to decode price from result: %v\n", err)
+			log.Printf("Unable to unmarshal kraken data: %v\n", err)
 			return data.TokenPrices{}, err
 		}
-		log.Printf("Kraken got price for %s => %v", pair, price)
-		seen.Remove(strings.ToUpper(token))
-		r = append(r, data.TokenPrice{
-			Token: token,
-			Price: float32(price),
-			Fiat:  fiat,
-		})
+		if len(ticker.Error) > 0 {
+			return data.TokenPrices{}, fmt.Errorf("kraken API call failed: %v", ticker.Error[0])
+		}
+		for pair, value := range ticker.Result {
+			token, ok := pairs[pair]
+			if !ok {
+				log.Printf("Kraken returned unexpected pair %s", pair)
+				continue
+			}
+			price, err := decimal.NewFromString(value.B[0])
+			if err != nil {
+				log.Printf("Unable to decode price from result: %v\n", err)
+				return data.TokenPrices{}, err
+			}
+			log.Printf("Kraken got price for %s => %v", pair, price)
+			seen.Remove(strings.ToUpper(token))
+			r = append(r, data.TokenPrice{
+				Token: token,
+				Price: price,
+				Fiat:  fiat,
+			})
+		}
 	}
 	// Check fiat to fiat
 	if seen.Has(strings.ToUpper(fiat)) {
 		seen.Remove(strings.ToUpper(fiat))
 		r = append(r, data.TokenPrice{
 			Token: fiat,
-			Price: 1.0,
+			Price: decimal.NewFromInt(1),
 			Fiat:  fiat,
 		})
 	}
@@ -13,18 +13,18 @@ func TestProvider_GetPrices(t *testing.T) {
 		Symbol:   "ksm",
 		GeckoId:  "kusama",
 		Contract: "kusama",
-	}}, http.DefaultClient)
+	}}, data.GetTestDb(), http.DefaultClient)
 	ps, err := provider.GetPrices([]string{"ksm"}, "usd")
 	if err != nil {
 		t.Error(err)
 	}
 	for _, p := range ps.Entries {
-		if p.Price == 0.0 {
+		if p.Price.IsZero() {
 			t.Errorf("Price is zero for %v", p)
 		}
 	}
 	kp := ps.GetPrice("KSM")
-	if kp == 0.0 {
+	if kp.IsZero() {
 		t.Errorf("Price is zero for GetPrice(KSM)")
 	}
 	_ = os.Remove(data.GetTestDbPath())
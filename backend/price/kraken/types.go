@@ -16,3 +16,25 @@ type resultUnmarshal struct {
 	H []string `json:"h"`
 	O string   `json:"o"`
 }
+
+type assetsUnmarshal struct {
+	Error  []string                        `json:"error"`
+	Result map[string]assetResultUnmarshal `json:"result"`
+}
+
+type assetResultUnmarshal struct {
+	AltName  string `json:"altname"`
+	Decimals int    `json:"decimals"`
+}
+
+type assetPairsUnmarshal struct {
+	Error  []string                            `json:"error"`
+	Result map[string]assetPairResultUnmarshal `json:"result"`
+}
+
+type assetPairResultUnmarshal struct {
+	AltName string `json:"altname"`
+	WsName  string `json:"wsname"`
+	Base    string `json:"base"`
+	Quote   string `json:"quote"`
+}
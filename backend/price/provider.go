@@ -8,8 +8,8 @@ import (
 	"github.com/zooper-corp/CoinWatch/config"
 	"github.com/zooper-corp/CoinWatch/data"
 	"log"
-	"net/http"
 	"strings"
+	"time"
 )
 
 type Provider interface {
@@ -19,6 +19,8 @@ type Provider interface {
 
 type MultiSourceProvider struct {
 	providers []Provider
+	db        data.Store
+	maxAge    time.Duration
 }
 
 func (p MultiSourceProvider) Name() string {
@@ -45,14 +47,41 @@ func (p MultiSourceProvider) GetPrices(tokens []string, fiat string) (data.Token
 			}
 		}
 	}
+	now := time.Now()
+	for i := range result.Entries {
+		if result.Entries[i].Timestamp.IsZero() {
+			result.Entries[i].Timestamp = now
+		}
+	}
+	// Fallback to stored prices
+	for _, token := range missing.List() {
+		sp, found, err := p.db.GetLastPrice(token, fiat, p.maxAge)
+		if err != nil {
+			log.Printf("Unable to load stored price for %v: %v\n", token, err)
+			continue
+		}
+		if found {
+			log.Printf("Using stale price for %v from %v", token, sp.Timestamp)
+			missing.Remove(token)
+			sp.Token = token
+			sp.Stale = true
+			result.Entries = append(result.Entries, sp)
+		}
+	}
 	if missing.Size() > 0 {
 		return result, fmt.Errorf("unable to load prices for %v", missing.List())
 	}
 	return result, nil
 }
 
-func New(builtins []config.TokenConfig, db data.Db, httpClient *http.Client) Provider {
-	cg := gecko.New(builtins, db)
-	k := kraken.New(builtins, httpClient)
-	return MultiSourceProvider{[]Provider{cg, k}}
+// New returns the default price provider, market sources with configured pricing rules on top
+func New(cfg *config.Config, db data.Store) Provider {
+	cg := gecko.New(cfg.GetTokenConfigs(), db)
+	k := kraken.New(cfg.GetTokenConfigs(), db, cfg.GetHttpClient())
+	market := MultiSourceProvider{
+		providers: []Provider{cg, k},
+		db:        db,
+		maxAge:    cfg.GetPriceMaxAge(),
+	}
+	return NewRulesProvider(cfg.GetPricingRules(), market)
 }
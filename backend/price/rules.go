@@ -0,0 +1,162 @@
+package price
+
+import (
+	"fmt"
+	"github.com/scylladb/go-set"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/config"
+	"github.com/zooper-corp/CoinWatch/data"
+	"log"
+	"strings"
+	"time"
+)
+
+// RulesProvider applies configured pricing rules on top of a market price source
+type RulesProvider struct {
+	rules  map[string]config.PricingRule
+	source Provider
+}
+
+func NewRulesProvider(rules []config.PricingRule, source Provider) RulesProvider {
+	rm := make(map[string]config.PricingRule, len(rules))
+	for _, r := range rules {
+		rm[strings.ToUpper(r.Symbol)] = r
+	}
+	return RulesProvider{
+		rules:  rm,
+		source: source,
+	}
+}
+
+func (p RulesProvider) Name() string {
+	return "Rules"
+}
+
+func (p RulesProvider) GetPrices(tokens []string, fiat string) (data.TokenPrices, error) {
+	// Split tokens between rules and market, dependencies of rules go to market as well
+	market := set.NewStringSet()
+	ruled := make([]string, 0)
+	visited := set.NewStringSet()
+	var visit func(token string) error
+	visit = func(token string) error {
+		token = strings.ToUpper(token)
+		if visited.Has(token) {
+			return nil
+		}
+		visited.Add(token)
+		rule, ok := p.rules[token]
+		if !ok {
+			market.Add(token)
+			return nil
+		}
+		deps, err := ruleDependencies(rule)
+		if err != nil {
+			return err
+		}
+		for _, d := range deps {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		ruled = append(ruled, token)
+		return nil
+	}
+	for _, t := range tokens {
+		if err := visit(t); err != nil {
+			return data.TokenPrices{}, err
+		}
+	}
+	// Fetch market prices
+	prices := make(map[string]data.TokenPrice)
+	var sourceErr error
+	if market.Size() > 0 {
+		tp, err := p.source.GetPrices(market.List(), fiat)
+		if err != nil {
+			sourceErr = err
+		}
+		for _, e := range tp.Entries {
+			prices[strings.ToUpper(e.Token)] = e
+		}
+	}
+	// Evaluate rules, dependencies come first in ruled
+	now := time.Now()
+	failed := make([]string, 0)
+	for _, token := range ruled {
+		price, stale, err := p.evalRule(p.rules[token], prices)
+		if err != nil {
+			log.Printf("Unable to apply pricing rule for %v: %v", token, err)
+			failed = append(failed, token)
+			continue
+		}
+		prices[token] = data.TokenPrice{
+			Timestamp: now,
+			Token:     token,
+			Price:     price,
+			Fiat:      fiat,
+			Stale:     stale,
+		}
+	}
+	// Return only requested tokens
+	result := data.TokenPrices{}
+	for _, t := range tokens {
+		if tp, ok := prices[strings.ToUpper(t)]; ok {
+			tp.Token = t
+			result.Entries = append(result.Entries, tp)
+		}
+	}
+	switch {
+	case len(failed) > 0 && sourceErr != nil:
+		return result, fmt.Errorf("%v, pricing rules failed for %v", sourceErr, failed)
+	case len(failed) > 0:
+		return result, fmt.Errorf("pricing rules failed for %v", failed)
+	default:
+		return result, sourceErr
+	}
+}
+
+func (p RulesProvider) evalRule(rule config.PricingRule, prices map[string]data.TokenPrice) (decimal.Decimal, bool, error) {
+	switch {
+	case rule.Peg != "":
+		tp, ok := prices[strings.ToUpper(rule.Peg)]
+		if !ok {
+			return decimal.Zero, false, fmt.Errorf("missing price for %v", rule.Peg)
+		}
+		ratio := rule.Ratio
+		if ratio.IsZero() {
+			ratio = decimal.NewFromInt(1)
+		}
+		return tp.Price.Mul(ratio), tp.Stale, nil
+	case rule.Formula != "":
+		f, err := ParseFormula(rule.Formula)
+		if err != nil {
+			return decimal.Zero, false, err
+		}
+		values := make(map[string]decimal.Decimal)
+		stale := false
+		for _, t := range f.Tokens() {
+			if tp, ok := prices[t]; ok {
+				values[t] = tp.Price
+				stale = stale || tp.Stale
+			}
+		}
+		v, err := f.Eval(values)
+		return v, stale, err
+	default:
+		return rule.Price, false, nil
+	}
+}
+
+func ruleDependencies(rule config.PricingRule) ([]string, error) {
+	switch {
+	case rule.Peg != "":
+		return []string{rule.Peg}, nil
+	case rule.Formula != "":
+		f, err := ParseFormula(rule.Formula)
+		if err != nil {
+			return nil, fmt.Errorf("invalid formula for %v: %v", rule.Symbol, err)
+		}
+		return f.Tokens(), nil
+	default:
+		return nil, nil
+	}
+}
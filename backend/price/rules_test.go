@@ -0,0 +1,63 @@
+package price
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/config"
+	"github.com/zooper-corp/CoinWatch/data"
+	"strings"
+	"testing"
+)
+
+type staticProvider struct {
+	prices map[string]float64
+}
+
+func (p staticProvider) Name() string {
+	return "Static"
+}
+
+func (p staticProvider) GetPrices(tokens []string, fiat string) (data.TokenPrices, error) {
+	r := data.TokenPrices{}
+	for _, t := range tokens {
+		if v, ok := p.prices[strings.ToUpper(t)]; ok {
+			r.Entries = append(r.Entries, data.TokenPrice{Token: t, Price: decimal.NewFromFloat(v), Fiat: fiat})
+		}
+	}
+	return r, nil
+}
+
+func TestRulesProvider_GetPrices(t *testing.T) {
+	p := NewRulesProvider([]config.PricingRule{
+		{Symbol: "usdc", Price: decimal.NewFromInt(1)},
+		{Symbol: "wbtc", Peg: "btc"},
+		{Symbol: "stdot", Peg: "dot", Ratio: decimal.RequireFromString("1.5")},
+		{Symbol: "lp", Formula: "0.5 * wbtc + 0.5 * eth"},
+	}, staticProvider{map[string]float64{"BTC": 100, "DOT": 10, "ETH": 50}})
+	ps, err := p.GetPrices([]string{"usdc", "wbtc", "stdot", "lp", "dot"}, "eur")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int64{"usdc": 1, "wbtc": 100, "stdot": 15, "lp": 75, "dot": 10}
+	for token, price := range expected {
+		if v := ps.GetPrice(token); !v.Equal(decimal.NewFromInt(price)) {
+			t.Errorf("Expected %v for %v got %v", price, token, v)
+		}
+	}
+	// Dependencies are not returned
+	if _, ok := ps.Get("eth"); ok {
+		t.Errorf("Unexpected price for eth")
+	}
+}
+
+func TestRulesProvider_MissingDependency(t *testing.T) {
+	p := NewRulesProvider([]config.PricingRule{
+		{Symbol: "wbtc", Peg: "btc"},
+	}, staticProvider{map[string]float64{"DOT": 10}})
+	ps, err := p.GetPrices([]string{"wbtc", "dot"}, "eur")
+	if err == nil {
+		t.Errorf("Expected error for missing btc")
+	}
+	if !ps.GetPrice("dot").Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Expected partial result with dot")
+	}
+}
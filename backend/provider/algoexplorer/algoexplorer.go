@@ -3,6 +3,7 @@ package algoexplorer
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/shopspring/decimal"
 	"github.com/zooper-corp/CoinWatch/config"
 	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/tools"
@@ -56,8 +57,8 @@ func (p Provider) GetBalance(address string, symbol string) (data.TokenBalance,
 		Wallet:  p.wallet.Name,
 		Symbol:  symbol,
 		Address: account.Account.Address,
-		Balance: float64(account.Account.Amount) / 1000000.0,
-		Locked:  0,
+		Balance: decimal.New(account.Account.Amount, -6),
+		Locked:  decimal.Zero,
 	}, nil
 }
 
@@ -3,11 +3,11 @@ package blockcypher
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/shopspring/decimal"
 	"github.com/zooper-corp/CoinWatch/config"
 	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/tools"
 	"log"
-	"math"
 	"net/http"
 	"strings"
 )
@@ -61,8 +61,8 @@ func (p Provider) GetBalance(address string, symbol string) (data.TokenBalance,
 		Wallet:  p.wallet.Name,
 		Symbol:  symbol,
 		Address: account.Address,
-		Balance: float64(account.FinalBalance) / math.Pow10(decimals),
-		Locked:  0,
+		Balance: decimal.New(int64(account.FinalBalance), int32(-decimals)),
+		Locked:  decimal.Zero,
 	}, nil
 }
 
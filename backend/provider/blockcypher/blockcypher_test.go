@@ -13,7 +13,7 @@ func TestProvider_GetBalance(t *testing.T) {
 		t.Error(err)
 	}
 	r := b[0]
-	if r.Balance == 0 && r.Balance < 1 {
+	if r.Balance.IsZero() {
 		t.Error("Expected >0 got 0")
 	}
 }
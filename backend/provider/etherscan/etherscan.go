@@ -0,0 +1,186 @@
+package etherscan
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/config"
+	"github.com/zooper-corp/CoinWatch/data"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiEndpoint = "https://api.etherscan.io/api?%v"
+	ethDecimals = 18
+	// Etherscan returns at most 10000 transactions per query whatever the page
+	pageSize = 1000
+	maxPages = 10
+)
+
+// Provider reads ETH balances and transactions of the wallet addresses, tokens must be eth
+type Provider struct {
+	wallet     *config.Wallet
+	httpClient *http.Client
+}
+
+func New(wallet *config.Wallet, httpClient *http.Client) (Provider, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	for _, f := range wallet.Filters {
+		if !strings.EqualFold(f.Symbol, "eth") {
+			return Provider{}, fmt.Errorf("etherscan only supports eth, got '%v'", f.Symbol)
+		}
+	}
+	return Provider{
+		wallet:     wallet,
+		httpClient: httpClient,
+	}, nil
+}
+
+func (p Provider) GetBalances() ([]data.TokenBalance, error) {
+	r := make([]data.TokenBalance, 0)
+	for _, f := range p.wallet.Filters {
+		var wei string
+		err := p.call(url.Values{
+			"module":  {"account"},
+			"action":  {"balance"},
+			"address": {f.Address},
+			"tag":     {"latest"},
+		}, &wei)
+		if err != nil {
+			return nil, err
+		}
+		balance := tools.ToDecimal(wei, ethDecimals)
+		log.Printf("Got balance for wallet '%v:%v' => %v", f.Symbol, f.Address, balance)
+		r = append(r, data.TokenBalance{
+			Wallet:  p.wallet.Name,
+			Symbol:  f.Symbol,
+			Address: f.Address,
+			Balance: balance,
+			Locked:  decimal.Zero,
+		})
+	}
+	return r, nil
+}
+
+// GetTransactions returns normal transactions of every address after the last block seen
+func (p Provider) GetTransactions(cursors data.TransactionCursors) ([]data.Transaction, data.TransactionCursors, error) {
+	r := make([]data.Transaction, 0)
+	next := data.TransactionCursors{}
+	for _, f := range p.wallet.Filters {
+		key := strings.ToLower(f.Address)
+		last, _ := strconv.ParseInt(cursors[key], 10, 64)
+		start := last + 1
+		seen := make(map[string]bool)
+		for {
+			// Results stop at maxPages, the next round restarts from the last block as it may hold more rows,
+			// rows already seen are skipped by hash
+			added, capped := 0, true
+			for page := 1; page <= maxPages && capped; page++ {
+				var txs []apiTransaction
+				err := p.call(url.Values{
+					"module":     {"account"},
+					"action":     {"txlist"},
+					"address":    {f.Address},
+					"startblock": {strconv.FormatInt(start, 10)},
+					"endblock":   {"99999999"},
+					"page":       {strconv.Itoa(page)},
+					"offset":     {strconv.Itoa(pageSize)},
+					"sort":       {"asc"},
+				}, &txs)
+				if err != nil {
+					return nil, nil, err
+				}
+				for _, t := range txs {
+					if seen[t.Hash] {
+						continue
+					}
+					seen[t.Hash] = true
+					if block, _ := strconv.ParseInt(t.BlockNumber, 10, 64); block > last {
+						last = block
+					}
+					r = append(r, p.transaction(f, t))
+					added++
+				}
+				capped = len(txs) == pageSize
+			}
+			// A single block with more rows than the cap cannot be paged further
+			if !capped || added == 0 {
+				break
+			}
+			start = last
+		}
+		next[key] = strconv.FormatInt(last, 10)
+	}
+	log.Printf("Got %d etherscan transactions for wallet '%v'", len(r), p.wallet.Name)
+	return r, next, nil
+}
+
+func (p Provider) transaction(f config.TokenFilter, t apiTransaction) data.Transaction {
+	ts, _ := strconv.ParseInt(t.TimeStamp, 10, 64)
+	amount := tools.ToDecimal(t.Value, ethDecimals)
+	// Failed transactions move nothing but the fee
+	if t.IsError == "1" {
+		amount = decimal.Zero
+	}
+	fee := decimal.Zero
+	txType := data.TxDeposit
+	counterpart := t.From
+	if strings.EqualFold(t.From, f.Address) {
+		txType = data.TxWithdrawal
+		amount = amount.Neg()
+		counterpart = t.To
+		gasUsed, _ := decimal.NewFromString(t.GasUsed)
+		gasPrice, _ := decimal.NewFromString(t.GasPrice)
+		fee = gasUsed.Mul(gasPrice).Shift(-ethDecimals)
+	}
+	for _, other := range p.wallet.Filters {
+		if strings.EqualFold(other.Address, counterpart) {
+			txType = data.TxTransfer
+		}
+	}
+	return data.Transaction{
+		Timestamp: time.Unix(ts, 0),
+		Wallet:    p.wallet.Name,
+		TxId:      fmt.Sprintf("%v:%v", t.Hash, strings.ToLower(f.Address)),
+		RefId:     t.Hash,
+		Type:      txType,
+		Token:     f.Symbol,
+		Address:   f.Address,
+		Amount:    amount,
+		Fee:       fee,
+	}
+}
+
+func (p Provider) call(values url.Values, result interface{}) error {
+	values.Set("apikey", p.wallet.Provider.Key)
+	req, err := http.NewRequest("GET", fmt.Sprintf(apiEndpoint, values.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept-Encoding", "gzip,deflate")
+	body, err, code, _ := tools.ReadHTTPRequest(req, p.httpClient)
+	if err != nil {
+		log.Printf("Etherscan HTTP request failed: [%d] %v\n", code, err)
+		return err
+	}
+	var response apiResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return err
+	}
+	// Empty lists are reported as errors
+	if response.Status != "1" && response.Message != "No transactions found" {
+		return fmt.Errorf("etherscan call failed: %v %s", response.Message, response.Result)
+	}
+	if response.Status != "1" {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
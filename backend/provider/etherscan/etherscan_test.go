@@ -0,0 +1,86 @@
+package etherscan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/config"
+	"github.com/zooper-corp/CoinWatch/data"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// fakeChain answers txlist like etherscan, three transactions per block and at most 10000 rows per query
+type fakeChain []apiTransaction
+
+func (c fakeChain) RoundTrip(req *http.Request) (*http.Response, error) {
+	q := req.URL.Query()
+	start, _ := strconv.Atoi(q.Get("startblock"))
+	page, _ := strconv.Atoi(q.Get("page"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	rows := make([]apiTransaction, 0)
+	for _, t := range c {
+		if block, _ := strconv.Atoi(t.BlockNumber); block >= start {
+			rows = append(rows, t)
+		}
+	}
+	if page*offset > 10000 {
+		rows = nil
+	} else if from := (page - 1) * offset; from >= len(rows) {
+		rows = nil
+	} else if rows = rows[from:]; len(rows) > offset {
+		rows = rows[:offset]
+	}
+	result, _ := json.Marshal(rows)
+	body, _ := json.Marshal(apiResponse{Status: "1", Message: "OK", Result: result})
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewReader(body)), Header: http.Header{}}, nil
+}
+
+func TestProvider_GetTransactions(t *testing.T) {
+	wallet := config.Wallet{Name: "test", Filters: []config.TokenFilter{{Symbol: "eth", Address: "0xaaa"}}}
+	chain := make(fakeChain, 10500)
+	for i := range chain {
+		chain[i] = apiTransaction{
+			BlockNumber: strconv.Itoa(i/3 + 1), Hash: fmt.Sprintf("0x%d", i), From: "0xbbb", To: "0xaaa", Value: "1",
+		}
+	}
+	p := Provider{wallet: &wallet, httpClient: &http.Client{Transport: chain}}
+	// Block 3334 is split by the 10000 rows cap
+	r, cursors, err := p.GetTransactions(data.TransactionCursors{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != len(chain) || cursors["0xaaa"] != "3500" {
+		t.Errorf("Expected %d transactions up to block 3500 got %d %v", len(chain), len(r), cursors)
+	}
+	r, _, err = p.GetTransactions(cursors)
+	if err != nil || len(r) != 0 {
+		t.Errorf("Expected nothing new got %d %v", len(r), err)
+	}
+}
+
+func TestProvider_Transaction(t *testing.T) {
+	wallet := config.Wallet{
+		Name: "test",
+		Filters: []config.TokenFilter{
+			{Symbol: "eth", Address: "0xAaA"},
+			{Symbol: "eth", Address: "0xBbB"},
+		},
+	}
+	p := Provider{wallet: &wallet}
+	tx := p.transaction(wallet.Filters[0], apiTransaction{
+		Hash: "0x1", From: "0xaaa", To: "0xccc", Value: "1500000000000000001", GasPrice: "20000000000", GasUsed: "21000",
+		TimeStamp: "1650000000",
+	})
+	if tx.Type != data.TxWithdrawal || !tx.Amount.Equal(decimal.RequireFromString("-1.500000000000000001")) ||
+		!tx.Fee.Equal(decimal.RequireFromString("0.00042")) {
+		t.Errorf("Unexpected withdrawal %+v", tx)
+	}
+	tx = p.transaction(wallet.Filters[1], apiTransaction{Hash: "0x2", From: "0xaaa", To: "0xbbb", Value: "1", IsError: "1"})
+	if tx.Type != data.TxTransfer || !tx.Amount.IsZero() || !tx.Fee.IsZero() {
+		t.Errorf("Unexpected transfer %+v", tx)
+	}
+}
@@ -0,0 +1,22 @@
+package etherscan
+
+import "encoding/json"
+
+// apiResponse wraps every etherscan reply, result is a string on errors
+type apiResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
+}
+
+type apiTransaction struct {
+	BlockNumber string `json:"blockNumber"`
+	TimeStamp   string `json:"timeStamp"`
+	Hash        string `json:"hash"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Value       string `json:"value"`
+	GasPrice    string `json:"gasPrice"`
+	GasUsed     string `json:"gasUsed"`
+	IsError     string `json:"isError"`
+}
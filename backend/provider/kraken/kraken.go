@@ -7,13 +7,14 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"github.com/shopspring/decimal"
+	krakenprice "github.com/zooper-corp/CoinWatch/backend/price/kraken"
 	"github.com/zooper-corp/CoinWatch/config"
 	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/tools"
 	"log"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -21,20 +22,33 @@ import (
 const (
 	apiEndpoint = "https://api.kraken.com/%s"
 	apiBalance  = "Balance"
+	apiLedgers  = "Ledgers"
 	apiVersion  = "0"
 )
 
+// Addresses of balances within the account
+const (
+	fundsAddress     = "Funds"
+	stakingAddress   = "Staking"
+	parachainAddress = "Parachain"
+)
+
+// dustBalance is the amount below which balances are skipped
+var dustBalance = decimal.RequireFromString("0.0001")
+
 type Provider struct {
 	wallet     *config.Wallet
+	db         data.Store
 	httpClient *http.Client
 }
 
-func New(wallet *config.Wallet, httpClient *http.Client) (Provider, error) {
+func New(wallet *config.Wallet, db data.Store, httpClient *http.Client) (Provider, error) {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
 	return Provider{
 		wallet:     wallet,
+		db:         db,
 		httpClient: httpClient,
 	}, nil
 }
@@ -55,51 +69,30 @@ func (p Provider) GetBalances() ([]data.TokenBalance, error) {
 		log.Printf("Kraken call failed: %v\n", balance.Error)
 		return nil, fmt.Errorf("kraken API call failed: %v", balance.Error[0])
 	}
+	assets, err := krakenprice.LoadAssets(p.db, p.httpClient)
+	if err != nil {
+		log.Printf("Unable to load kraken assets: %v\n", err)
+		return nil, err
+	}
 	r := make([]data.TokenBalance, 0)
-	ignoredTokens := p.wallet.Provider.Ignore
-	renameRules := p.wallet.Provider.Rename
 	for token, amount := range balance.Result {
-		parts := strings.Split(token, ".")
-		// Symbol clean iup
-		name := strings.Trim(parts[0], "XZ2")
-		if name == "BT" {
-			name = "BTC"
-		}
-		// Check if name lowercase is in ignoredTokens array
-		if tools.StringInSlice(strings.ToLower(name), ignoredTokens) {
-			log.Printf("Ignoring token %v", name)
+		name, ignored := p.symbol(assets, token)
+		if ignored {
 			continue
 		}
-		// Rename token if needed
-		for _, renameRule := range renameRules {
-			if newName, exists := renameRule[strings.ToLower(name)]; exists {
-				log.Printf("Renaming token %v to %v", name, newName)
-				name = strings.ToUpper(newName)
-				break // Exit the loop once a rename rule is applied
-			}
-		}
 		// Get quantity
-		qt, err := strconv.ParseFloat(amount, 32)
+		qt, err := decimal.NewFromString(amount)
 		if err != nil {
 			log.Printf("Unable to unmarshal token quantity: %v => %v %v", token, amount, err)
 			return nil, err
 		}
-		if qt <= 0.0001 {
+		if qt.LessThanOrEqual(dustBalance) {
 			continue
 		}
-		addr := "Funds"
-		locked := 0.0
-		if len(parts) > 1 {
-			switch strings.ToLower(parts[1]) {
-			case "s":
-				addr = "Staking"
-				locked = qt
-			case "p":
-				addr = "Parachain"
-				locked = qt
-			default:
-				log.Printf("Unknown modifier %v", parts[1])
-			}
+		addr := address(token)
+		locked := decimal.Zero
+		if addr != fundsAddress {
+			locked = qt
 		}
 		log.Printf("Kraken balance: %v:%v => %v", name, addr, qt)
 		r = append(r, data.TokenBalance{
@@ -113,6 +106,41 @@ func (p Provider) GetBalances() ([]data.TokenBalance, error) {
 	return r, nil
 }
 
+// symbol resolves a kraken asset name using the asset list and wallet rename rules, ignored is true
+// for tokens the wallet ignores
+func (p Provider) symbol(assets krakenprice.Assets, token string) (string, bool) {
+	name := assets.Symbol(token)
+	// Check if name lowercase is in ignoredTokens array
+	if tools.StringInSlice(strings.ToLower(name), p.wallet.Provider.Ignore) {
+		log.Printf("Ignoring token %v", name)
+		return name, true
+	}
+	// Rename token if needed
+	for _, renameRule := range p.wallet.Provider.Rename {
+		if newName, exists := renameRule[strings.ToLower(name)]; exists {
+			log.Printf("Renaming token %v to %v", name, newName)
+			return strings.ToUpper(newName), false
+		}
+	}
+	return name, false
+}
+
+// address returns where funds sit in the account from the asset modifier, staked assets end with .S
+func address(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) > 1 {
+		switch strings.ToLower(parts[1]) {
+		case "s":
+			return stakingAddress
+		case "p":
+			return parachainAddress
+		default:
+			log.Printf("Unknown modifier %v", parts[1])
+		}
+	}
+	return fundsAddress
+}
+
 func (p Provider) call(uriPath string, values url.Values) ([]byte, error) {
 	uri := fmt.Sprintf(apiEndpoint, uriPath)
 	values.Set("nonce", fmt.Sprintf("%d", time.Now().UnixNano()))
@@ -1 +1,30 @@
 package kraken
+
+import (
+	krakenprice "github.com/zooper-corp/CoinWatch/backend/price/kraken"
+	"github.com/zooper-corp/CoinWatch/config"
+	"github.com/zooper-corp/CoinWatch/data"
+	"testing"
+)
+
+func TestProvider_Transaction(t *testing.T) {
+	wallet := config.Wallet{Name: "kraken", Provider: config.ProviderConfig{Ignore: []string{"eur"}}}
+	p := Provider{wallet: &wallet}
+	assets := krakenprice.NewAssets([]krakenprice.Asset{
+		{Name: "DOT", AltName: "DOT"},
+		{Name: "ZEUR", AltName: "EUR"},
+	}, nil)
+	tx, ok := p.transaction(assets, "L1", ledgerEntry{
+		RefId: "R1", Time: 1650000000.1234, Type: "staking", Asset: "DOT.S", Amount: "0.1234567890", Fee: "0.0000",
+	})
+	if !ok || tx.Type != data.TxReward || tx.Token != "DOT" || tx.Address != stakingAddress || tx.Amount.String() != "0.123456789" {
+		t.Errorf("Unexpected transaction %+v", tx)
+	}
+	tx, ok = p.transaction(assets, "L2", ledgerEntry{RefId: "R2", Type: "earn", Subtype: "allocation", Asset: "DOT", Amount: "-1"})
+	if !ok || tx.Type != data.TxTransfer {
+		t.Errorf("Expected earn allocation to be a transfer got %+v", tx)
+	}
+	if _, ok := p.transaction(assets, "L3", ledgerEntry{Type: "deposit", Asset: "ZEUR", Amount: "100"}); ok {
+		t.Errorf("Expected ignored token to be skipped")
+	}
+}
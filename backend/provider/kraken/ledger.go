@@ -0,0 +1,128 @@
+package kraken
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
+	krakenprice "github.com/zooper-corp/CoinWatch/backend/price/kraken"
+	"github.com/zooper-corp/CoinWatch/data"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ledgerCursor is the time of the last ledger entry, kraken starts after it
+const ledgerCursor = "ledger"
+
+// ledgerTypes maps kraken ledger entry types to transaction types, others are internal transfers
+var ledgerTypes = map[string]string{
+	"deposit":    data.TxDeposit,
+	"withdrawal": data.TxWithdrawal,
+	"trade":      data.TxTrade,
+	"spend":      data.TxTrade,
+	"receive":    data.TxTrade,
+	"margin":     data.TxTrade,
+	"rollover":   data.TxFee,
+	"settled":    data.TxTrade,
+	"sale":       data.TxTrade,
+	"staking":    data.TxReward,
+	"dividend":   data.TxReward,
+}
+
+// GetTransactions returns ledger entries after the cursor, kraken lists them most recent first by pages
+func (p Provider) GetTransactions(cursors data.TransactionCursors) ([]data.Transaction, data.TransactionCursors, error) {
+	assets, err := krakenprice.LoadAssets(p.db, p.httpClient)
+	if err != nil {
+		log.Printf("Unable to load kraken assets: %v\n", err)
+		return nil, nil, err
+	}
+	urlPath := fmt.Sprintf("/%s/private/%s", apiVersion, apiLedgers)
+	start := cursors[ledgerCursor]
+	last := start
+	r := make([]data.Transaction, 0)
+	for offset := 0; ; {
+		values := url.Values{}
+		values.Set("ofs", strconv.Itoa(offset))
+		if start != "" {
+			values.Set("start", start)
+		}
+		d, err := p.call(urlPath, values)
+		if err != nil {
+			return nil, nil, err
+		}
+		var ledgers ledgersUnmarshal
+		if err := json.Unmarshal(d, &ledgers); err != nil {
+			log.Printf("Unable to unmarshal kraken data: %v\n", err)
+			return nil, nil, err
+		}
+		if len(ledgers.Error) > 0 {
+			log.Printf("Kraken call failed: %v\n", ledgers.Error)
+			return nil, nil, fmt.Errorf("kraken API call failed: %v", ledgers.Error[0])
+		}
+		for id, e := range ledgers.Result.Ledger {
+			if t, ok := p.transaction(assets, id, e); ok {
+				r = append(r, t)
+			}
+			// Rounded cursors may return the last entry again, it is skipped by id when stored
+			if last == "" || e.Time > parseLedgerTime(last) {
+				last = formatLedgerTime(e.Time)
+			}
+		}
+		offset += len(ledgers.Result.Ledger)
+		if len(ledgers.Result.Ledger) == 0 || offset >= ledgers.Result.Count {
+			break
+		}
+	}
+	log.Printf("Got %d kraken ledger entries for wallet '%v'", len(r), p.wallet.Name)
+	next := data.TransactionCursors{}
+	if last != "" {
+		next[ledgerCursor] = last
+	}
+	return r, next, nil
+}
+
+func (p Provider) transaction(assets krakenprice.Assets, id string, e ledgerEntry) (data.Transaction, bool) {
+	name, ignored := p.symbol(assets, e.Asset)
+	if ignored {
+		return data.Transaction{}, false
+	}
+	amount, err := decimal.NewFromString(e.Amount)
+	if err != nil {
+		log.Printf("Unable to parse kraken ledger amount %v: %v", e.Amount, err)
+		return data.Transaction{}, false
+	}
+	fee, err := decimal.NewFromString(e.Fee)
+	if err != nil {
+		fee = decimal.Zero
+	}
+	txType, ok := ledgerTypes[strings.ToLower(e.Type)]
+	if !ok {
+		txType = data.TxTransfer
+	}
+	// Earn entries are moves between spot and staking, except rewards
+	if strings.EqualFold(e.Type, "earn") && strings.EqualFold(e.Subtype, "reward") {
+		txType = data.TxReward
+	}
+	return data.Transaction{
+		Timestamp: time.UnixMicro(int64(e.Time * 1e6)),
+		Wallet:    p.wallet.Name,
+		TxId:      id,
+		RefId:     e.RefId,
+		Type:      txType,
+		Token:     name,
+		Address:   address(e.Asset),
+		Amount:    amount,
+		Fee:       fee,
+	}, true
+}
+
+func formatLedgerTime(t float64) string {
+	return strconv.FormatFloat(t, 'f', 4, 64)
+}
+
+func parseLedgerTime(t string) float64 {
+	r, _ := strconv.ParseFloat(t, 64)
+	return r
+}
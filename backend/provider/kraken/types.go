@@ -4,3 +4,21 @@ type balanceUnmarshal struct {
 	Error  []string          `json:"error"`
 	Result map[string]string `json:"result"`
 }
+
+type ledgerEntry struct {
+	RefId   string  `json:"refid"`
+	Time    float64 `json:"time"`
+	Type    string  `json:"type"`
+	Subtype string  `json:"subtype"`
+	Asset   string  `json:"asset"`
+	Amount  string  `json:"amount"`
+	Fee     string  `json:"fee"`
+}
+
+type ledgersUnmarshal struct {
+	Error  []string `json:"error"`
+	Result struct {
+		Ledger map[string]ledgerEntry `json:"ledger"`
+		Count  int                    `json:"count"`
+	} `json:"result"`
+}
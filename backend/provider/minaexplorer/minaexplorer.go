@@ -3,12 +3,12 @@ package minaexplorer
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/shopspring/decimal"
 	"github.com/zooper-corp/CoinWatch/config"
 	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/tools"
 	"log"
 	"net/http"
-	"strconv"
 )
 
 // https://docs.blockberry.one/reference/getaccountbalance-1
@@ -57,7 +57,7 @@ func (p Provider) GetBalance(address string, symbol string) (data.TokenBalance,
 	if err != nil {
 		return data.TokenBalance{}, err
 	}
-	balance, err := strconv.ParseFloat(account.Account.Balance.Total, 64)
+	balance, err := decimal.NewFromString(account.Account.Balance.Total)
 	if err != nil {
 		return data.TokenBalance{}, err
 	}
@@ -66,7 +66,7 @@ func (p Provider) GetBalance(address string, symbol string) (data.TokenBalance,
 		Symbol:  symbol,
 		Address: account.Account.PublicKey,
 		Balance: balance,
-		Locked:  0,
+		Locked:  decimal.Zero,
 	}, nil
 }
 
@@ -3,6 +3,7 @@ package provider
 import (
 	"github.com/zooper-corp/CoinWatch/backend/provider/algoexplorer"
 	"github.com/zooper-corp/CoinWatch/backend/provider/blockcypher"
+	"github.com/zooper-corp/CoinWatch/backend/provider/etherscan"
 	"github.com/zooper-corp/CoinWatch/backend/provider/kraken"
 	"github.com/zooper-corp/CoinWatch/backend/provider/minaexplorer"
 	"github.com/zooper-corp/CoinWatch/backend/provider/subscan"
@@ -17,7 +18,13 @@ type Provider interface {
 	GetBalances() ([]data.TokenBalance, error)
 }
 
-func New(wallet *config.Wallet, httpClient *http.Client) (Provider, error) {
+// TransactionProvider is implemented by providers able to list past transactions, only transactions after
+// cursors are returned along with the moved cursors so updates are incremental
+type TransactionProvider interface {
+	GetTransactions(cursors data.TransactionCursors) ([]data.Transaction, data.TransactionCursors, error)
+}
+
+func New(wallet *config.Wallet, db data.Store, httpClient *http.Client) (Provider, error) {
 	if httpClient == nil {
 		httpClient = http.DefaultClient
 	}
@@ -31,7 +38,9 @@ func New(wallet *config.Wallet, httpClient *http.Client) (Provider, error) {
 	case "minaexplorer":
 		return minaexplorer.New(wallet, httpClient)
 	case "kraken":
-		return kraken.New(wallet, httpClient)
+		return kraken.New(wallet, db, httpClient)
+	case "etherscan":
+		return etherscan.New(wallet, httpClient)
 	default:
 		log.Fatalf("Invalid balance provider %v\n", wallet.Provider)
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/shopspring/decimal"
 	"github.com/zooper-corp/CoinWatch/config"
 	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/tools"
@@ -18,6 +19,10 @@ const (
 	apiEndpoint  = "https://%v.api.subscan.io/api/%v"
 	apiTimestamp = "now"
 	apiTokens    = "scan/account/tokens"
+	apiChain     = "scan/token"
+	apiTransfers = "v2/scan/transfers"
+	apiRewards   = "scan/account/reward_slash"
+	nativeToken  = "native"
 )
 
 type Provider struct {
@@ -48,41 +53,70 @@ func (p Provider) GetBalances() ([]data.TokenBalance, error) {
 }
 
 func (p Provider) GetBalance(endpoint string, address string, symbol string) (data.TokenBalance, error) {
-	r, err := p.call(apiTokens, endpoint, map[string]string{
+	tb, _, found, err := p.getToken(endpoint, address, symbol)
+	if err != nil {
+		return data.TokenBalance{}, err
+	}
+	if found {
+		decimals := tb.Decimals
+		balance := tools.ToDecimal(tb.Balance, decimals)
+		locked := tools.ToDecimal(tb.Lock, decimals)
+		log.Printf("Got balance for wallet '%v:%v' => %v/%v", symbol, address, balance, locked)
+		return data.TokenBalance{
+			Wallet:  p.wallet.Name,
+			Symbol:  symbol,
+			Address: address,
+			Balance: balance,
+			Locked:  locked,
+		}, nil
+	}
+	// Empty
+	return data.TokenBalance{
+		Wallet:  p.wallet.Name,
+		Symbol:  symbol,
+		Address: address,
+		Balance: decimal.Zero,
+		Locked:  decimal.Zero,
+	}, nil
+}
+
+// getToken returns token data of an address and whether it is the native token of the endpoint
+func (p Provider) getToken(endpoint string, address string, symbol string) (endpointTokenData, bool, bool, error) {
+	r, err := p.call(apiTokens, endpoint, map[string]interface{}{
 		"address": address,
 	})
 	if err != nil {
-		return data.TokenBalance{}, err
+		return endpointTokenData{}, false, false, err
 	}
 	var es endpointTokens
 	if err := json.Unmarshal(r, &es); err != nil {
-		return data.TokenBalance{}, err
+		return endpointTokenData{}, false, false, err
 	}
-	for _, tokenType := range es.Data {
-		for _, tb := range tokenType {
+	for tokenType, tokens := range es.Data {
+		for _, tb := range tokens {
 			if strings.EqualFold(tb.Symbol, symbol) {
-				decimals := tb.Decimals
-				balance, _ := tools.ToDecimal(tb.Balance, decimals).Float64()
-				locked, _ := tools.ToDecimal(tb.Lock, decimals).Float64()
-				log.Printf("Got balance for wallet '%v:%v' => %v/%v", symbol, address, balance, locked)
-				return data.TokenBalance{
-					Wallet:  p.wallet.Name,
-					Symbol:  symbol,
-					Address: address,
-					Balance: balance,
-					Locked:  locked,
-				}, nil
+				return tb, tokenType == nativeToken, true, nil
 			}
 		}
 	}
-	// Empty
-	return data.TokenBalance{
-		Wallet:  p.wallet.Name,
-		Symbol:  symbol,
-		Address: address,
-		Balance: 0,
-		Locked:  0,
-	}, nil
+	return endpointTokenData{}, false, false, nil
+}
+
+// getNativeToken returns the native token of the endpoint, addresses holding none of it have no token data
+func (p Provider) getNativeToken(endpoint string) (endpointTokenData, error) {
+	r, err := p.call(apiChain, endpoint, nil)
+	if err != nil {
+		return endpointTokenData{}, err
+	}
+	var ec endpointChainTokens
+	if err := json.Unmarshal(r, &ec); err != nil {
+		return endpointTokenData{}, err
+	}
+	if ec.Code != 0 || len(ec.Data.Token) == 0 {
+		return endpointTokenData{}, fmt.Errorf("subscan native token of %v not found: %v", endpoint, ec.Message)
+	}
+	symbol := ec.Data.Token[0]
+	return endpointTokenData{Symbol: symbol, Decimals: ec.Data.Detail[symbol].Decimals}, nil
 }
 
 func (p Provider) Ping(endpoint string) (int, error) {
@@ -98,10 +132,10 @@ func (p Provider) Ping(endpoint string) (int, error) {
 	return et.Data, nil
 }
 
-func (p Provider) call(method string, endpoint string, data map[string]string) ([]byte, error) {
+func (p Provider) call(method string, endpoint string, data map[string]interface{}) ([]byte, error) {
 	uri := fmt.Sprintf(apiEndpoint, endpoint, method)
 	if data == nil {
-		data = map[string]string{}
+		data = map[string]interface{}{}
 	}
 	jsonData, err := json.Marshal(data)
 	if err != nil {
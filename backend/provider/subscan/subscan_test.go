@@ -17,6 +17,17 @@ func TestProvider_Ping(t *testing.T) {
 	}
 }
 
+func TestProvider_GetNativeToken(t *testing.T) {
+	p := getProvider(getPolkadotWallet())
+	r, err := p.getNativeToken("polkadot")
+	if err != nil {
+		t.Error(err)
+	}
+	if r.Symbol != "DOT" || r.Decimals != 10 {
+		t.Errorf("Expected DOT with 10 decimals got %+v", r)
+	}
+}
+
 func TestProvider_GetBalance(t *testing.T) {
 	p := getProvider(getPolkadotWallet())
 	b, err := p.GetBalances()
@@ -24,7 +35,7 @@ func TestProvider_GetBalance(t *testing.T) {
 		t.Error(err)
 	}
 	r := b[0]
-	if r.Balance == 0 {
+	if r.Balance.IsZero() {
 		t.Error("Expected >0 got 0")
 	}
 }
@@ -36,7 +47,7 @@ func TestProvider_Erc20_GetBalance(t *testing.T) {
 		t.Error(err)
 	}
 	r := b[0]
-	if r.Balance == 0 {
+	if r.Balance.IsZero() {
 		t.Error("Expected >0 got 0")
 	}
 }
@@ -0,0 +1,193 @@
+package subscan
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/config"
+	"github.com/zooper-corp/CoinWatch/data"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pageRows = 100
+	maxPages = 1000
+)
+
+// GetTransactions returns transfers and staking rewards of every wallet address newer than the last block
+// seen, cursors hold the last block per address and token
+func (p Provider) GetTransactions(cursors data.TransactionCursors) ([]data.Transaction, data.TransactionCursors, error) {
+	r := make([]data.Transaction, 0)
+	next := data.TransactionCursors{}
+	for _, f := range p.wallet.Filters {
+		key := cursorKey(f)
+		after, _ := strconv.ParseInt(cursors[key], 10, 64)
+		transactions, last, err := p.getTransactions(f, after)
+		if err != nil {
+			return nil, nil, err
+		}
+		r = append(r, transactions...)
+		next[key] = strconv.FormatInt(last, 10)
+	}
+	return r, next, nil
+}
+
+func (p Provider) getTransactions(f config.TokenFilter, after int64) ([]data.Transaction, int64, error) {
+	endpoint := f.Config.Contract
+	token, native, found, err := p.getToken(endpoint, f.Address, f.Symbol)
+	if err != nil {
+		return nil, after, err
+	}
+	// Emptied addresses have no token data, fees and rewards still need the native decimals. Transfer amounts
+	// come in token units so other tokens do not need them
+	if !found {
+		chain, err := p.getNativeToken(endpoint)
+		if err != nil {
+			return nil, after, err
+		}
+		if strings.EqualFold(chain.Symbol, f.Symbol) {
+			token, native = chain, true
+		}
+	}
+	last := after
+	r := make([]data.Transaction, 0)
+	// Transfers, most recent first
+	for page := 0; page < maxPages; page++ {
+		body, err := p.call(apiTransfers, endpoint, map[string]interface{}{
+			"address": f.Address,
+			"row":     pageRows,
+			"page":    page,
+		})
+		if err != nil {
+			return nil, after, err
+		}
+		var et endpointTransfers
+		if err := json.Unmarshal(body, &et); err != nil {
+			return nil, after, err
+		}
+		if et.Code != 0 {
+			return nil, after, fmt.Errorf("subscan transfers failed: %v", et.Message)
+		}
+		done := len(et.Data.Transfers) < pageRows
+		for _, t := range et.Data.Transfers {
+			if t.BlockNum <= after {
+				done = true
+				break
+			}
+			if t.BlockNum > last {
+				last = t.BlockNum
+			}
+			if tx, ok := p.transfer(f, t, native, token.Decimals); ok {
+				r = append(r, tx)
+			}
+		}
+		if done {
+			break
+		}
+	}
+	// Staking rewards, only native tokens are staked
+	if !native {
+		return r, last, nil
+	}
+	for page := 0; page < maxPages; page++ {
+		body, err := p.call(apiRewards, endpoint, map[string]interface{}{
+			"address":  f.Address,
+			"row":      pageRows,
+			"page":     page,
+			"is_stash": true,
+		})
+		if err != nil {
+			return nil, after, err
+		}
+		var er endpointRewards
+		if err := json.Unmarshal(body, &er); err != nil {
+			return nil, after, err
+		}
+		if er.Code != 0 {
+			// Chains without staking
+			log.Printf("Subscan rewards not available on %v: %v", endpoint, er.Message)
+			break
+		}
+		done := len(er.Data.List) < pageRows
+		for _, e := range er.Data.List {
+			if e.BlockNum <= after {
+				done = true
+				break
+			}
+			if e.BlockNum > last {
+				last = e.BlockNum
+			}
+			amount := tools.ToDecimal(e.Amount, token.Decimals)
+			txType := data.TxReward
+			if strings.Contains(strings.ToLower(e.EventId), "slash") {
+				txType = data.TxFee
+				amount = amount.Neg()
+			}
+			r = append(r, data.Transaction{
+				Timestamp: time.Unix(e.BlockTimestamp, 0),
+				Wallet:    p.wallet.Name,
+				TxId:      fmt.Sprintf("%v:%v", endpoint, e.EventIndex),
+				RefId:     e.ExtrinsicHash,
+				Type:      txType,
+				Token:     f.Symbol,
+				Address:   f.Address,
+				Amount:    amount,
+				Fee:       decimal.Zero,
+			})
+		}
+		if done {
+			break
+		}
+	}
+	log.Printf("Got %d subscan transactions for '%v:%v'", len(r), f.Symbol, f.Address)
+	return r, last, nil
+}
+
+// transfer converts a transfer of the filter token, fees are only known for the native token
+func (p Provider) transfer(f config.TokenFilter, t endpointTransfer, native bool, decimals int) (data.Transaction, bool) {
+	if !strings.EqualFold(t.AssetSymbol, f.Symbol) {
+		return data.Transaction{}, false
+	}
+	amount, err := decimal.NewFromString(t.Amount)
+	if err != nil || !t.Success {
+		amount = decimal.Zero
+	}
+	fee := decimal.Zero
+	txType := data.TxDeposit
+	if strings.EqualFold(t.From, f.Address) {
+		txType = data.TxWithdrawal
+		amount = amount.Neg()
+		if native {
+			fee = tools.ToDecimal(t.Fee, decimals)
+		}
+	}
+	// Transfers between two addresses of the same wallet
+	for _, other := range p.wallet.Filters {
+		counterpart := t.To
+		if txType == data.TxDeposit {
+			counterpart = t.From
+		}
+		if strings.EqualFold(other.Address, counterpart) && strings.EqualFold(other.Symbol, f.Symbol) {
+			txType = data.TxTransfer
+		}
+	}
+	return data.Transaction{
+		Timestamp: time.Unix(t.BlockTimestamp, 0),
+		Wallet:    p.wallet.Name,
+		TxId:      fmt.Sprintf("%v:%v:%v:%v", f.Config.Contract, t.ExtrinsicIndex, t.EventIdx, strings.ToLower(f.Address)),
+		RefId:     t.Hash,
+		Type:      txType,
+		Token:     f.Symbol,
+		Address:   f.Address,
+		Amount:    amount,
+		Fee:       fee,
+	}, true
+}
+
+func cursorKey(f config.TokenFilter) string {
+	return fmt.Sprintf("%v:%v:%v", f.Config.Contract, strings.ToLower(f.Address), strings.ToLower(f.Symbol))
+}
@@ -20,3 +20,55 @@ type endpointTokens struct {
 	GeneratedAt int                            `json:"generated_at"`
 	Data        map[string][]endpointTokenData `json:"data"`
 }
+
+type endpointChainTokens struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Token  []string `json:"token"`
+		Detail map[string]struct {
+			Decimals int `json:"token_decimals"`
+		} `json:"detail"`
+	} `json:"data"`
+}
+
+type endpointTransfer struct {
+	From           string `json:"from"`
+	To             string `json:"to"`
+	ExtrinsicIndex string `json:"extrinsic_index"`
+	Success        bool   `json:"success"`
+	Hash           string `json:"hash"`
+	BlockNum       int64  `json:"block_num"`
+	BlockTimestamp int64  `json:"block_timestamp"`
+	Amount         string `json:"amount"`
+	Fee            string `json:"fee"`
+	AssetSymbol    string `json:"asset_symbol"`
+	EventIdx       int    `json:"event_idx"`
+}
+
+type endpointTransfers struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Count     int                `json:"count"`
+		Transfers []endpointTransfer `json:"transfers"`
+	} `json:"data"`
+}
+
+type endpointReward struct {
+	EventIndex     string `json:"event_index"`
+	BlockNum       int64  `json:"block_num"`
+	BlockTimestamp int64  `json:"block_timestamp"`
+	EventId        string `json:"event_id"`
+	ExtrinsicHash  string `json:"extrinsic_hash"`
+	Amount         string `json:"amount"`
+}
+
+type endpointRewards struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Count int              `json:"count"`
+		List  []endpointReward `json:"list"`
+	} `json:"data"`
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/zooper-corp/CoinWatch/analytics"
 	"github.com/zooper-corp/CoinWatch/client"
 	"github.com/zooper-corp/CoinWatch/config"
+	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/display"
 	"github.com/zooper-corp/CoinWatch/tools"
 	"log"
@@ -19,6 +21,13 @@ type TelegramBot struct {
 	client               *client.Client
 	bot                  *tgbotapi.BotAPI
 	stopClientUpdateLoop chan struct{}
+	lastCompact          time.Time
+	lastBackup           time.Time
+	lastTransactions     time.Time
+	// lastEvents is when anomalies were last sent, events found before the bot started are not
+	lastEvents time.Time
+	// portfolios are all updated by the loop whichever one is selected
+	portfolios []client.Client
 }
 
 var mainKeyboard = tgbotapi.NewReplyKeyboard(
@@ -27,11 +36,14 @@ var mainKeyboard = tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButton("/sum 31"),
 		tgbotapi.NewKeyboardButton("/allocation"),
 		tgbotapi.NewKeyboardButton("/wallets"),
+		tgbotapi.NewKeyboardButton("/pnl"),
 	),
 	tgbotapi.NewKeyboardButtonRow(
 		tgbotapi.NewKeyboardButton("/graph 30"),
 		tgbotapi.NewKeyboardButton("/graph 90"),
 		tgbotapi.NewKeyboardButton("/graph 365"),
+		tgbotapi.NewKeyboardButton("/rebalance"),
+		tgbotapi.NewKeyboardButton("/group tag"),
 	),
 )
 
@@ -40,7 +52,15 @@ func New(c *client.Client, cfg config.TelegramBotConfig) TelegramBot {
 	if err != nil {
 		log.Fatalf("Unable to start telegram bot: %v", err)
 	}
-	return TelegramBot{cfg, c, bot, make(chan struct{})}
+	portfolios := make([]client.Client, 0)
+	for _, p := range c.GetPortfolios() {
+		pc, err := c.WithPortfolio(p.Name)
+		if err != nil {
+			log.Fatalf("Unable to load portfolio %v: %v", p.Name, err)
+		}
+		portfolios = append(portfolios, pc)
+	}
+	return TelegramBot{cfg, c, bot, make(chan struct{}), time.Time{}, time.Time{}, time.Time{}, time.Now(), portfolios}
 }
 
 func (b *TelegramBot) Start() {
@@ -87,10 +107,62 @@ func (b *TelegramBot) startClientUpdateLoop() {
 
 func (b *TelegramBot) updateBalance() {
 	log.Printf("Running ticker update")
-	err := b.client.UpdateBalance(15)
-	if err != nil {
-		log.Printf(fmt.Sprintf("Balance update failed %v", err))
-		//b.sendTextMessage(fmt.Sprintf("Balance update failed %v", err))
+	for _, c := range b.portfolios {
+		err := c.UpdateBalance(15)
+		if err != nil {
+			log.Printf("Balance update of portfolio %v failed %v", c.GetPortfolio(), err)
+		}
+	}
+	b.sendEvents()
+	// Transactions once an hour, ledgers change much less often than prices
+	if time.Since(b.lastTransactions) > time.Hour {
+		b.lastTransactions = time.Now()
+		for _, c := range b.portfolios {
+			if _, err := c.UpdateTransactions(); err != nil {
+				log.Printf("Transactions update of portfolio %v failed %v", c.GetPortfolio(), err)
+			}
+		}
+	}
+	// DB maintenance is shared by every portfolio
+	c := b.portfolios[0]
+	// Compact once a day
+	if c.IsAutoCompactEnabled() && time.Since(b.lastCompact) > time.Hour*24 {
+		b.lastCompact = time.Now()
+		r, err := c.Compact(false)
+		if err != nil {
+			log.Printf("DB compaction failed %v", err)
+		} else {
+			log.Printf("DB compaction removed %d snapshots and %d balances", r.Snapshots, r.Balances)
+		}
+	}
+	// Backup once a day
+	if c.IsDailyBackupEnabled() && time.Since(b.lastBackup) > time.Hour*24 {
+		b.lastBackup = time.Now()
+		path, err := c.Backup()
+		if err != nil {
+			log.Printf("DB backup failed %v", err)
+			b.sendTextMessage(fmt.Sprintf("DB backup failed %v", err))
+		} else {
+			log.Printf("DB backed up to %v", path)
+		}
+	}
+}
+
+// sendEvents alerts about anomalies every portfolio found since the last call
+func (b *TelegramBot) sendEvents() {
+	from := b.lastEvents
+	b.lastEvents = time.Now()
+	for _, c := range b.portfolios {
+		events, err := c.GetEvents(from)
+		if err != nil {
+			log.Printf("Unable to get events of portfolio %v: %v", c.GetPortfolio(), err)
+			continue
+		}
+		if len(events) == 0 {
+			continue
+		}
+		t, _ := display.EventsAsciiTable(&c, events, display.GetDefaultAsciiTableStyle())
+		b.sendHtmlMessage(fmt.Sprintf("<b>Alert</b> %s\n<pre>%s</pre>", c.GetPortfolio(), t))
 	}
 }
 
@@ -107,17 +179,19 @@ func (b *TelegramBot) onUpdate(update tgbotapi.Update) {
 		// Table
 		t, _ := display.SummaryAsciiTable(b.client, days, display.GetDefaultAsciiTableStyle())
 		l := strings.Split(t, "\n")
+		// Returns without deposits and withdrawals
+		p, _ := display.PerformanceText(b.client, days)
 		// Graph
 		g, _ := display.TotalAsciiGraph(b.client, days, display.AsciiGraphStyle{Width: 25, Height: 8})
 		// Dump
 		b.sendHtmlMessage(fmt.Sprintf(
 			"<b>Update</b>\n%s\n"+
 				"<b>Balance</b>\n<pre>%s</pre>\n"+
-				"<b>Summary</b>\n<pre>%s</pre>\n"+
+				"<b>Summary</b>\n<pre>%s\n%s</pre>\n"+
 				"<b>Performance</b>\n<pre>%s</pre>",
 			u.Format(time.RFC822),
 			strings.Join(l[0:len(l)-1], "\n"),
-			l[len(l)-1:][0], g,
+			l[len(l)-1:][0], p, g,
 		))
 	case "/graph":
 		days := getIntFromCmd(cmd, 1, 7)
@@ -130,6 +204,60 @@ func (b *TelegramBot) onUpdate(update tgbotapi.Update) {
 			display.BmpGraphStyle{Width: 1280, Height: 480, MaxEntries: 6},
 		)
 		b.sendImageBuffer(g)
+	case "/bench":
+		days := getIntFromCmd(cmd, 1, 90)
+		g, err := display.TotalBmpGraph(
+			b.client,
+			days,
+			"",
+			display.BmpGraphStyle{Width: 1280, Height: 480, MaxEntries: 6, Benchmarks: true},
+		)
+		if err != nil {
+			b.sendTextMessage(fmt.Sprintf("Unable to compute benchmarks %v", err))
+			return
+		}
+		b.sendImageBuffer(g)
+	case "/project":
+		years := getIntFromCmd(cmd, 1, 5)
+		if years < 1 || years > analytics.MaxProjectionDays/365 {
+			b.sendTextMessage(fmt.Sprintf("Years must be between 1 and %d", analytics.MaxProjectionDays/365))
+			return
+		}
+		goal := b.client.GetGoal()
+		every := goal.EveryDays()
+		if every == 0 {
+			every = 30
+		}
+		p, err := b.client.GetProjection(365, analytics.ProjectionOptions{
+			Days:         365 * years,
+			Contribution: goal.Contribution,
+			Every:        every,
+			Goal:         goal.Value,
+			Runs:         1000,
+		})
+		if err != nil {
+			b.sendTextMessage(fmt.Sprintf("Unable to project %v", err))
+			return
+		}
+		t, _ := display.ProjectionAsciiTable(b.client, p, display.GetDefaultAsciiTableStyle())
+		g, err := display.ProjectionBmpGraph(p, display.BmpGraphStyle{Width: 1280, Height: 480})
+		if err == nil {
+			b.sendImageBuffer(g)
+		}
+		b.sendHtmlMessage(fmt.Sprintf("<b>Projection</b>\n<pre>%s</pre>", t))
+	case "/events":
+		days := getIntFromCmd(cmd, 1, 7)
+		events, err := b.client.GetEvents(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			b.sendTextMessage(fmt.Sprintf("Unable to get events %v", err))
+			return
+		}
+		if len(events) == 0 {
+			b.sendTextMessage(fmt.Sprintf("No events in the last %d days", days))
+			return
+		}
+		t, _ := display.EventsAsciiTable(b.client, events, display.GetDefaultAsciiTableStyle())
+		b.sendHtmlMessage(fmt.Sprintf("<b>Events</b>\n<pre>%s</pre>", t))
 	case "/allocation":
 		days := getIntFromCmd(cmd, 1, 7)
 		u := b.client.GetLastBalanceUpdate()
@@ -138,6 +266,57 @@ func (b *TelegramBot) onUpdate(update tgbotapi.Update) {
 			"<b>Update</b>\n%s\n<b>Allocation</b>\n<pre>%s</pre>",
 			u.Format(time.RFC822), t,
 		))
+	case "/group":
+		groupBy := getStrFromCmd(cmd, 1, data.GroupByWallet)
+		days := getIntFromCmd(cmd, 2, 7)
+		t, err := display.GroupAsciiTable(b.client, days, groupBy, display.GetDefaultAsciiTableStyle())
+		if err != nil {
+			b.sendTextMessage(fmt.Sprintf("Unable to group balances %v", err))
+			return
+		}
+		b.sendHtmlMessage(fmt.Sprintf(
+			"<b>Update</b>\n%s\n<b>By %s</b>\n<pre>%s</pre>",
+			b.client.GetLastBalanceUpdate().Format(time.RFC822), groupBy, t,
+		))
+	case "/pnl":
+		method := getStrFromCmd(cmd, 1, "")
+		t, err := display.CostBasisAsciiTable(b.client, method, display.GetDefaultAsciiTableStyle())
+		if err != nil {
+			b.sendTextMessage(fmt.Sprintf("Unable to compute cost basis %v", err))
+			return
+		}
+		b.sendHtmlMessage(fmt.Sprintf("<b>Cost basis</b>\n<pre>%s</pre>", t))
+	case "/rebalance":
+		t, err := display.RebalanceAsciiTable(b.client, display.GetDefaultAsciiTableStyle())
+		if err != nil {
+			b.sendTextMessage(fmt.Sprintf("Unable to compute rebalance %v", err))
+			return
+		}
+		b.sendHtmlMessage(fmt.Sprintf(
+			"<b>Update</b>\n%s\n<b>Rebalance</b>\n<pre>%s</pre>",
+			b.client.GetLastBalanceUpdate().Format(time.RFC822), t,
+		))
+	case "/portfolio":
+		name := getStrFromCmd(cmd, 1, "")
+		if name == "" {
+			t := ""
+			for _, p := range b.client.GetPortfolios() {
+				current := ""
+				if p.Name == b.client.GetPortfolio() {
+					current = " (selected)"
+				}
+				t = t + fmt.Sprintf("<b>%s</b>%s %s\n - %s\n", p.Name, current, p.Fiat, strings.Join(p.Wallets, ", "))
+			}
+			b.sendHtmlMessage(fmt.Sprintf("<b>Portfolios</b>\n%s", t))
+			return
+		}
+		c, err := b.client.WithPortfolio(name)
+		if err != nil {
+			b.sendTextMessage(fmt.Sprintf("Unable to select portfolio %v", err))
+			return
+		}
+		b.client = &c
+		b.sendHtmlMessage(fmt.Sprintf("Portfolio <b>%s</b> selected", c.GetPortfolio()))
 	case "/wallets":
 		balances := b.client.GetLastBalance()
 		t := ""
@@ -147,15 +326,15 @@ func (b *TelegramBot) onUpdate(update tgbotapi.Update) {
 				valid := false
 				thead := fmt.Sprintf(" - <b>%s</b>\n", strings.ToUpper(token))
 				for _, ba := range balances.Entries() {
-					if ba.Token == token && ba.Wallet == wallet && ba.Balance != 0 {
+					if ba.Token == token && ba.Wallet == wallet && !ba.Balance.IsZero() {
 						if !valid {
 							valid = true
 							t = t + thead
 						}
 						t = t + fmt.Sprintf(
 							"   - %s [%s%s] <pre>%s</pre>\n",
-							tools.HumanFloat64(ba.Balance),
-							tools.HumanFloat64(ba.FiatValue),
+							tools.HumanDecimal(ba.Balance),
+							tools.HumanDecimal(ba.FiatValue),
 							b.client.GetFiatSymbol(),
 							ba.Address,
 						)
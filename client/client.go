@@ -1,7 +1,11 @@
 package client
 
 import (
+	"fmt"
 	"github.com/scylladb/go-set"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/accounting"
+	"github.com/zooper-corp/CoinWatch/analytics"
 	"github.com/zooper-corp/CoinWatch/backend/price"
 	"github.com/zooper-corp/CoinWatch/backend/provider"
 	"github.com/zooper-corp/CoinWatch/config"
@@ -15,24 +19,53 @@ import (
 
 type Client struct {
 	config config.Config
-	db     data.Db
+	db     data.Store
+	prices price.CachedProvider
 }
 
-func New(configPath string, dbPath string) (Client, error) {
+// New returns a client of a portfolio, the first configured one if empty
+func New(configPath string, dbPath string, portfolio string) (Client, error) {
 	cfg, err := config.FromFile(configPath)
 	if err != nil {
 		return Client{}, err
 	}
-	db, err := data.FromFile(dbPath)
+	if cfg, err = cfg.ForPortfolio(portfolio); err != nil {
+		return Client{}, err
+	}
+	db, err := data.Open(dbPath)
 	if err != nil {
 		return Client{}, err
 	}
+	if _, err := db.Migrate(); err != nil {
+		return Client{}, err
+	}
 	return Client{
 		config: cfg,
 		db:     db,
+		prices: price.NewCachedProvider(price.New(&cfg, db), cfg.GetPriceCacheTTL()),
 	}, err
 }
 
+// WithPortfolio returns a client of another portfolio sharing the DB and price cache
+func (c Client) WithPortfolio(name string) (Client, error) {
+	cfg, err := c.config.ForPortfolio(name)
+	if err != nil {
+		return Client{}, err
+	}
+	c.config = cfg
+	return c, nil
+}
+
+// GetPortfolio returns the name of the portfolio of the client
+func (c Client) GetPortfolio() string {
+	return c.config.GetPortfolio().Name
+}
+
+// GetPortfolios returns every configured portfolio
+func (c Client) GetPortfolios() []config.Portfolio {
+	return c.config.GetPortfolios()
+}
+
 func (c Client) GetFiat() string {
 	return c.config.GetFiat()
 }
@@ -52,21 +85,341 @@ func (c Client) GetLastBalanceUpdate() time.Time {
 
 // GetLastBalance return last balance series
 func (c Client) GetLastBalance() data.Balances {
-	b, err := c.db.GetBalances(data.BalanceQueryOptions{Days: 7})
+	b, err := c.QueryBalance(data.BalanceQueryOptions{Days: 7})
 	if err != nil {
 		return data.Balances{}
 	}
 	return b.LastSample()
 }
 
-// QueryBalance will fetch data from the DB
+// QueryBalance will fetch data of the portfolio from the DB
 func (c Client) QueryBalance(options data.BalanceQueryOptions) (data.Balances, error) {
+	options.Portfolio = c.GetPortfolio()
 	return c.db.GetBalances(options)
 }
 
+// GetPrices returns current prices in fiat, recent quotes are shared between callers
+func (c Client) GetPrices(tokens []string) (data.TokenPrices, error) {
+	return c.prices.GetPrices(tokens, c.GetFiat())
+}
+
+// GetPriceCacheStats returns price cache counters
+func (c Client) GetPriceCacheStats() price.CacheStats {
+	return c.prices.Stats()
+}
+
+// GetTimeSeries returns balances of the portfolio sampled at regular intervals going back from now
+func (c Client) GetTimeSeries(options data.TimeSeriesOptions) ([]data.Balances, error) {
+	options.Portfolio = c.GetPortfolio()
+	return c.db.GetTimeSeries(options)
+}
+
+// Compact downsamples old snapshots using the configured retention tiers
+func (c Client) Compact(dryRun bool) (data.CompactResult, error) {
+	tiers := make([]data.RetentionTier, 0)
+	for _, rt := range c.config.GetRetentionTiers() {
+		tiers = append(tiers, data.RetentionTier{Age: rt.After, Interval: rt.Every})
+	}
+	return c.db.Compact(tiers, dryRun)
+}
+
+// Vacuum releases space freed by compaction
+func (c Client) Vacuum() error {
+	return c.db.Vacuum()
+}
+
+// IsAutoCompactEnabled is true if the update loop should compact the DB
+func (c Client) IsAutoCompactEnabled() bool {
+	return c.config.IsAutoCompactEnabled()
+}
+
+// Backup writes a timestamped copy of the DB to the configured dir and rotates old ones
+func (c Client) Backup() (string, error) {
+	cfg := c.config.GetBackup()
+	path := data.BackupPath(cfg.Dir, time.Now(), cfg.Gzip)
+	if err := c.db.Backup(path); err != nil {
+		return "", err
+	}
+	_, err := data.RotateBackups(cfg.Dir, cfg.Keep)
+	return path, err
+}
+
+// IsDailyBackupEnabled is true if the update loop should back up the DB
+func (c Client) IsDailyBackupEnabled() bool {
+	return c.config.GetBackup().Daily
+}
+
+// UpdateTransactions fetches new transactions of every wallet whose provider lists them, returns how many
+// were stored. A failing wallet does not stop the others, the first error is returned
+func (c Client) UpdateTransactions() (int, error) {
+	var firstErr error
+	total := 0
+	for _, wallet := range c.config.GetWallets() {
+		w := wallet
+		n, err := c.updateWalletTransactions(&w)
+		if err != nil {
+			log.Printf("Unable to update transactions of wallet %v: %v", w.Name, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		total += n
+	}
+	return total, firstErr
+}
+
+// GetTransactions returns stored transactions of the portfolio wallets, oldest first
+func (c Client) GetTransactions(options data.TransactionQueryOptions) ([]data.Transaction, error) {
+	// Wallets removed from the config still count without portfolios
+	if c.config.HasPortfolios() {
+		for _, w := range c.config.GetWallets() {
+			options.Wallets = append(options.Wallets, w.Name)
+		}
+	}
+	return c.db.GetTransactions(options)
+}
+
+// GetCostBasis matches all transactions with the given method, or the configured one when empty, and values
+// positions at current prices
+func (c Client) GetCostBasis(method string) (accounting.Report, error) {
+	report, err := c.computeCostBasis(method)
+	if err != nil {
+		return accounting.Report{}, err
+	}
+	if len(report.Positions) > 0 {
+		prices, err := c.GetPrices(report.Tokens())
+		if err != nil {
+			log.Printf("Some prices are missing for cost basis: %v", err)
+		}
+		report.SetPrices(prices)
+	}
+	return report, nil
+}
+
+// GetTaxReport returns disposals and staking income of a calendar year valued with stored prices
+func (c Client) GetTaxReport(year int, method string, longTerm time.Duration) (accounting.TaxReport, error) {
+	report, err := c.computeCostBasis(method)
+	if err != nil {
+		return accounting.TaxReport{}, err
+	}
+	return accounting.NewTaxReport(report, year, longTerm, time.Local), nil
+}
+
+func (c Client) computeCostBasis(method string) (accounting.Report, error) {
+	if method == "" {
+		method = c.config.GetCostBasisMethod()
+	}
+	transactions, err := c.GetTransactions(data.TransactionQueryOptions{})
+	if err != nil {
+		return accounting.Report{}, err
+	}
+	return accounting.Compute(transactions, method, c.GetFiat(), c.getPriceAt)
+}
+
+// getPriceAt returns the stored price closest to at
+func (c Client) getPriceAt(token string, at time.Time) (decimal.Decimal, bool) {
+	p, found, err := c.db.GetPriceAt(token, c.GetFiat(), at, c.config.GetPriceMaxAge())
+	if err != nil {
+		log.Printf("Unable to get %v price at %v: %v", token, at, err)
+		return decimal.Zero, false
+	}
+	return p.Price, found
+}
+
+// GetFlows returns deposits and withdrawals since from valued in fiat, from ledgers and from the config.
+// A ledger movement without a stored price is left out and shows up as performance
+func (c Client) GetFlows(from time.Time) ([]data.Flow, error) {
+	transactions, err := c.GetTransactions(data.TransactionQueryOptions{From: from})
+	if err != nil {
+		return nil, err
+	}
+	r := make([]data.Flow, 0)
+	for _, tx := range transactions {
+		if !tx.IsExternal() {
+			continue
+		}
+		price := decimal.NewFromInt(1)
+		if !strings.EqualFold(tx.Token, c.GetFiat()) {
+			p, found := c.getPriceAt(tx.Token, tx.Timestamp)
+			if !found {
+				log.Printf("No %v price for flow %v at %v", tx.Token, tx.TxId, tx.Timestamp)
+				continue
+			}
+			price = p
+		}
+		r = append(r, data.Flow{Timestamp: tx.Timestamp, Value: tx.Amount.Mul(price)})
+	}
+	for _, f := range c.config.GetFlows() {
+		// Checked when loading config
+		ts, _ := f.Time()
+		if !ts.Before(from) {
+			r = append(r, data.Flow{Timestamp: ts, Value: f.Value})
+		}
+	}
+	return r, nil
+}
+
+// GetPerformance returns flow adjusted returns between now and x days ago
+func (c Client) GetPerformance(days int) (data.Performance, error) {
+	bs, err := c.QueryBalance(data.BalanceQueryOptions{Days: days})
+	if err != nil {
+		return data.Performance{}, err
+	}
+	flows, err := c.GetFlows(time.Now().AddDate(0, 0, -days-1))
+	if err != nil {
+		return data.Performance{}, err
+	}
+	return bs.Performance(days, flows), nil
+}
+
+// GetStats returns risk and performance stats of daily snapshots between now and x days ago compared with BTC
+// and ETH stored prices, window is the amount of days of rolling volatility and riskFree an annual rate
+func (c Client) GetStats(days int, window int, riskFree float64) (analytics.Stats, error) {
+	points, err := c.dailyPoints(days)
+	if err != nil {
+		return analytics.Stats{}, err
+	}
+	if len(points) == 0 {
+		return analytics.Stats{}, nil
+	}
+	flows, err := c.GetFlows(points[0].Timestamp)
+	if err != nil {
+		return analytics.Stats{}, err
+	}
+	benchmarks := make(map[string][]analytics.Point)
+	for _, token := range analytics.Benchmarks {
+		for _, p := range points {
+			if price, found := c.getPriceAt(token, p.Timestamp); found {
+				benchmarks[token] = append(benchmarks[token], analytics.Point{Timestamp: p.Timestamp, Value: price.InexactFloat64()})
+			}
+		}
+	}
+	return analytics.Compute(points, flows, benchmarks, analytics.Options{Window: window, RiskFree: riskFree}), nil
+}
+
+// GetStakingYields returns what staked balances earned between now and x days ago, keyed by Balance.Id
+func (c Client) GetStakingYields(days int) (map[string]analytics.Yield, error) {
+	bs, err := c.QueryBalance(data.BalanceQueryOptions{Days: days})
+	if err != nil {
+		return nil, err
+	}
+	ledger, err := c.GetLedger(time.Now().AddDate(0, 0, -days-1))
+	if err != nil {
+		return nil, err
+	}
+	return analytics.StakingYields(bs, ledger), nil
+}
+
+// GetLedger returns transactions since from of every wallet whose transactions were ever fetched
+func (c Client) GetLedger(from time.Time) (analytics.Ledger, error) {
+	r := make(analytics.Ledger)
+	for _, w := range c.config.GetWallets() {
+		cursors, err := c.db.GetTransactionCursors(w.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(cursors) == 0 {
+			continue
+		}
+		txs, err := c.db.GetTransactions(data.TransactionQueryOptions{From: from, Wallet: w.Name})
+		if err != nil {
+			return nil, err
+		}
+		r[strings.ToLower(w.Name)] = txs
+	}
+	return r, nil
+}
+
+// GetRebalance compares the last balance with configured targets
+func (c Client) GetRebalance() (analytics.RebalanceReport, error) {
+	cfg := c.config.GetRebalance()
+	if len(cfg.Targets) == 0 {
+		return analytics.RebalanceReport{}, fmt.Errorf("no rebalance targets in config")
+	}
+	tags := c.config.GetTags()
+	targets := make([]analytics.Target, 0)
+	for _, t := range cfg.Targets {
+		if t.Tag != "" {
+			targets = append(targets, analytics.Target{Name: strings.ToLower(t.Tag), Tokens: tags[strings.ToLower(t.Tag)], Weight: t.Weight})
+		} else {
+			targets = append(targets, analytics.Target{Name: strings.ToUpper(t.Token), Tokens: []string{t.Token}, Weight: t.Weight})
+		}
+	}
+	return analytics.Rebalance(c.GetLastBalance(), targets, cfg.Band), nil
+}
+
+// GetBenchmarks compares daily portfolio values between now and x days ago with holding only BTC, only ETH or the
+// configured baskets, benchmarks are valued with stored prices
+func (c Client) GetBenchmarks(days int) (analytics.Comparison, error) {
+	points, err := c.dailyPoints(days)
+	if err != nil {
+		return analytics.Comparison{}, err
+	}
+	if len(points) == 0 {
+		return analytics.Compare(points, nil, nil, c.getPriceAt), nil
+	}
+	flows, err := c.GetFlows(points[0].Timestamp)
+	if err != nil {
+		return analytics.Comparison{}, err
+	}
+	baskets := analytics.BasketsOf(analytics.Benchmarks)
+	for _, b := range c.config.GetBaskets() {
+		baskets = append(baskets, analytics.Basket{Name: b.Name, Weights: b.Weights})
+	}
+	return analytics.Compare(points, flows, baskets, c.getPriceAt), nil
+}
+
+// GetGoal returns the configured goal of the portfolio
+func (c Client) GetGoal() config.Goal {
+	return c.config.GetGoal()
+}
+
+// GetProjection simulates the portfolio value with returns drawn from daily snapshots of the last history days
+func (c Client) GetProjection(history int, options analytics.ProjectionOptions) (analytics.Projection, error) {
+	points, err := c.dailyPoints(history)
+	if err != nil {
+		return analytics.Projection{}, err
+	}
+	if len(points) == 0 {
+		return analytics.Projection{}, fmt.Errorf("no balance history to project from")
+	}
+	flows, err := c.GetFlows(points[0].Timestamp)
+	if err != nil {
+		return analytics.Projection{}, err
+	}
+	p, ok := analytics.Project(points, flows, options)
+	if !ok {
+		return p, fmt.Errorf("not enough history to project, at least two daily snapshots are needed")
+	}
+	return p, nil
+}
+
+// dailyPoints returns the total value of one snapshot a day between now and x days ago, oldest first
+func (c Client) dailyPoints(days int) ([]analytics.Point, error) {
+	series, err := c.GetTimeSeries(data.TimeSeriesOptions{Amount: days + 1, Interval: time.Hour * 24, GroupBy: data.GroupByToken})
+	if err != nil {
+		return nil, err
+	}
+	// Buckets filled with a neighbour snapshot are the same point
+	points := make([]analytics.Point, 0)
+	for i := len(series) - 1; i >= 0; i-- {
+		entries := series[i].Entries()
+		if len(entries) == 0 {
+			continue
+		}
+		ts := entries[0].Timestamp
+		if len(points) > 0 && !ts.After(points[len(points)-1].Timestamp) {
+			continue
+		}
+		points = append(points, analytics.Point{Timestamp: ts, Value: series[i].TotalFiatValue().InexactFloat64()})
+	}
+	return points, nil
+}
+
 // Get balance within range
 func (c Client) GetBalancesFromDate(from time.Time) (data.Balances, error) {
-	return c.db.GetBalancesFromDate(from)
+	return c.db.GetBalancesFromDate(from, c.GetPortfolio())
 }
 
 // UpdateBalance will update the balance for each wallet if rs exceeds updateTtlSeconds
@@ -82,7 +435,7 @@ func (c Client) UpdateBalance(updateTtlSeconds int64) error {
 		log.Fatalf("No wallet configured")
 	}
 	// Get current balances, we must update daily so just get last day results
-	balances, err := c.db.GetBalances(data.BalanceQueryOptions{Days: 1})
+	balances, err := c.QueryBalance(data.BalanceQueryOptions{Days: 1})
 	if err != nil {
 		log.Fatalf("Unable to get balances from DB: %v", err)
 	}
@@ -150,41 +503,91 @@ func (c Client) UpdateBalance(updateTtlSeconds int64) error {
 	}
 	// Update prices
 	log.Println("Updating prices")
-	priceProvider := price.New(c.config.GetTokenConfigs(), c.db, c.config.GetHttpClient())
-	prices, err := priceProvider.GetPrices(tokens.List(), c.config.GetFiat())
-	if err != nil {
-		return err
+	prices, priceErr := c.GetPrices(tokens.List())
+	if priceErr != nil {
+		// Missing prices are skipped, do not lose the whole snapshot
+		if len(prices.Entries) == 0 {
+			return priceErr
+		}
+		log.Printf("Some prices are missing, updating anyway: %v", priceErr)
+	}
+	if err := c.db.InsertPrices(prices); err != nil {
+		log.Printf("Unable to store prices: %v", err)
 	}
-	// Update DB, our TS is our ID
+	// Update DB, all balances of this update are written at once
 	ts := start.Truncate(time.Second)
+	entries := make([]data.Balance, 0)
+	reported := make([]data.Balance, 0, len(updatedBalances))
 	for _, b := range updatedBalances {
-		p := 1.0
+		p := decimal.NewFromInt(1)
+		stale, priced := false, true
 		if !strings.EqualFold(b.Symbol, c.GetFiat()) {
 			p = prices.GetPrice(b.Symbol)
+			var tp data.TokenPrice
+			tp, priced = prices.Get(b.Symbol)
+			// Tokens without any price are kept at zero and flagged like stale ones
+			stale = tp.Stale || !priced
 		}
-		value := b.Balance * p
-		if float32(value) > c.config.GetFiatMin() {
-			entry := data.Balance{
-				Timestamp:     ts,
-				Wallet:        b.Wallet,
-				Token:         b.Symbol,
-				Address:       b.Address,
-				Balance:       b.Balance,
-				BalanceLocked: b.Locked,
-				FiatValue:     value,
-			}
-			err := c.db.InsertBalance(entry)
-			if err != nil {
-				return err
-			}
+		entry := data.Balance{
+			Timestamp:     ts,
+			Wallet:        b.Wallet,
+			Token:         b.Symbol,
+			Address:       b.Address,
+			Balance:       b.Balance,
+			BalanceLocked: b.Locked,
+			FiatValue:     b.Balance.Mul(p),
+			StalePrice:    stale,
 		}
+		reported = append(reported, entry)
+		// Unpriced balances are not dust, dropping them would lose the token until a price is back
+		if entry.FiatValue.GreaterThan(c.config.GetFiatMin()) || (!priced && entry.Balance.IsPositive()) {
+			entries = append(entries, entry)
+		}
+	}
+	status := data.SnapshotComplete
+	if priceErr != nil {
+		status = data.SnapshotPartial
+	}
+	previous := c.previousSample(balances)
+	snapshot, err := c.db.InsertSnapshot(data.Snapshot{
+		Timestamp: ts,
+		Status:    status,
+		Wallets:   len(wallets),
+		Fiat:      c.GetFiat(),
+		Portfolio: c.GetPortfolio(),
+	}, entries)
+	if err != nil {
+		return err
 	}
+	// Compare with the previous snapshot, anomalies never fail the update
+	c.checkAnomalies(previous, reported, snapshot)
 	// Done
 	return nil
 }
 
+func (c *Client) updateWalletTransactions(wallet *config.Wallet) (int, error) {
+	bp, err := provider.New(wallet, c.db, c.config.GetHttpClient())
+	if err != nil {
+		return 0, err
+	}
+	tp, ok := bp.(provider.TransactionProvider)
+	if !ok {
+		return 0, nil
+	}
+	cursors, err := c.db.GetTransactionCursors(wallet.Name)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Updating transactions of wallet %v from %s\n", wallet.Name, wallet.Provider.Name)
+	transactions, next, err := tp.GetTransactions(cursors)
+	if err != nil {
+		return 0, err
+	}
+	return c.db.InsertTransactions(wallet.Name, transactions, next)
+}
+
 func (c *Client) updateWallet(wallet *config.Wallet) ([]data.TokenBalance, error) {
-	bp, err := provider.New(wallet, c.config.GetHttpClient())
+	bp, err := provider.New(wallet, c.db, c.config.GetHttpClient())
 	if err != nil {
 		log.Printf("Cannot get balance provider for wallet %v\n", wallet.Name)
 		return nil, err
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"fmt"
+	"github.com/scylladb/go-set"
+	"github.com/zooper-corp/CoinWatch/backend/price/gecko"
+	"github.com/zooper-corp/CoinWatch/config"
+	"sort"
+	"strings"
+)
+
+// PriceSource describes where the price of a token comes from
+type PriceSource struct {
+	Symbol     string
+	Source     string
+	Id         string
+	Candidates []string
+}
+
+// Ambiguous is true if the token symbol maps to more than one market coin
+func (ps PriceSource) Ambiguous() bool {
+	return len(ps.Candidates) > 1
+}
+
+// CheckPriceSources resolves the price source of every configured or stored token
+func (c Client) CheckPriceSources() ([]PriceSource, error) {
+	tokens := set.NewStringSet()
+	for _, w := range c.config.GetWallets() {
+		for _, f := range w.Filters {
+			tokens.Add(strings.ToUpper(f.Symbol))
+		}
+	}
+	for _, t := range c.GetLastBalance().Tokens() {
+		tokens.Add(strings.ToUpper(t))
+	}
+	tokens.Remove(strings.ToUpper(c.GetFiat()))
+	r := make([]PriceSource, 0)
+	// Pricing rules come first
+	market := make([]string, 0)
+	for _, t := range tokens.List() {
+		ruled := false
+		for _, pr := range c.config.GetPricingRules() {
+			if strings.EqualFold(pr.Symbol, t) {
+				ruled = true
+				r = append(r, PriceSource{Symbol: t, Source: "rule", Id: ruleDescription(pr)})
+				break
+			}
+		}
+		if !ruled {
+			market = append(market, t)
+		}
+	}
+	// Then CoinGecko
+	resolutions, err := gecko.New(c.config.GetTokenConfigs(), c.db).Resolve(market)
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range resolutions {
+		candidates := make([]string, 0)
+		for _, cd := range res.Candidates {
+			candidates = append(candidates, cd.CoinId)
+		}
+		r = append(r, PriceSource{
+			Symbol:     strings.ToUpper(res.Symbol),
+			Source:     "gecko/" + res.Source,
+			Id:         res.Coin.CoinId,
+			Candidates: candidates,
+		})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Symbol < r[j].Symbol
+	})
+	return r, nil
+}
+
+func ruleDescription(pr config.PricingRule) string {
+	switch {
+	case pr.Peg != "":
+		return fmt.Sprintf("peg:%s", strings.ToUpper(pr.Peg))
+	case pr.Formula != "":
+		return pr.Formula
+	default:
+		return fmt.Sprintf("fixed:%v", pr.Price)
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/zooper-corp/CoinWatch/analytics"
+	"github.com/zooper-corp/CoinWatch/data"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// previousSampleDays is how far back the previous snapshot is looked for when the last day has none
+const previousSampleDays = 31
+
+// GetEvents returns anomalies of the portfolio found since from, most recent first
+func (c Client) GetEvents(from time.Time) ([]data.Event, error) {
+	return c.db.GetEvents(data.EventQueryOptions{From: from, Portfolio: c.GetPortfolio()})
+}
+
+// previousSample returns the last sample before the update, looking further back when recent balances are empty
+func (c Client) previousSample(recent data.Balances) data.Balances {
+	if len(recent.Entries()) > 0 {
+		return recent.LastSample()
+	}
+	balances, err := c.QueryBalance(data.BalanceQueryOptions{Days: previousSampleDays})
+	if err != nil {
+		log.Printf("Unable to get previous balances: %v", err)
+		return data.Balances{}
+	}
+	return balances.LastSample()
+}
+
+// checkAnomalies compares reported balances of snapshot with the previous sample and the tokens held so far,
+// stores what it finds and posts it to the webhook. Failures are only logged
+func (c Client) checkAnomalies(previous data.Balances, reported []data.Balance, snapshot data.Snapshot) {
+	held, err := c.db.GetHeldTokens(snapshot.Portfolio)
+	if err != nil {
+		log.Printf("Unable to get held tokens: %v", err)
+	}
+	if err := c.db.InsertHeldTokens(snapshot.Portfolio, snapshot.Timestamp, reported); err != nil {
+		log.Printf("Unable to store held tokens: %v", err)
+	}
+	settings := c.config.GetAnomalies()
+	// Wallets removed from the config are not missing
+	if len(settings.Wallets) == 0 {
+		for _, w := range c.config.GetWallets() {
+			settings.Wallets = append(settings.Wallets, strings.ToLower(w.Name))
+		}
+	}
+	events := analytics.DetectAnomalies(previous.Entries(), reported, analytics.AnomalyOptions{
+		Drop:     settings.Drop,
+		MinValue: settings.MinValue,
+		FiatMin:  c.config.GetFiatMin(),
+		Wallets:  settings.Wallets,
+		Held:     held,
+	})
+	if len(events) == 0 {
+		return
+	}
+	for i := range events {
+		events[i].Timestamp = snapshot.Timestamp
+		events[i].SnapshotId = snapshot.Id
+		events[i].Portfolio = snapshot.Portfolio
+	}
+	log.Printf("Found %d balance anomalies", len(events))
+	if err := c.db.InsertEvents(events); err != nil {
+		log.Printf("Unable to store events: %v", err)
+	}
+	if settings.Webhook != "" {
+		if err := c.postEvents(settings.Webhook, events); err != nil {
+			log.Printf("Unable to post events to webhook: %v", err)
+		}
+	}
+}
+
+// postEvents sends events as a JSON array
+func (c Client) postEvents(uri string, events []data.Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", uri, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err, code, _ := tools.ReadHTTPRequest(req, c.config.GetHttpClient())
+	// Any success code is fine, hooks often reply without content
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	return fmt.Errorf("status %d: %v", code, err)
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"fmt"
+	"github.com/zooper-corp/CoinWatch/config"
+	"github.com/zooper-corp/CoinWatch/data"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"strings"
+)
+
+const (
+	chainTagPrefix = "chain:"
+	untagged       = "untagged"
+	unknownGroup   = "unknown"
+)
+
+// providerChains is the chain of providers tracking a single one
+var providerChains = map[string]string{
+	"etherscan":    "ethereum",
+	"blockcypher":  "bitcoin",
+	"algoexplorer": "algorand",
+	"minaexplorer": "mina",
+}
+
+// GroupByOptions lists supported group by values
+var GroupByOptions = []string{data.GroupByToken, data.GroupByWallet, data.GroupByTag, data.GroupByChain, data.GroupByProvider}
+
+// GroupBalances sums balances of every snapshot by token, wallet, tag, chain or provider. Balances with several
+// tags are counted in each of them
+func (c Client) GroupBalances(bs data.Balances, groupBy string) (data.Balances, error) {
+	wallets := make(map[string]config.Wallet)
+	for _, w := range c.config.GetWallets() {
+		wallets[strings.ToLower(w.Name)] = w
+	}
+	var keys func(b data.Balance) []string
+	switch strings.ToLower(groupBy) {
+	case data.GroupByToken, data.GroupByNone:
+		return bs.GroupBySymbol(), nil
+	case data.GroupByWallet:
+		keys = func(b data.Balance) []string {
+			return []string{b.Wallet}
+		}
+	case data.GroupByProvider:
+		keys = func(b data.Balance) []string {
+			if w, ok := wallets[strings.ToLower(b.Wallet)]; ok {
+				return []string{strings.ToLower(w.Provider.Name)}
+			}
+			return []string{unknownGroup}
+		}
+	case data.GroupByTag:
+		keys = func(b data.Balance) []string {
+			if tags := c.balanceTags(wallets, b); len(tags) > 0 {
+				return tags
+			}
+			return []string{untagged}
+		}
+	case data.GroupByChain:
+		keys = func(b data.Balance) []string {
+			return []string{c.balanceChain(wallets, b)}
+		}
+	default:
+		return data.Balances{}, fmt.Errorf("unknown group by '%v', use one of %v", groupBy, strings.Join(GroupByOptions, ", "))
+	}
+	return bs.GroupByKeys(keys), nil
+}
+
+// balanceTags returns tags of the wallet and of the token
+func (c Client) balanceTags(wallets map[string]config.Wallet, b data.Balance) []string {
+	r := make([]string, 0)
+	if w, ok := wallets[strings.ToLower(b.Wallet)]; ok {
+		r = append(r, w.Tags...)
+	}
+	for _, tag := range c.config.GetTokenTags(b.Token) {
+		if !tools.StringInSlice(tag, r) {
+			r = append(r, tag)
+		}
+	}
+	return r
+}
+
+// balanceChain picks a chain:name tag, then the network of the token config and finally the provider chain
+func (c Client) balanceChain(wallets map[string]config.Wallet, b data.Balance) string {
+	for _, tag := range c.balanceTags(wallets, b) {
+		if strings.HasPrefix(tag, chainTagPrefix) {
+			return strings.TrimPrefix(tag, chainTagPrefix)
+		}
+	}
+	w, ok := wallets[strings.ToLower(b.Wallet)]
+	if !ok {
+		return unknownGroup
+	}
+	for _, f := range w.Filters {
+		contract := strings.ToLower(f.Config.Contract)
+		if strings.EqualFold(f.Symbol, b.Token) && contract != "" && !strings.HasPrefix(contract, "0x") {
+			return contract
+		}
+	}
+	provider := strings.ToLower(w.Provider.Name)
+	if chain, ok := providerChains[provider]; ok {
+		return chain
+	}
+	return provider
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/zooper-corp/CoinWatch/client"
 	"github.com/zooper-corp/CoinWatch/display"
+	"strings"
 )
 
 // dumpCmd represents the dump command
@@ -14,9 +15,11 @@ var dumpCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		configPath, _ := cmd.Flags().GetString("config")
 		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
 		skipUpdate, _ := cmd.Flags().GetBool("skip-update")
 		minUpdate, _ := cmd.Flags().GetInt("min-update")
-		c, err := client.New(configPath, dbPath)
+		groupBy, _ := cmd.Flags().GetString("group-by")
+		c, err := client.New(configPath, dbPath, portfolio)
 		if err != nil {
 			fatal("Unable to create client: %v\n", err)
 		}
@@ -29,11 +32,21 @@ var dumpCmd = &cobra.Command{
 		style := display.GetDefaultAsciiTableStyle()
 		style.Style = display.Wide
 		style.Borders = true
-		table, err := display.SummaryAsciiTable(&c, 7, style)
+		var table string
+		if groupBy == "" {
+			table, err = display.SummaryAsciiTable(&c, 7, style)
+		} else {
+			table, err = display.GroupAsciiTable(&c, 7, groupBy, style)
+		}
 		if err != nil {
 			fatal("Unable to dump table: %v", err)
 		}
 		fmt.Println(table)
+		performance, err := display.PerformanceText(&c, 7)
+		if err != nil {
+			fatal("Unable to compute performance: %v", err)
+		}
+		fmt.Println(performance)
 		graph, err := display.TotalAsciiGraph(&c, 7, display.GetDefaultAsciiGraphStyle())
 		if err != nil {
 			fatal("Unable to dump graph: %v", err)
@@ -46,4 +59,5 @@ func init() {
 	rootCmd.AddCommand(dumpCmd)
 	dumpCmd.Flags().BoolP("skip-update", "s", false, "Do not update balances and prices")
 	dumpCmd.Flags().IntP("min-update", "m", 15, "Minimum time in minutes between updates")
+	dumpCmd.Flags().StringP("group-by", "g", "", fmt.Sprintf("Show totals per %v instead of tokens", strings.Join(client.GroupByOptions, ", ")))
 }
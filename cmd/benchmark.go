@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/display"
+)
+
+var benchmarkCmd = &cobra.Command{
+	Use:   "benchmark",
+	Short: "Compare portfolio returns with holding only BTC, only ETH or the configured baskets",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		days, _ := cmd.Flags().GetInt("days")
+		if days < 1 {
+			fatal("Days must be at least 1\n")
+		}
+		c, err := client.New(configPath, dbPath, portfolio)
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		style := display.GetDefaultAsciiTableStyle()
+		style.Borders = true
+		table, err := display.BenchmarkAsciiTable(&c, days, style)
+		if err != nil {
+			fatal("Unable to compute benchmarks: %v\n", err)
+		}
+		fmt.Println(table)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchmarkCmd)
+	benchmarkCmd.Flags().IntP("days", "d", 90, "Days of history")
+}
@@ -19,7 +19,8 @@ var botCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		configPath, _ := cmd.Flags().GetString("config")
 		dbPath, _ := cmd.Flags().GetString("db-path")
-		c, err := client.New(configPath, dbPath)
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		c, err := client.New(configPath, dbPath, portfolio)
 		if err != nil {
 			fatal("Unable to create client: %v", err)
 		}
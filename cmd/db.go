@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/config"
+	"github.com/zooper-corp/CoinWatch/data"
+	"time"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Database maintenance commands",
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending schema migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		statusOnly, _ := cmd.Flags().GetBool("status")
+		d, err := data.Open(dbPath)
+		if err != nil {
+			fatal("Unable to open DB: %v\n", err)
+		}
+		if statusOnly {
+			versions, err := d.SchemaVersions()
+			if err != nil {
+				fatal("Unable to read schema version: %v\n", err)
+			}
+			for _, v := range versions {
+				fmt.Printf("applied %d %s (%s)\n", v.Version, v.Name, v.Applied.Format("2006-01-02 15:04"))
+			}
+			pending, err := d.PendingMigrations()
+			if err != nil {
+				fatal("Unable to read pending migrations: %v\n", err)
+			}
+			for _, p := range pending {
+				fmt.Printf("pending %s\n", p)
+			}
+			return
+		}
+		applied, err := d.Migrate()
+		for _, v := range applied {
+			fmt.Printf("applied %d %s\n", v.Version, v.Name)
+		}
+		if err != nil {
+			fatal("Migration failed: %v\n", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+	},
+}
+
+var dbCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Downsample old snapshots using the configured retention tiers",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		vacuum, _ := cmd.Flags().GetBool("vacuum")
+		// Retention applies to every portfolio
+		c, err := client.New(configPath, dbPath, "")
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		r, err := c.Compact(dryRun)
+		if err != nil {
+			fatal("Compaction failed: %v\n", err)
+		}
+		if dryRun {
+			fmt.Printf("Would remove %d snapshots and %d balances, keeping %d old snapshots\n", r.Snapshots, r.Balances, r.Kept)
+			return
+		}
+		fmt.Printf("Removed %d snapshots and %d balances, kept %d old snapshots\n", r.Snapshots, r.Balances, r.Kept)
+		if vacuum {
+			if err := c.Vacuum(); err != nil {
+				fatal("Vacuum failed: %v\n", err)
+			}
+			fmt.Println("Vacuum done")
+		}
+	},
+}
+
+var dbBackupCmd = &cobra.Command{
+	Use:   "backup [file]",
+	Short: "Copy the SQLite DB while it is in use, to file or to a timestamped file in --dir",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		configPath, _ := cmd.Flags().GetString("config")
+		// Flags not given fall back to the backup settings of the config, or their defaults without one
+		settings := config.DefaultBackup()
+		if cfg, err := config.FromFile(configPath); err == nil {
+			settings = cfg.GetBackup()
+		}
+		dir, compress, keep := settings.Dir, settings.Gzip, settings.Keep
+		if cmd.Flags().Changed("dir") {
+			dir, _ = cmd.Flags().GetString("dir")
+		}
+		if cmd.Flags().Changed("gzip") {
+			compress, _ = cmd.Flags().GetBool("gzip")
+		}
+		if cmd.Flags().Changed("keep") {
+			keep, _ = cmd.Flags().GetInt("keep")
+		}
+		d, err := data.Open(dbPath)
+		if err != nil {
+			fatal("Unable to open DB: %v\n", err)
+		}
+		path := data.BackupPath(dir, time.Now(), compress)
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if err := d.Backup(path); err != nil {
+			fatal("Backup failed: %v\n", err)
+		}
+		fmt.Printf("Backup written to %v\n", path)
+		if len(args) == 0 {
+			removed, err := data.RotateBackups(dir, keep)
+			if err != nil {
+				fatal("Unable to rotate backups: %v\n", err)
+			}
+			for _, r := range removed {
+				fmt.Printf("Removed %v\n", r)
+			}
+		}
+	},
+}
+
+var dbRestoreCmd = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "Replace the SQLite DB content with a backup, gzip backups are supported",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		// A corrupted DB fails to open, restore works anyway
+		d, err := data.Open(dbPath)
+		if err != nil {
+			fmt.Printf("Current DB is not readable: %v\n", err)
+		}
+		if err := d.Restore(args[0]); err != nil {
+			fatal("Restore failed: %v\n", err)
+		}
+		fmt.Printf("Restored %v from %v\n", dbPath, args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbMigrateCmd.Flags().Bool("status", false, "Only show applied and pending migrations")
+	dbCmd.AddCommand(dbCompactCmd)
+	dbCompactCmd.Flags().Bool("dry-run", false, "Only count what would be removed")
+	dbCompactCmd.Flags().Bool("vacuum", false, "Reclaim disk space after compaction")
+	dbCmd.AddCommand(dbBackupCmd)
+	dbBackupCmd.Flags().String("dir", "", "Backup directory when no file is given, backup.dir of the config by default")
+	dbBackupCmd.Flags().BoolP("gzip", "z", false, "Compress the backup, backup.gzip of the config by default")
+	dbBackupCmd.Flags().Int("keep", 0, "Keep only the last N backups in --dir, 0 keeps all, backup.keep of the config by default")
+	dbCmd.AddCommand(dbRestoreCmd)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/display"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check configuration and price sources of every token",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		c, err := client.New(configPath, dbPath, portfolio)
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		style := display.GetDefaultAsciiTableStyle()
+		style.Borders = true
+		table, err := display.DoctorAsciiTable(&c, style)
+		if err != nil {
+			fatal("Unable to check price sources: %v\n", err)
+		}
+		fmt.Println(table)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
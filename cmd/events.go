@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/display"
+	"time"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "List balance drops, missing addresses and new tokens found by updates",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		days, _ := cmd.Flags().GetInt("days")
+		c, err := client.New(configPath, dbPath, portfolio)
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		events, err := c.GetEvents(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			fatal("Unable to get events: %v\n", err)
+		}
+		style := display.GetDefaultAsciiTableStyle()
+		style.Style = display.Wide
+		style.Borders = true
+		table, err := display.EventsAsciiTable(&c, events, style)
+		if err != nil {
+			fatal("Unable to dump events: %v\n", err)
+		}
+		fmt.Println(table)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().Int("days", 30, "Days of events to list")
+}
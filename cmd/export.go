@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/data"
+	"github.com/zooper-corp/CoinWatch/export"
+	"time"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export snapshots, balances and prices of a time range to CSV, JSON Lines or Parquet",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		from, err := parseDateFlag(cmd, "from", time.Unix(0, 0))
+		if err != nil {
+			fatal("Invalid from date: %v\n", err)
+		}
+		to, err := parseDateFlag(cmd, "to", time.Now().Add(time.Second))
+		if err != nil {
+			fatal("Invalid to date: %v\n", err)
+		}
+		d, err := data.Open(dbPath)
+		if err != nil {
+			fatal("Unable to open DB: %v\n", err)
+		}
+		if _, err := d.Migrate(); err != nil {
+			fatal("Migration failed: %v\n", err)
+		}
+		dump, err := d.Export(from, to)
+		if err != nil {
+			fatal("Export failed: %v\n", err)
+		}
+		files, err := export.Write(dump, output, format)
+		if err != nil {
+			fatal("Export failed: %v\n", err)
+		}
+		fmt.Printf("Exported %d snapshots, %d balances and %d prices\n", len(dump.Snapshots), len(dump.Balances), len(dump.Prices))
+		for _, f := range files {
+			fmt.Println(f)
+		}
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <path>",
+	Short: "Import snapshots, balances and prices from an export directory or a single file",
+	Long: `Import reads a directory written by export or a single file. Files named snapshots, balances or prices
+are read as such, any other file is read as balances. CSV columns are matched by header, only timestamp,
+token and balance are required. Rows already in the DB are skipped so importing twice is safe.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		format, _ := cmd.Flags().GetString("format")
+		dump, err := export.Read(args[0], format)
+		if err != nil {
+			fatal("Unable to read %v: %v\n", args[0], err)
+		}
+		d, err := data.Open(dbPath)
+		if err != nil {
+			fatal("Unable to open DB: %v\n", err)
+		}
+		if _, err := d.Migrate(); err != nil {
+			fatal("Migration failed: %v\n", err)
+		}
+		r, err := d.Import(dump)
+		if err != nil {
+			fatal("Import failed: %v\n", err)
+		}
+		fmt.Printf("Imported %d snapshots, %d balances and %d prices, skipped %d existing rows\n", r.Snapshots, r.Balances, r.Prices, r.Skipped)
+	},
+}
+
+// parseDateFlag reads a YYYY-MM-DD flag in local time
+func parseDateFlag(cmd *cobra.Command, name string, fallback time.Time) (time.Time, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringP("format", "f", export.FormatCsv, "Output format: csv, jsonl or parquet")
+	exportCmd.Flags().String("from", "", "First day to export (YYYY-MM-DD), defaults to all history")
+	exportCmd.Flags().String("to", "", "Day to stop at, excluded (YYYY-MM-DD), defaults to now")
+	exportCmd.Flags().StringP("output", "o", ".", "Output directory")
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringP("format", "f", "", "Input format: csv, jsonl or parquet, guessed from extension when empty")
+}
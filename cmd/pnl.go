@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/accounting"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/display"
+	"strings"
+)
+
+var pnlCmd = &cobra.Command{
+	Use:   "pnl",
+	Short: "Show cost basis, realized and unrealized gains per token from stored transactions",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		method, _ := cmd.Flags().GetString("method")
+		c, err := client.New(configPath, dbPath, portfolio)
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		style := display.GetDefaultAsciiTableStyle()
+		style.Style = display.Wide
+		style.Borders = true
+		table, err := display.CostBasisAsciiTable(&c, method, style)
+		if err != nil {
+			fatal("Unable to compute cost basis: %v\n", err)
+		}
+		fmt.Println(table)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pnlCmd)
+	pnlCmd.Flags().StringP("method", "m", "", fmt.Sprintf("Lot matching method: %v, defaults to globals.cost_basis", strings.Join(accounting.Methods, ", ")))
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/analytics"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/display"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"io/ioutil"
+)
+
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Project the portfolio value and time to goal with Monte Carlo runs of historical returns",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		days, _ := cmd.Flags().GetInt("days")
+		history, _ := cmd.Flags().GetInt("history")
+		runs, _ := cmd.Flags().GetInt("runs")
+		output, _ := cmd.Flags().GetString("output")
+		if days < 1 || history < 2 || runs < 1 {
+			fatal("Days and runs must be positive and history at least 2\n")
+		}
+		c, err := client.New(configPath, dbPath, portfolio)
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		// Flags override the configured goal
+		goal := c.GetGoal()
+		options := analytics.ProjectionOptions{
+			Days:         days,
+			Contribution: goal.Contribution,
+			Every:        goal.EveryDays(),
+			Goal:         goal.Value,
+			Runs:         runs,
+		}
+		if cmd.Flags().Changed("contribution") {
+			options.Contribution, _ = cmd.Flags().GetFloat64("contribution")
+		}
+		if cmd.Flags().Changed("every") || options.Every == 0 {
+			options.Every, _ = cmd.Flags().GetInt("every")
+		}
+		if cmd.Flags().Changed("goal") {
+			options.Goal, _ = cmd.Flags().GetFloat64("goal")
+		}
+		p, err := c.GetProjection(history, options)
+		if err != nil {
+			fatal("Unable to project: %v\n", err)
+		}
+		style := display.GetDefaultAsciiTableStyle()
+		style.Style = display.Wide
+		style.Borders = true
+		table, err := display.ProjectionAsciiTable(&c, p, style)
+		if err != nil {
+			fatal("Unable to show projection: %v\n", err)
+		}
+		fmt.Println(table)
+		if output != "" {
+			g, err := display.ProjectionBmpGraph(p, display.BmpGraphStyle{Width: 1280, Height: 480})
+			if err != nil {
+				fatal("Unable to draw projection: %v\n", err)
+			}
+			if err := ioutil.WriteFile(tools.ExpandPath(output), g.Bytes(), 0644); err != nil {
+				fatal("Unable to write chart: %v\n", err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(projectCmd)
+	projectCmd.Flags().Int("days", 365*5, "Days to project")
+	projectCmd.Flags().Int("history", 365, "Days of history returns are drawn from")
+	projectCmd.Flags().Int("runs", 1000, "Amount of simulated runs")
+	projectCmd.Flags().Float64("contribution", 0, "Fiat added every contribution, negative to withdraw, overrides goal.contribution")
+	projectCmd.Flags().Int("every", 30, "Days between contributions, overrides goal.every")
+	projectCmd.Flags().Float64("goal", 0, "Fiat value to reach, overrides goal.value")
+	projectCmd.Flags().StringP("output", "o", "", "Write the chart as PNG to this file")
+}
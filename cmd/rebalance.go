@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/display"
+)
+
+var rebalanceCmd = &cobra.Command{
+	Use:   "rebalance",
+	Short: "Compare the current allocation with rebalance targets and suggest trades",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		c, err := client.New(configPath, dbPath, portfolio)
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		style := display.GetDefaultAsciiTableStyle()
+		style.Style = display.Wide
+		style.Borders = true
+		table, err := display.RebalanceAsciiTable(&c, style)
+		if err != nil {
+			fatal("Unable to compute rebalance: %v\n", err)
+		}
+		fmt.Println(table)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rebalanceCmd)
+}
@@ -34,7 +34,8 @@ func fatal(format string, a ...any) {
 func init() {
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Log to stderr")
 	rootCmd.PersistentFlags().StringP("config", "c", "./config.yml", "Config file path")
-	rootCmd.PersistentFlags().StringP("db-path", "d", "~/.coinwatch.db", "DB file path")
+	rootCmd.PersistentFlags().StringP("db-path", "d", "~/.coinwatch.db", "DB file path or postgres:// DSN")
+	rootCmd.PersistentFlags().String("portfolio", "", "Portfolio name, the first configured one if empty")
 }
 
 func initLog(cmd *cobra.Command, args []string) {
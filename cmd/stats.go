@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/display"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show drawdown, volatility, Sharpe and Sortino ratios and beta to BTC and ETH from stored snapshots",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		days, _ := cmd.Flags().GetInt("days")
+		window, _ := cmd.Flags().GetInt("window")
+		riskFree, _ := cmd.Flags().GetFloat64("risk-free")
+		if days < 2 || window < 2 {
+			fatal("Days and window must be at least 2\n")
+		}
+		c, err := client.New(configPath, dbPath, portfolio)
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		style := display.GetDefaultAsciiTableStyle()
+		style.Borders = true
+		table, err := display.StatsAsciiTable(&c, days, window, riskFree, style)
+		if err != nil {
+			fatal("Unable to compute stats: %v\n", err)
+		}
+		fmt.Println(table)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().IntP("days", "d", 90, "Days of history")
+	statsCmd.Flags().IntP("window", "w", 30, "Days of rolling volatility")
+	statsCmd.Flags().Float64("risk-free", 0, "Annual risk free rate for Sharpe and Sortino, 0.04 for 4%")
+}
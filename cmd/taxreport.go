@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/accounting"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var taxReportCmd = &cobra.Command{
+	Use:   "tax-report",
+	Short: "Write disposals and staking income of a year as CSV or printable HTML",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		year, _ := cmd.Flags().GetInt("year")
+		method, _ := cmd.Flags().GetString("method")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		longTerm, _ := cmd.Flags().GetDuration("long-term")
+		if format != "csv" && format != "html" {
+			fatal("Invalid format '%v', use csv or html\n", format)
+		}
+		c, err := client.New(configPath, dbPath, portfolio)
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		report, err := c.GetTaxReport(year, method, longTerm)
+		if err != nil {
+			fatal("Unable to compute tax report: %v\n", err)
+		}
+		output = tools.ExpandPath(output)
+		if err := os.MkdirAll(output, 0755); err != nil {
+			fatal("Unable to create %v: %v\n", output, err)
+		}
+		files := map[string]func(io.Writer) error{
+			fmt.Sprintf("tax-%d.html", year): report.WriteHtml,
+		}
+		if format == "csv" {
+			files = map[string]func(io.Writer) error{
+				fmt.Sprintf("tax-%d-disposals.csv", year): report.WriteDisposalsCsv,
+				fmt.Sprintf("tax-%d-income.csv", year):    report.WriteIncomeCsv,
+			}
+		}
+		for name, write := range files {
+			path := filepath.Join(output, name)
+			if err := writeFile(path, write); err != nil {
+				fatal("Unable to write %v: %v\n", path, err)
+			}
+			fmt.Println(path)
+		}
+		t := report.Totals()
+		fmt.Printf("%d disposals, gain %v short / %v long term, income %v %v\n",
+			len(report.Disposals), t.ShortGain.StringFixed(2), t.LongGain.StringFixed(2), t.Income.StringFixed(2), report.Fiat)
+		if report.Missing > 0 {
+			fmt.Printf("Warning: %d transactions had no stored price and are valued at zero\n", report.Missing)
+		}
+	},
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func init() {
+	rootCmd.AddCommand(taxReportCmd)
+	taxReportCmd.Flags().Int("year", time.Now().Year()-1, "Calendar year to report")
+	taxReportCmd.Flags().StringP("method", "m", "", "Lot matching method, defaults to globals.cost_basis")
+	taxReportCmd.Flags().StringP("format", "f", "csv", "Output format: csv or html")
+	taxReportCmd.Flags().StringP("output", "o", ".", "Output directory")
+	taxReportCmd.Flags().Duration("long-term", accounting.DefaultLongTerm, "Holding period after which gains are long term")
+}
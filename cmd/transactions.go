@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zooper-corp/CoinWatch/client"
+	"github.com/zooper-corp/CoinWatch/data"
+	"github.com/zooper-corp/CoinWatch/display"
+	"time"
+)
+
+var transactionsCmd = &cobra.Command{
+	Use:   "transactions",
+	Short: "Fetch new deposits, withdrawals, trades and rewards then list them",
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		dbPath, _ := cmd.Flags().GetString("db-path")
+		portfolio, _ := cmd.Flags().GetString("portfolio")
+		skipUpdate, _ := cmd.Flags().GetBool("skip-update")
+		days, _ := cmd.Flags().GetInt("days")
+		wallet, _ := cmd.Flags().GetString("wallet")
+		token, _ := cmd.Flags().GetString("token")
+		c, err := client.New(configPath, dbPath, portfolio)
+		if err != nil {
+			fatal("Unable to create client: %v\n", err)
+		}
+		if !skipUpdate {
+			n, err := c.UpdateTransactions()
+			if err != nil {
+				fatal("Unable to update transactions: %v\n", err)
+			}
+			fmt.Printf("Fetched %d new transactions\n", n)
+		}
+		style := display.GetDefaultAsciiTableStyle()
+		style.Style = display.Wide
+		style.Borders = true
+		table, err := display.TransactionsAsciiTable(&c, data.TransactionQueryOptions{
+			From:   time.Now().AddDate(0, 0, -days),
+			Wallet: wallet,
+			Token:  token,
+		}, style)
+		if err != nil {
+			fatal("Unable to dump transactions: %v\n", err)
+		}
+		fmt.Println(table)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(transactionsCmd)
+	transactionsCmd.Flags().BoolP("skip-update", "s", false, "Do not fetch new transactions")
+	transactionsCmd.Flags().Int("days", 30, "Days of transactions to list")
+	transactionsCmd.Flags().String("wallet", "", "Only list transactions of this wallet")
+	transactionsCmd.Flags().String("token", "", "Only list transactions of this token")
+}
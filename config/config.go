@@ -3,13 +3,33 @@ package config
 import (
 	"embed"
 	"fmt"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/tools"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 )
 
+const (
+	defaultPriceMaxAge   = time.Hour * 24
+	defaultPriceCacheTTL = time.Minute * 5
+	defaultCostBasis     = "fifo"
+	defaultBackupDir     = "~/.coinwatch-backups"
+	defaultBackupKeep    = 7
+	defaultRebalanceBand = 0.05
+	defaultAnomalyDrop   = 0.1
+)
+
+// defaultRetentionTiers keep every snapshot for a week, hourly ones for 90 days and daily ones forever
+var defaultRetentionTiers = []RetentionTier{
+	{After: time.Hour * 24 * 7, Every: time.Hour},
+	{After: time.Hour * 24 * 90, Every: time.Hour * 24},
+}
+
 //go:embed tokens/*.yml
 var sourcesConfig embed.FS
 
@@ -22,7 +42,8 @@ func FromFile(path string) (Config, error) {
 }
 
 func FromData(data []byte) (Config, error) {
-	var config configUnmarshal
+	// Keys left out keep their default, backup.keep 0 keeps every backup
+	config := configUnmarshal{Backup: DefaultBackup()}
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return Config{}, err
 	}
@@ -44,11 +65,74 @@ func FromData(data []byte) (Config, error) {
 			config.Tokens = append(config.Tokens, t)
 		}
 	}
+	// Check pricing rules
+	for _, pr := range config.Pricing {
+		if err := pr.validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	// Check retention tiers
+	for _, rt := range config.Retention.Tiers {
+		if rt.After <= 0 || rt.Every <= 0 {
+			return Config{}, fmt.Errorf("retention tier must set positive after and every durations")
+		}
+	}
+	if config.Backup.Keep < 0 {
+		return Config{}, fmt.Errorf("backup keep must not be negative")
+	}
+	// Check portfolios
+	portfolios := make(map[string]bool)
+	for _, p := range config.Portfolios {
+		if err := p.validate(config.Wallets); err != nil {
+			return Config{}, err
+		}
+		if portfolios[strings.ToLower(p.Name)] {
+			return Config{}, fmt.Errorf("portfolio '%v' is configured twice", p.Name)
+		}
+		portfolios[strings.ToLower(p.Name)] = true
+	}
+	// Check goals
+	if err := config.Goal.validate(); err != nil {
+		return Config{}, err
+	}
+	// Check anomalies
+	if err := config.Anomalies.validate(config.Wallets); err != nil {
+		return Config{}, err
+	}
+	// Check flows
+	for _, f := range config.Flows {
+		if _, err := f.Time(); err != nil {
+			return Config{}, err
+		}
+		if f.Portfolio != "" && !portfolios[strings.ToLower(f.Portfolio)] {
+			return Config{}, fmt.Errorf("flow of %v is in unknown portfolio '%v'", f.Date, f.Portfolio)
+		}
+	}
+	// Check rebalance targets
+	if err := config.Rebalance.validate(config.Tags); err != nil {
+		return Config{}, err
+	}
+	// Check benchmarks
+	for _, b := range config.Baskets {
+		if err := b.validate(); err != nil {
+			return Config{}, err
+		}
+	}
 	// Done
 	return Config{
-		globals: config.Globals,
-		wallets: config.Wallets,
-		tokens:  config.Tokens,
+		globals:    config.Globals,
+		wallets:    config.Wallets,
+		tokens:     config.Tokens,
+		pricing:    config.Pricing,
+		retention:  config.Retention,
+		backup:     config.Backup,
+		flows:      config.Flows,
+		tags:       config.Tags,
+		rebalance:  config.Rebalance,
+		baskets:    config.Baskets,
+		portfolios: config.Portfolios,
+		goal:       config.Goal,
+		anomalies:  config.Anomalies,
 	}, nil
 }
 
@@ -56,25 +140,238 @@ func (c *Config) GetTokenConfigs() []TokenConfig {
 	return c.tokens
 }
 
+func (c *Config) GetPricingRules() []PricingRule {
+	return c.pricing
+}
+
 func (c *Config) GetHttpClient() *http.Client {
 	return http.DefaultClient
 }
 
+// GetFiat returns the fiat of the portfolio
 func (c *Config) GetFiat() string {
-	return c.globals.Fiat
+	return c.GetPortfolio().Fiat
 }
 
-func (c *Config) GetFiatMin() float32 {
+func (c *Config) GetFiatMin() decimal.Decimal {
 	return c.globals.FiatMin
 }
 
+// GetPriceMaxAge returns how old a stored price can be to be used when live sources fail
+func (c *Config) GetPriceMaxAge() time.Duration {
+	if c.globals.PriceMaxAge <= 0 {
+		return defaultPriceMaxAge
+	}
+	return c.globals.PriceMaxAge
+}
+
+// GetPriceCacheTTL returns for how long a fetched price is reused
+func (c *Config) GetPriceCacheTTL() time.Duration {
+	if c.globals.PriceCacheTTL <= 0 {
+		return defaultPriceCacheTTL
+	}
+	return c.globals.PriceCacheTTL
+}
+
+// GetCostBasisMethod returns how sales are matched with purchases: fifo, lifo, hifo or average
+func (c *Config) GetCostBasisMethod() string {
+	if c.globals.CostBasis == "" {
+		return defaultCostBasis
+	}
+	return strings.ToLower(c.globals.CostBasis)
+}
+
+// GetRetentionTiers returns the configured retention tiers or the default ones
+func (c *Config) GetRetentionTiers() []RetentionTier {
+	if len(c.retention.Tiers) == 0 {
+		return defaultRetentionTiers
+	}
+	return c.retention.Tiers
+}
+
+// IsAutoCompactEnabled is true if the update loop should compact the DB
+func (c *Config) IsAutoCompactEnabled() bool {
+	return c.retention.Compact
+}
+
+// DefaultBackup returns backup settings used when the config has none, rotation keeps the last week
+func DefaultBackup() Backup {
+	return Backup{Dir: defaultBackupDir, Keep: defaultBackupKeep}
+}
+
+// GetBackup returns backup settings with default dir applied, Keep 0 keeps every backup
+func (c *Config) GetBackup() Backup {
+	r := c.backup
+	if r.Dir == "" {
+		r.Dir = defaultBackupDir
+	}
+	return r
+}
+
+// GetFlows returns manually entered deposits and withdrawals of the portfolio, flows without a portfolio belong
+// to the first one
+func (c *Config) GetFlows() []Flow {
+	p := c.GetPortfolio()
+	first := p.Name == c.GetPortfolios()[0].Name
+	r := make([]Flow, 0)
+	for _, f := range c.flows {
+		if strings.EqualFold(f.Portfolio, p.Name) || (f.Portfolio == "" && first) {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+// GetTags returns tokens of every tag, tags are lower case and tokens upper case
+func (c *Config) GetTags() map[string][]string {
+	r := make(map[string][]string)
+	for tag, tokens := range c.tags {
+		for _, token := range tokens {
+			r[strings.ToLower(tag)] = append(r[strings.ToLower(tag)], strings.ToUpper(token))
+		}
+	}
+	return r
+}
+
+// GetTokenTags returns tags listing token
+func (c *Config) GetTokenTags(token string) []string {
+	r := make([]string, 0)
+	for tag, tokens := range c.GetTags() {
+		if tools.StringInSlice(strings.ToUpper(token), tokens) {
+			r = append(r, tag)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// GetRebalance returns rebalance targets with the default band applied
+func (c *Config) GetRebalance() Rebalance {
+	r := c.rebalance
+	if r.Band == 0 {
+		r.Band = defaultRebalanceBand
+	}
+	return r
+}
+
+// GetBaskets returns configured benchmark baskets
+func (c *Config) GetBaskets() []Basket {
+	return c.baskets
+}
+
+// GetGoal returns the goal of the portfolio
+func (c *Config) GetGoal() Goal {
+	return c.GetPortfolio().Goal
+}
+
+// GetAnomalies returns anomaly detection settings with the default drop applied, wallets are lower case
+func (c *Config) GetAnomalies() Anomalies {
+	r := c.anomalies
+	if r.Drop == 0 {
+		r.Drop = defaultAnomalyDrop
+	}
+	wallets := make([]string, 0, len(r.Wallets))
+	for _, w := range r.Wallets {
+		wallets = append(wallets, strings.ToLower(w))
+	}
+	r.Wallets = wallets
+	return r
+}
+
+// EveryDays returns the days between contributions, at least one when contributing
+func (g Goal) EveryDays() int {
+	days := int(g.Every.Hours() / 24)
+	if days < 1 && g.Contribution != 0 {
+		return 1
+	}
+	return days
+}
+
+// Time returns when the flow happened, plain dates are midnight local time
+func (f Flow) Time() (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", f.Date, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, f.Date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid flow date '%v', use 2006-01-02 or RFC3339", f.Date)
+	}
+	return t, nil
+}
+
 func (c *Config) GetFiatSymbol() string {
-	return c.globals.FiatSymbol
+	return c.GetPortfolio().FiatSymbol
+}
+
+// GetPortfolios returns configured portfolios with names in lower case and the global fiat applied, or a single
+// default portfolio holding every wallet
+func (c *Config) GetPortfolios() []Portfolio {
+	if len(c.portfolios) == 0 {
+		wallets := make([]string, len(c.wallets))
+		for i, w := range c.wallets {
+			wallets[i] = w.Name
+		}
+		return []Portfolio{{
+			Name:       data.DefaultPortfolio,
+			Fiat:       c.globals.Fiat,
+			FiatSymbol: c.globals.FiatSymbol,
+			Wallets:    wallets,
+			Goal:       c.goal,
+		}}
+	}
+	r := make([]Portfolio, len(c.portfolios))
+	for i, p := range c.portfolios {
+		p.Name = strings.ToLower(p.Name)
+		if p.Fiat == "" {
+			p.Fiat = c.globals.Fiat
+			p.FiatSymbol = c.globals.FiatSymbol
+		}
+		if p.Goal == (Goal{}) {
+			p.Goal = c.goal
+		}
+		r[i] = p
+	}
+	return r
+}
+
+// HasPortfolios is true if portfolios are configured, otherwise every wallet is in the default one
+func (c *Config) HasPortfolios() bool {
+	return len(c.portfolios) > 0
+}
+
+// GetPortfolio returns the portfolio the config is scoped to, the first one unless set with ForPortfolio
+func (c *Config) GetPortfolio() Portfolio {
+	portfolios := c.GetPortfolios()
+	for _, p := range portfolios {
+		if p.Name == c.portfolio {
+			return p
+		}
+	}
+	return portfolios[0]
 }
 
+// ForPortfolio returns a copy of the config scoped to a portfolio, wallets, flows and fiat are then the ones of the
+// portfolio. An empty name selects the first one
+func (c Config) ForPortfolio(name string) (Config, error) {
+	names := make([]string, 0)
+	for _, p := range c.GetPortfolios() {
+		if name == "" || strings.EqualFold(p.Name, name) {
+			c.portfolio = p.Name
+			return c, nil
+		}
+		names = append(names, p.Name)
+	}
+	return Config{}, fmt.Errorf("unknown portfolio '%v', use one of %v", name, strings.Join(names, ", "))
+}
+
+// GetWallets returns wallets of the portfolio
 func (c *Config) GetWallets() []Wallet {
 	r := make([]Wallet, 0)
+	portfolio := c.GetPortfolio()
 	for _, w := range c.wallets {
+		if !portfolio.hasWallet(w.Name) {
+			continue
+		}
 		filters := make([]TokenFilter, 0)
 		for _, t := range w.Tokens {
 			ts := strings.Split(strings.Trim(t, " "), ":")
@@ -93,11 +390,164 @@ func (c *Config) GetWallets() []Wallet {
 			}
 			filters = append(filters, filter)
 		}
+		tags := make([]string, len(w.Tags))
+		for i, tag := range w.Tags {
+			tags[i] = strings.ToLower(tag)
+		}
 		r = append(r, Wallet{
 			Name:     w.Name,
 			Provider: w.Provider,
 			Filters:  filters,
+			Tags:     tags,
 		})
 	}
 	return r
 }
+
+func (p Portfolio) hasWallet(name string) bool {
+	for _, w := range p.Wallets {
+		if strings.EqualFold(w, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Portfolio) validate(wallets []wallet) error {
+	if strings.Trim(p.Name, " ") == "" {
+		return fmt.Errorf("portfolio without name")
+	}
+	// Names are used in API paths
+	if strings.ContainsAny(p.Name, " /?#") {
+		return fmt.Errorf("portfolio name '%v' must not contain spaces, slashes, ? or #", p.Name)
+	}
+	if len(p.Wallets) == 0 {
+		return fmt.Errorf("portfolio '%v' has no wallets", p.Name)
+	}
+	if p.Fiat != "" && p.FiatSymbol == "" {
+		return fmt.Errorf("portfolio '%v' sets a fiat without fiat_symbol", p.Name)
+	}
+	if err := p.Goal.validate(); err != nil {
+		return fmt.Errorf("portfolio '%v' %v", p.Name, err)
+	}
+	for _, name := range p.Wallets {
+		found := false
+		for _, w := range wallets {
+			found = found || strings.EqualFold(w.Name, name)
+		}
+		if !found {
+			return fmt.Errorf("portfolio '%v' wallet '%v' is not configured", p.Name, name)
+		}
+	}
+	return nil
+}
+
+func (g Goal) validate() error {
+	if g.Value < 0 {
+		return fmt.Errorf("goal value must not be negative")
+	}
+	if g.Every < 0 {
+		return fmt.Errorf("goal every must not be negative")
+	}
+	if g.Contribution != 0 && g.Every == 0 {
+		return fmt.Errorf("goal contribution needs every, like 720h for a monthly one")
+	}
+	return nil
+}
+
+func (a Anomalies) validate(wallets []wallet) error {
+	if a.Drop < 0 || a.Drop >= 1 {
+		return fmt.Errorf("anomalies drop must be between 0.0 and 1.0")
+	}
+	if a.MinValue.IsNegative() {
+		return fmt.Errorf("anomalies min_value must not be negative")
+	}
+	for _, name := range a.Wallets {
+		found := false
+		for _, w := range wallets {
+			found = found || strings.EqualFold(w.Name, name)
+		}
+		if !found {
+			return fmt.Errorf("anomalies wallet '%v' is not configured", name)
+		}
+	}
+	return nil
+}
+
+func (b Basket) validate() error {
+	if strings.Trim(b.Name, " ") == "" {
+		return fmt.Errorf("benchmark without name")
+	}
+	if len(b.Weights) == 0 {
+		return fmt.Errorf("benchmark '%v' has no tokens", b.Name)
+	}
+	for token, w := range b.Weights {
+		if w <= 0 {
+			return fmt.Errorf("benchmark '%v' weight of '%v' must be positive", b.Name, token)
+		}
+	}
+	return nil
+}
+
+func (rb Rebalance) validate(tags map[string][]string) error {
+	if rb.Band < 0 || rb.Band >= 1 {
+		return fmt.Errorf("rebalance band must be between 0 and 1")
+	}
+	total := 0.0
+	seen := make(map[string]bool)
+	for _, t := range rb.Targets {
+		if (t.Token == "") == (t.Tag == "") {
+			return fmt.Errorf("rebalance target must set one of token or tag")
+		}
+		if t.Weight < 0 || t.Weight > 1 {
+			return fmt.Errorf("rebalance target weight must be between 0 and 1")
+		}
+		total += t.Weight
+		tokens := []string{t.Token}
+		if t.Tag != "" {
+			tokens = nil
+			for tag, tt := range tags {
+				if strings.EqualFold(tag, t.Tag) {
+					tokens = tt
+				}
+			}
+			if len(tokens) == 0 {
+				return fmt.Errorf("rebalance target tag '%v' has no tokens", t.Tag)
+			}
+		}
+		for _, token := range tokens {
+			if seen[strings.ToUpper(token)] {
+				return fmt.Errorf("token '%v' is in more than one rebalance target", token)
+			}
+			seen[strings.ToUpper(token)] = true
+		}
+	}
+	// Weights are often written as rounded percentages
+	if total > 1.0001 {
+		return fmt.Errorf("rebalance target weights add up to %v, more than 1", total)
+	}
+	return nil
+}
+
+func (pr PricingRule) validate() error {
+	if strings.Trim(pr.Symbol, " ") == "" {
+		return fmt.Errorf("pricing rule without symbol")
+	}
+	set := 0
+	if !pr.Price.IsZero() {
+		set++
+	}
+	if pr.Peg != "" {
+		set++
+	}
+	if pr.Formula != "" {
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf("pricing rule for '%v' must set exactly one of price, peg or formula", pr.Symbol)
+	}
+	if !pr.Ratio.IsZero() && pr.Peg == "" {
+		return fmt.Errorf("pricing rule for '%v' has a ratio but no peg", pr.Symbol)
+	}
+	return nil
+}
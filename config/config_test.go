@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestFromData_Globals(t *testing.T) {
@@ -30,3 +31,194 @@ func TestFromData_Wallets(t *testing.T) {
 		t.Errorf("Wallet name is not 'test' is '%v'", wallets[0])
 	}
 }
+
+func TestFromData_Pricing(t *testing.T) {
+	yaml := "pricing:\n  - symbol: usdc\n    price: 1\n  - symbol: wbtc\n    peg: btc"
+	c, err := FromData([]byte(yaml))
+	if err != nil {
+		t.Error(err)
+	}
+	if len(c.GetPricingRules()) != 2 {
+		t.Errorf("Pricing rules size is not 2")
+	}
+	yaml = "pricing:\n  - symbol: usdc\n    price: 1\n    peg: usdt"
+	if _, err := FromData([]byte(yaml)); err == nil {
+		t.Errorf("Expected error for rule with both price and peg")
+	}
+}
+
+func TestFromData_Retention(t *testing.T) {
+	c, err := FromData([]byte("globals:\n  fiat: EUR"))
+	if err != nil {
+		t.Error(err)
+	}
+	if len(c.GetRetentionTiers()) != 2 || c.IsAutoCompactEnabled() {
+		t.Errorf("Expected default retention tiers")
+	}
+	yaml := "retention:\n  compact: true\n  tiers:\n    - after: 48h\n      every: 6h"
+	c, err = FromData([]byte(yaml))
+	if err != nil {
+		t.Error(err)
+	}
+	tiers := c.GetRetentionTiers()
+	if len(tiers) != 1 || tiers[0].After != time.Hour*48 || tiers[0].Every != time.Hour*6 || !c.IsAutoCompactEnabled() {
+		t.Errorf("Unexpected retention tiers %v", tiers)
+	}
+	yaml = "retention:\n  tiers:\n    - after: 48h"
+	if _, err := FromData([]byte(yaml)); err == nil {
+		t.Errorf("Expected error for tier without every")
+	}
+}
+
+func TestFromData_Backup(t *testing.T) {
+	c, err := FromData([]byte("backup:\n  daily: true"))
+	if err != nil {
+		t.Error(err)
+	}
+	b := c.GetBackup()
+	if !b.Daily || b.Dir != defaultBackupDir || b.Keep != defaultBackupKeep || b.Gzip {
+		t.Errorf("Unexpected backup config %v", b)
+	}
+	// Zero disables rotation like the keep flag
+	if c, err = FromData([]byte("backup:\n  keep: 0")); err != nil || c.GetBackup().Keep != 0 {
+		t.Errorf("Expected keep 0 to be kept got %v %v", c.GetBackup(), err)
+	}
+	if _, err := FromData([]byte("backup:\n  keep: -1")); err == nil {
+		t.Errorf("Expected error for negative keep")
+	}
+}
+
+func TestFromData_Flows(t *testing.T) {
+	yaml := "flows:\n  - date: 2022-05-02\n    value: 500\n  - date: 2022-06-01T10:00:00Z\n    value: -200"
+	c, err := FromData([]byte(yaml))
+	if err != nil {
+		t.Error(err)
+	}
+	flows := c.GetFlows()
+	if len(flows) != 2 || !flows[1].Value.IsNegative() {
+		t.Errorf("Unexpected flows %v", flows)
+	}
+	if ts, _ := flows[0].Time(); ts.Year() != 2022 || ts.Month() != time.May || ts.Day() != 2 {
+		t.Errorf("Unexpected flow date %v", ts)
+	}
+	if _, err := FromData([]byte("flows:\n  - date: yesterday\n    value: 1")); err == nil {
+		t.Errorf("Expected error for invalid flow date")
+	}
+}
+
+func TestFromData_Rebalance(t *testing.T) {
+	yaml := "tags:\n  stable: [usdc, usdt]\nrebalance:\n  targets:\n    - token: btc\n      weight: 0.6\n    - tag: stable\n      weight: 0.4"
+	c, err := FromData([]byte(yaml))
+	if err != nil {
+		t.Error(err)
+	}
+	if rb := c.GetRebalance(); rb.Band != defaultRebalanceBand || len(rb.Targets) != 2 {
+		t.Errorf("Unexpected rebalance config %v", rb)
+	}
+	if tokens := c.GetTags()["stable"]; len(tokens) != 2 || tokens[0] != "USDC" {
+		t.Errorf("Unexpected tag tokens %v", tokens)
+	}
+	for _, yaml := range []string{
+		"rebalance:\n  targets:\n    - token: btc\n      weight: 0.6\n    - token: eth\n      weight: 0.6",
+		"rebalance:\n  targets:\n    - tag: missing\n      weight: 0.5",
+		"tags:\n  stable: [usdc]\nrebalance:\n  targets:\n    - token: usdc\n      weight: 0.1\n    - tag: stable\n      weight: 0.1",
+	} {
+		if _, err := FromData([]byte(yaml)); err == nil {
+			t.Errorf("Expected error for %v", yaml)
+		}
+	}
+}
+
+func TestFromData_Benchmarks(t *testing.T) {
+	c, err := FromData([]byte("benchmarks:\n  - name: majors\n    weights:\n      btc: 0.6\n      eth: 0.4"))
+	if err != nil {
+		t.Error(err)
+	}
+	if b := c.GetBaskets(); len(b) != 1 || b[0].Weights["eth"] != 0.4 {
+		t.Errorf("Unexpected benchmarks %v", b)
+	}
+	if _, err := FromData([]byte("benchmarks:\n  - name: empty")); err == nil {
+		t.Errorf("Expected error for benchmark without tokens")
+	}
+}
+
+func TestFromData_Tags(t *testing.T) {
+	yaml := "tags:\n  stable: [usdc]\n  defi: [USDC, glmr]\nwallets:\n  - name: cold\n    tags: [Cold, chain:polkadot]"
+	c, err := FromData([]byte(yaml))
+	if err != nil {
+		t.Error(err)
+	}
+	if tags := c.GetTokenTags("usdc"); len(tags) != 2 || tags[0] != "defi" || tags[1] != "stable" {
+		t.Errorf("Unexpected token tags %v", tags)
+	}
+	if tags := c.GetWallets()[0].Tags; len(tags) != 2 || tags[0] != "cold" {
+		t.Errorf("Unexpected wallet tags %v", tags)
+	}
+}
+
+func TestFromData_Portfolios(t *testing.T) {
+	yaml := "globals:\n  fiat: EUR\n  fiat_symbol: €\nwallets:\n  - name: a\n  - name: b\n" +
+		"portfolios:\n  - name: Main\n    wallets: [a]\n  - name: fund\n    fiat: USD\n    fiat_symbol: $\n    wallets: [a, B]\n" +
+		"flows:\n  - date: 2022-06-01\n    value: 100\n  - date: 2022-06-02\n    value: 50\n    portfolio: fund"
+	c, err := FromData([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := c.GetPortfolio(); p.Name != "main" || c.GetFiat() != "EUR" || len(c.GetWallets()) != 1 || len(c.GetFlows()) != 1 {
+		t.Errorf("Unexpected first portfolio %v", p)
+	}
+	fund, err := c.ForPortfolio("FUND")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fund.GetFiatSymbol() != "$" || len(fund.GetWallets()) != 2 || len(fund.GetFlows()) != 1 || fund.GetFlows()[0].Value.String() != "50" {
+		t.Errorf("Unexpected fund portfolio %v", fund.GetPortfolio())
+	}
+	if _, err := c.ForPortfolio("other"); err == nil {
+		t.Errorf("Expected error for unknown portfolio")
+	}
+	// Default portfolio
+	c, err = FromData([]byte("wallets:\n  - name: a\n  - name: b"))
+	if err != nil || c.GetPortfolio().Name != "default" || len(c.GetWallets()) != 2 {
+		t.Errorf("Unexpected default portfolio %v %v", c.GetPortfolio(), err)
+	}
+	// Unknown wallet
+	if _, err := FromData([]byte("wallets:\n  - name: a\nportfolios:\n  - name: x\n    wallets: [c]")); err == nil {
+		t.Errorf("Expected error for unknown wallet")
+	}
+}
+
+func TestFromData_Goal(t *testing.T) {
+	yaml := "goal:\n  value: 100000\n  contribution: 200\n  every: 720h\nwallets:\n  - name: a\n" +
+		"portfolios:\n  - name: main\n    wallets: [a]\n  - name: kids\n    wallets: [a]\n    goal:\n      value: 5000"
+	c, err := FromData([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := c.GetGoal(); g.Value != 100000 || g.EveryDays() != 30 {
+		t.Errorf("Unexpected goal %v", g)
+	}
+	kids, _ := c.ForPortfolio("kids")
+	if g := kids.GetGoal(); g.Value != 5000 || g.Contribution != 0 {
+		t.Errorf("Unexpected portfolio goal %v", g)
+	}
+	if _, err := FromData([]byte("goal:\n  contribution: 200")); err == nil {
+		t.Errorf("Expected error for contribution without every")
+	}
+}
+
+func TestFromData_Anomalies(t *testing.T) {
+	c, err := FromData([]byte("wallets:\n  - name: Hot\nanomalies:\n  min_value: 50\n  wallets: [Hot]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := c.GetAnomalies(); a.Drop != 0.1 || a.MinValue.String() != "50" || len(a.Wallets) != 1 || a.Wallets[0] != "hot" {
+		t.Errorf("Unexpected anomalies %+v", a)
+	}
+	if _, err := FromData([]byte("anomalies:\n  drop: 1.5")); err == nil {
+		t.Errorf("Expected error for drop above 1.0")
+	}
+	if _, err := FromData([]byte("anomalies:\n  wallets: [cold]")); err == nil {
+		t.Errorf("Expected error for unknown wallet")
+	}
+}
@@ -1,11 +1,24 @@
 package config
 
-import "time"
+import (
+	"github.com/shopspring/decimal"
+	"time"
+)
 
 type configUnmarshal struct {
-	Globals globals       `yaml:"globals"`
-	Wallets []wallet      `yaml:"wallets"`
-	Tokens  []TokenConfig `yaml:"tokens"`
+	Globals    globals             `yaml:"globals"`
+	Wallets    []wallet            `yaml:"wallets"`
+	Tokens     []TokenConfig       `yaml:"tokens"`
+	Pricing    []PricingRule       `yaml:"pricing"`
+	Retention  Retention           `yaml:"retention"`
+	Backup     Backup              `yaml:"backup"`
+	Flows      []Flow              `yaml:"flows"`
+	Tags       map[string][]string `yaml:"tags"`
+	Rebalance  Rebalance           `yaml:"rebalance"`
+	Baskets    []Basket            `yaml:"benchmarks"`
+	Portfolios []Portfolio         `yaml:"portfolios"`
+	Goal       Goal                `yaml:"goal"`
+	Anomalies  Anomalies           `yaml:"anomalies"`
 }
 
 type TelegramBotConfig struct {
@@ -15,27 +28,44 @@ type TelegramBotConfig struct {
 }
 
 type Config struct {
-	globals globals
-	wallets []wallet
-	tokens  []TokenConfig
+	globals   globals
+	wallets   []wallet
+	tokens    []TokenConfig
+	pricing   []PricingRule
+	retention Retention
+	backup    Backup
+	flows     []Flow
+	tags      map[string][]string
+	rebalance Rebalance
+	baskets   []Basket
+	// portfolios as configured and the name of the one the config is scoped to
+	portfolios []Portfolio
+	portfolio  string
+	goal       Goal
+	anomalies  Anomalies
 }
 
 type globals struct {
-	Fiat       string  `yaml:"fiat"`
-	FiatSymbol string  `yaml:"fiat_symbol"`
-	FiatMin    float32 `yaml:"fiat_min"`
+	Fiat          string          `yaml:"fiat"`
+	FiatSymbol    string          `yaml:"fiat_symbol"`
+	FiatMin       decimal.Decimal `yaml:"fiat_min"`
+	PriceMaxAge   time.Duration   `yaml:"price_max_age"`
+	PriceCacheTTL time.Duration   `yaml:"price_cache_ttl"`
+	CostBasis     string          `yaml:"cost_basis"`
 }
 
 type wallet struct {
 	Name     string         `yaml:"name"`
 	Provider ProviderConfig `yaml:"provider"`
 	Tokens   []string       `yaml:"tokens"`
+	Tags     []string       `yaml:"tags"`
 }
 
 type Wallet struct {
 	Name     string
 	Provider ProviderConfig
 	Filters  []TokenFilter
+	Tags     []string
 }
 
 type TokenFilter struct {
@@ -58,6 +88,92 @@ type TokenConfig struct {
 	Contract string `yaml:"contract"`
 }
 
+// PricingRule overrides market prices for a token, only one of Price, Peg or Formula must be set
+type PricingRule struct {
+	Symbol  string          `yaml:"symbol"`
+	Price   decimal.Decimal `yaml:"price"`
+	Peg     string          `yaml:"peg"`
+	Ratio   decimal.Decimal `yaml:"ratio"`
+	Formula string          `yaml:"formula"`
+}
+
+// Retention downsamples old snapshots, Compact also runs it from the update loop
+type Retention struct {
+	Compact bool            `yaml:"compact"`
+	Tiers   []RetentionTier `yaml:"tiers"`
+}
+
+// RetentionTier keeps one snapshot every Every once they are older than After
+type RetentionTier struct {
+	After time.Duration `yaml:"after"`
+	Every time.Duration `yaml:"every"`
+}
+
+// Backup writes a copy of the DB to Dir once a day from the update loop when Daily is set, keeping the last Keep,
+// all of them when 0
+type Backup struct {
+	Daily bool   `yaml:"daily"`
+	Dir   string `yaml:"dir"`
+	Keep  int    `yaml:"keep"`
+	Gzip  bool   `yaml:"gzip"`
+}
+
+// Flow is fiat moved in (positive) or out (negative) of the portfolio that no ledger reports, like a bank
+// transfer to an exchange without transaction support. Date is either 2006-01-02 or RFC3339
+type Flow struct {
+	Date      string          `yaml:"date"`
+	Value     decimal.Decimal `yaml:"value"`
+	Note      string          `yaml:"note"`
+	Portfolio string          `yaml:"portfolio"`
+}
+
+// Rebalance sets target weights (0.0 to 1.0) per token or per tag, a trade is suggested once the weight of a target
+// drifts more than Band away from it. Tokens without a target share what is left to 1.0
+type Rebalance struct {
+	Band    float64  `yaml:"band"`
+	Targets []Target `yaml:"targets"`
+}
+
+// Target weight of a token or of all tokens of a tag, only one of Token or Tag must be set
+type Target struct {
+	Token  string  `yaml:"token"`
+	Tag    string  `yaml:"tag"`
+	Weight float64 `yaml:"weight"`
+}
+
+// Basket is a benchmark holding tokens with the given weights, the portfolio is compared with it besides BTC and ETH
+type Basket struct {
+	Name    string             `yaml:"name"`
+	Weights map[string]float64 `yaml:"weights"`
+}
+
+// Portfolio is a named set of wallets valued in its own fiat, Fiat, FiatSymbol and Goal default to the global ones
+type Portfolio struct {
+	Name       string   `yaml:"name" json:"name"`
+	Fiat       string   `yaml:"fiat" json:"fiat"`
+	FiatSymbol string   `yaml:"fiat_symbol" json:"fiat_symbol"`
+	Wallets    []string `yaml:"wallets" json:"wallets"`
+	Goal       Goal     `yaml:"goal" json:"-"`
+}
+
+// Goal is the value projections try to reach in fiat while adding Contribution every Every, like 720h for a
+// monthly saving plan
+type Goal struct {
+	Value        float64       `yaml:"value"`
+	Contribution float64       `yaml:"contribution"`
+	Every        time.Duration `yaml:"every"`
+}
+
+// Anomalies flags balances dropping more than Drop (0.0 to 1.0) in quantity, addresses going missing and new tokens
+// after every update. Drops and missing balances worth less than MinValue in fiat are ignored, only Wallets are
+// checked when set and events are posted as JSON to Webhook when set
+type Anomalies struct {
+	Drop     float64         `yaml:"drop"`
+	MinValue decimal.Decimal `yaml:"min_value"`
+	Wallets  []string        `yaml:"wallets"`
+	Webhook  string          `yaml:"webhook"`
+}
+
 type ApiServerConfig struct {
 	Host     string
 	Port     int
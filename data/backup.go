@@ -0,0 +1,181 @@
+package data
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupPrefix     = "coinwatch-"
+	backupTimeLayout = "20060102-150405"
+)
+
+// Backup writes a consistent copy of the DB to path while it is in use, gzip compressed if path ends with .gz
+func (d *Db) Backup(path string) error {
+	if d.dialect.backup == nil {
+		return fmt.Errorf("backup is not supported on %v, use its own tools like pg_dump", d.dialect.name)
+	}
+	path = tools.ExpandPath(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Copy next to the target so a failed backup never replaces a good one
+	tmp := strings.TrimSuffix(path, ".gz") + ".tmp"
+	_ = os.Remove(tmp)
+	defer func() {
+		_ = os.Remove(tmp)
+	}()
+	if err := d.dialect.backup(d.path, tmp); err != nil {
+		return fmt.Errorf("backup failed: %v", err)
+	}
+	if strings.HasSuffix(path, ".gz") {
+		return compressFile(tmp, path)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Restore replaces the DB content with a backup after checking it, the current DB is moved aside when
+// it is too damaged to be overwritten
+func (d *Db) Restore(path string) error {
+	if d.dialect.backup == nil {
+		return fmt.Errorf("restore is not supported on %v, use its own tools like pg_restore", d.dialect.name)
+	}
+	src := tools.ExpandPath(path)
+	if strings.HasSuffix(src, ".gz") {
+		tmp, err := decompressFile(src)
+		if err != nil {
+			return fmt.Errorf("unable to decompress %v: %v", path, err)
+		}
+		defer func() {
+			_ = os.Remove(tmp)
+		}()
+		src = tmp
+	}
+	if err := d.dialect.check(src); err != nil {
+		return fmt.Errorf("backup %v is not usable: %v", path, err)
+	}
+	err := d.dialect.backup(src, d.path)
+	if err == nil {
+		log.Printf("Restored %v from %v", d.path, path)
+		return nil
+	}
+	// Start from an empty file, keep the broken one around
+	aside := fmt.Sprintf("%v.corrupted-%v", d.path, time.Now().Format(backupTimeLayout))
+	log.Printf("Unable to restore over %v (%v), moving it to %v", d.path, err, aside)
+	if err := os.Rename(d.path, aside); err != nil {
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		_ = os.Remove(d.path + suffix)
+	}
+	if err := d.dialect.backup(src, d.path); err != nil {
+		return fmt.Errorf("restore failed: %v", err)
+	}
+	log.Printf("Restored %v from %v", d.path, path)
+	return nil
+}
+
+// BackupPath returns a timestamped backup file name in dir, rotation relies on names sorting by time
+func BackupPath(dir string, t time.Time, compress bool) string {
+	name := fmt.Sprintf("%v%v.db", backupPrefix, t.Format(backupTimeLayout))
+	if compress {
+		name += ".gz"
+	}
+	return filepath.Join(tools.ExpandPath(dir), name)
+}
+
+// RotateBackups removes the oldest backups written by BackupPath keeping the last keep ones, returns
+// removed files. Nothing is removed when keep is not positive
+func RotateBackups(dir string, keep int) ([]string, error) {
+	removed := make([]string, 0)
+	if keep <= 0 {
+		return removed, nil
+	}
+	dir = tools.ExpandPath(dir)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return removed, err
+	}
+	backups := make([]string, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, backupPrefix) &&
+			(strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".db.gz")) {
+			backups = append(backups, name)
+		}
+	}
+	// Most recent first
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	for i := keep; i < len(backups); i++ {
+		path := filepath.Join(dir, backups[i])
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		log.Printf("Removed old backup %v", path)
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+func compressFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+	}
+	return err
+}
+
+// decompressFile extracts a gzip file to a temporary file, callers must remove it
+func decompressFile(src string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return "", err
+	}
+	out, err := ioutil.TempFile("", "coinwatch-restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, zr)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
@@ -3,45 +3,37 @@ package data
 import (
 	"fmt"
 	"github.com/upper/db/v4"
-	"github.com/upper/db/v4/adapter/sqlite"
-	"github.com/zooper-corp/CoinWatch/tools"
 	"log"
+	"strings"
 	"time"
 )
 
 const (
-	balanceCollection = "balance"
+	balanceCollection  = "balance"
+	priceCollection    = "price"
+	snapshotCollection = "snapshots"
 )
 
+// portfolioCond matches balances written in snapshots of a portfolio
+const portfolioCond = "snapshot_id IN (SELECT id FROM " + snapshotCollection + " WHERE portfolio = ?)"
+
+// Db is a Store on top of any upper/db session, SQL differences are handled by its dialect
 type Db struct {
-	settings sqlite.ConnectionURL
+	dialect dialect
+	open    func() (db.Session, error)
+	path    string
 }
 
+// BalanceQueryOptions selects balances of the last Days of a portfolio, every portfolio if empty
 type BalanceQueryOptions struct {
-	Days int
+	Days      int
+	Portfolio string
 }
 
-func FromFile(path string) (Db, error) {
-	var settings = sqlite.ConnectionURL{
-		Database: tools.ExpandPath(path),
-	}
-	exists, err := tools.PathExists(path)
-	if exists {
-		sess, err := sqlite.Open(settings)
-		if err != nil {
-			log.Fatalf("Unable to open DB '%v' it might be corrupted: %v", settings, err)
-			return Db{}, err
-		}
-		_ = sess.Close()
-	}
-	return Db{
-		settings: settings,
-	}, err
-}
-
-func GetTestDb() Db {
+func GetTestDb() Store {
 	d, _ := FromFile(GetTestDbPath())
-	return d
+	_, _ = d.Migrate()
+	return &d
 }
 
 func GetTestDbPath() string {
@@ -49,45 +41,65 @@ func GetTestDbPath() string {
 }
 
 func (d *Db) GetSession() (db.Session, error) {
-	sess, err := sqlite.Open(d.settings)
+	sess, err := d.open()
 	if err != nil {
-		log.Fatalf("Unable to open DB '%v' it might be corrupted: %v", d.settings, err)
-		return nil, err
+		return nil, fmt.Errorf("unable to open %v DB, it might be corrupted, see 'coinwatch db restore': %v", d.dialect.name, err)
 	}
 	return sess, nil
 }
 
-func (d *Db) InsertBalance(balance Balance) error {
+// InsertSnapshot stores a snapshot and all its balances in a single transaction, in the default portfolio if
+// none is set
+func (d *Db) InsertSnapshot(snapshot Snapshot, balances []Balance) (Snapshot, error) {
+	if snapshot.Portfolio == "" {
+		snapshot.Portfolio = DefaultPortfolio
+	}
 	sess, err := d.GetSession()
 	if err != nil {
-		return err
+		return Snapshot{}, err
 	}
 	defer func(sess db.Session) {
 		_ = sess.Close()
 	}(sess)
-	collection := sess.Collection(balanceCollection)
-	// Table not there just create one
-	exists, _ := collection.Exists()
-	if !exists {
-		log.Printf("Create main balance table")
-		_, err = sess.SQL().Exec(fmt.Sprintf(`
-        CREATE TABLE %v (
-            ts TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
-			wallet TEXT,
-			token TEXT,
-			address TEXT,
-			balance REAL,
-			balance_locked REAL,
-			fiat_value REAL
-        )`, balanceCollection))
+	err = sess.Tx(func(tx db.Session) error {
+		snapshot.Id = 0
+		r, err := tx.Collection(snapshotCollection).Insert(snapshot)
 		if err != nil {
-			log.Fatalf("Unable to create main balance table")
 			return err
 		}
+		snapshot.Id = toInt64(r.ID())
+		for _, b := range balances {
+			b.SnapshotId = snapshot.Id
+			b.Timestamp = snapshot.Timestamp
+			if _, err := tx.Collection(balanceCollection).Insert(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, err
 	}
-	// Insert
-	_, err = collection.Insert(balance)
-	return err
+	log.Printf("Stored snapshot %d with %d balances", snapshot.Id, len(balances))
+	return snapshot, nil
+}
+
+// GetSnapshots returns snapshots taken after from, most recent first
+func (d *Db) GetSnapshots(from time.Time) ([]Snapshot, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	var result []Snapshot
+	err = sess.SQL().
+		SelectFrom(snapshotCollection).
+		Where("ts >= ?", from.Local()).
+		OrderBy("ts DESC").
+		All(&result)
+	return result, err
 }
 
 func (d *Db) GetBalances(options BalanceQueryOptions) (Balances, error) {
@@ -114,8 +126,10 @@ func (d *Db) GetBalances(options BalanceQueryOptions) (Balances, error) {
 		OrderBy("ts desc")
 	// Day limit
 	if options.Days > 0 {
-		q = q.Where(fmt.Sprintf("ts BETWEEN datetime('now', '-%d days') "+
-			"AND datetime('now', 'localtime')", options.Days))
+		q = q.And("ts >= ?", time.Now().AddDate(0, 0, -options.Days))
+	}
+	if options.Portfolio != "" {
+		q = q.And(portfolioCond, options.Portfolio)
 	}
 	// Query
 	log.Printf(q.String())
@@ -129,7 +143,8 @@ func (d *Db) GetBalances(options BalanceQueryOptions) (Balances, error) {
 	}, nil
 }
 
-func (d *Db) GetBalancesFromDate(from time.Time) (Balances, error) {
+// GetBalancesFromDate returns balances of a portfolio since from, every portfolio if empty
+func (d *Db) GetBalancesFromDate(from time.Time, portfolio string) (Balances, error) {
 	sess, err := d.GetSession()
 	if err != nil {
 		return Balances{}, err
@@ -144,12 +159,14 @@ func (d *Db) GetBalancesFromDate(from time.Time) (Balances, error) {
 		return Balances{}, nil
 	}
 	// Prepare the query
-	fromStr := from.Format(time.RFC3339)
 	var result []Balance
 	q := sess.SQL().
 		SelectFrom(balanceCollection).
-		Where(fmt.Sprintf("ts BETWEEN '%s' AND datetime('now', 'localtime')", fromStr)).
+		Where("ts >= ?", from.Local()).
 		OrderBy("ts ASC")
+	if portfolio != "" {
+		q = q.And(portfolioCond, portfolio)
+	}
 	log.Printf("SQL: %s", q.String())
 	if err := q.All(&result); err != nil {
 		return Balances{}, err
@@ -158,3 +175,157 @@ func (d *Db) GetBalancesFromDate(from time.Time) (Balances, error) {
 	// Return all raw balances in a Balances container
 	return Balances{entries: result}, nil
 }
+
+// InsertPrices stores fetched prices so they can be used as a fallback later on
+func (d *Db) InsertPrices(prices TokenPrices) error {
+	sess, err := d.GetSession()
+	if err != nil {
+		return err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	collection := sess.Collection(priceCollection)
+	for _, p := range prices.Entries {
+		if p.Stale || p.Cached {
+			continue
+		}
+		if _, err := collection.Insert(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLastPrice returns the most recent stored price for token not older than maxAge
+func (d *Db) GetLastPrice(token string, fiat string, maxAge time.Duration) (TokenPrice, bool, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return TokenPrice{}, false, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	since := time.Now().Add(-maxAge)
+	// Check stored prices first
+	if exists, _ := sess.Collection(priceCollection).Exists(); exists {
+		var prices []TokenPrice
+		err := sess.SQL().
+			SelectFrom(priceCollection).
+			Where("LOWER(token) = ? AND LOWER(fiat) = ? AND ts >= ?", strings.ToLower(token), strings.ToLower(fiat), since).
+			OrderBy("ts DESC").
+			Limit(1).
+			All(&prices)
+		if err != nil {
+			return TokenPrice{}, false, err
+		}
+		if len(prices) > 0 {
+			return prices[0], true, nil
+		}
+	}
+	// Older databases only have balances, price can be derived from those
+	if exists, _ := sess.Collection(balanceCollection).Exists(); exists {
+		return d.balancePrice(sess, token, fiat, "ts >= ?", "ts DESC", since)
+	}
+	return TokenPrice{}, false, nil
+}
+
+// balancePrice derives a price from the first balance of token in a snapshot valued in fiat matching where.
+// Snapshots written before the fiat was stored have none, they are taken as valued in fiat as databases only held
+// one then
+func (d *Db) balancePrice(sess db.Session, token string, fiat string, where string, order string, args ...interface{}) (TokenPrice, bool, error) {
+	cond := fmt.Sprintf(
+		"LOWER(token) = ? AND %v > 0 AND %v > 0 AND snapshot_id IN (SELECT id FROM %v WHERE LOWER(fiat) = ? OR fiat = '' OR fiat IS NULL) AND %v",
+		d.dialect.number("balance"), d.dialect.number("fiat_value"), snapshotCollection, where,
+	)
+	var balances []Balance
+	err := sess.SQL().
+		SelectFrom(balanceCollection).
+		Where(append([]interface{}{cond, strings.ToLower(token), strings.ToLower(fiat)}, args...)...).
+		OrderBy(order).
+		Limit(1).
+		All(&balances)
+	if err != nil {
+		return TokenPrice{}, false, err
+	}
+	if len(balances) == 0 {
+		return TokenPrice{}, false, nil
+	}
+	return TokenPrice{
+		Timestamp: balances[0].Timestamp,
+		Token:     token,
+		Price:     balances[0].PricePerToken(),
+		Fiat:      fiat,
+	}, true, nil
+}
+
+// GetPriceAt returns the stored price closest to at, before or after, or the one derived from the closest balance
+// when no price is stored on that side. Found is false if none is within maxAge
+func (d *Db) GetPriceAt(token string, fiat string, at time.Time, maxAge time.Duration) (TokenPrice, bool, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return TokenPrice{}, false, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	var r TokenPrice
+	found := false
+	for _, q := range []struct {
+		where string
+		order string
+	}{
+		{"ts <= ? AND ts >= ?", "ts DESC"},
+		{"ts > ? AND ts <= ?", "ts ASC"},
+	} {
+		bound := at.Add(-maxAge)
+		if q.order == "ts ASC" {
+			bound = at.Add(maxAge)
+		}
+		var prices []TokenPrice
+		err := sess.SQL().
+			SelectFrom(priceCollection).
+			Where("LOWER(token) = ? AND LOWER(fiat) = ? AND "+q.where, strings.ToLower(token), strings.ToLower(fiat), at.Local(), bound.Local()).
+			OrderBy(q.order).
+			Limit(1).
+			All(&prices)
+		if err != nil {
+			return TokenPrice{}, false, err
+		}
+		// Prices are only stored since migration 3, older events are valued from balances like GetLastPrice
+		if len(prices) == 0 {
+			p, ok, err := d.balancePrice(sess, token, fiat, q.where, q.order, at.Local(), bound.Local())
+			if err != nil {
+				return TokenPrice{}, false, err
+			}
+			if ok {
+				prices = append(prices, p)
+			}
+		}
+		if len(prices) > 0 && (!found || absDuration(prices[0].Timestamp.Sub(at)) < absDuration(r.Timestamp.Sub(at))) {
+			r = prices[0]
+			found = true
+		}
+	}
+	return r, found, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func toInt64(id db.ID) int64 {
+	switch v := id.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,466 @@
+package data
+
+import (
+	"github.com/shopspring/decimal"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func getTempDb(t *testing.T) *Db {
+	d, err := FromFile(filepath.Join(t.TempDir(), "coinwatch.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return &d
+}
+
+func TestDb_InsertSnapshot(t *testing.T) {
+	d := getTempDb(t)
+	ts := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 2; i++ {
+		s, err := d.InsertSnapshot(Snapshot{Timestamp: ts, Status: SnapshotComplete, Wallets: 1, Fiat: "EUR"}, []Balance{
+			{Wallet: "w", Token: "dot", Address: "a", Balance: decimal.NewFromInt(1), FiatValue: decimal.NewFromInt(10)},
+			{Wallet: "w", Token: "ksm", Address: "b", Balance: decimal.NewFromInt(2), FiatValue: decimal.NewFromInt(20)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Id != int64(i+1) {
+			t.Errorf("Expected snapshot id %d got %d", i+1, s.Id)
+		}
+	}
+	b, err := d.GetBalances(BalanceQueryOptions{Days: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Entries()) != 4 {
+		t.Errorf("Expected 4 balances got %d", len(b.Entries()))
+	}
+	// Same timestamp, different snapshots
+	last := b.LastSample()
+	if len(last.Entries()) != 2 || !last.TotalFiatValue().Equal(decimal.NewFromInt(30)) {
+		t.Errorf("Unexpected last sample %v", last.Entries())
+	}
+	snapshots, err := d.GetSnapshots(ts.Add(-time.Minute))
+	if err != nil || len(snapshots) != 2 {
+		t.Errorf("Expected 2 snapshots got %v %v", snapshots, err)
+	}
+}
+
+func TestDb_GetTimeSeries(t *testing.T) {
+	d := getTempDb(t)
+	now := time.Now().Truncate(time.Second)
+	// Snapshots every 30 minutes for 5 hours, none between 2 and 3 hours ago
+	for m := 0; m <= 300; m += 30 {
+		if m > 120 && m < 180 {
+			continue
+		}
+		_, err := d.InsertSnapshot(Snapshot{Timestamp: now.Add(-time.Duration(m) * time.Minute)}, []Balance{
+			{Wallet: "a", Token: "dot", Address: "x", Balance: decimal.NewFromInt(1), FiatValue: decimal.NewFromInt(int64(m))},
+			{Wallet: "b", Token: "DOT", Address: "y", Balance: decimal.NewFromInt(2), FiatValue: decimal.NewFromInt(1)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	series, err := d.GetTimeSeries(TimeSeriesOptions{Amount: 6, Interval: time.Hour, GroupBy: GroupByToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 6 {
+		t.Fatalf("Expected 6 buckets got %d", len(series))
+	}
+	for i, s := range series {
+		if len(s.Entries()) != 1 {
+			t.Fatalf("Expected 1 grouped entry in bucket %d got %v", i, s.Entries())
+		}
+		e := s.Entries()[0]
+		if !e.Balance.Equal(decimal.NewFromInt(3)) || !e.FiatValue.Equal(decimal.NewFromInt(int64(i*60+1))) {
+			t.Errorf("Unexpected entry in bucket %d: %+v", i, e)
+		}
+	}
+	raw, err := d.GetTimeSeries(TimeSeriesOptions{Amount: 2, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw[1].Entries()) != 2 {
+		t.Errorf("Expected 2 raw entries got %v", raw[1].Entries())
+	}
+}
+
+func TestDb_Portfolios(t *testing.T) {
+	d := getTempDb(t)
+	now := time.Now().Truncate(time.Second)
+	for i, p := range []string{"", "fund", "fund"} {
+		_, err := d.InsertSnapshot(Snapshot{Timestamp: now.Add(-time.Duration(i) * time.Minute), Portfolio: p}, []Balance{
+			{Wallet: p, Token: "dot", Address: "x", Balance: decimal.NewFromInt(1), FiatValue: decimal.NewFromInt(int64(i))},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := d.GetBalances(BalanceQueryOptions{Days: 1, Portfolio: DefaultPortfolio})
+	if err != nil || len(b.Entries()) != 1 || b.Entries()[0].Wallet != "" {
+		t.Errorf("Unexpected default portfolio balances %v %v", b.Entries(), err)
+	}
+	b, err = d.GetBalancesFromDate(now.Add(-time.Hour), "fund")
+	if err != nil || len(b.Entries()) != 2 {
+		t.Errorf("Unexpected fund balances %v %v", b.Entries(), err)
+	}
+	b, err = d.GetBalances(BalanceQueryOptions{Days: 1})
+	if err != nil || len(b.Entries()) != 3 {
+		t.Errorf("Expected balances of every portfolio got %v %v", b.Entries(), err)
+	}
+	series, err := d.GetTimeSeries(TimeSeriesOptions{Amount: 1, Interval: time.Hour, Portfolio: "fund"})
+	if err != nil || len(series) != 1 || len(series[0].Entries()) != 1 || series[0].Entries()[0].Wallet != "fund" {
+		t.Errorf("Unexpected fund time series %v %v", series, err)
+	}
+}
+
+func TestDb_GetTimeSeriesExactSums(t *testing.T) {
+	d := getTempDb(t)
+	dec := func(s string) decimal.Decimal {
+		v, _ := decimal.NewFromString(s)
+		return v
+	}
+	_, err := d.InsertSnapshot(Snapshot{Timestamp: time.Now().Truncate(time.Second)}, []Balance{
+		{Wallet: "a", Token: "dot", Address: "x", Balance: dec("0.1"), FiatValue: dec("12345678.223456789")},
+		{Wallet: "a", Token: "DOT", Address: "y", Balance: dec("0.2"), FiatValue: dec("0.000000001")},
+		{Wallet: "b", Token: "dot", Address: "z", Balance: dec("0.3"), FiatValue: dec("0.1")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, err := d.GetTimeSeries(TimeSeriesOptions{Amount: 1, Interval: time.Hour, GroupBy: GroupByToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := series[0].Entries(); len(e) != 1 || e[0].Balance.String() != "0.6" || e[0].FiatValue.String() != "12345678.32345679" {
+		t.Errorf("Unexpected token sums %+v", e)
+	}
+	series, err = d.GetTimeSeries(TimeSeriesOptions{Amount: 1, Interval: time.Hour, GroupBy: GroupByWallet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range series[0].Entries() {
+		if e.Wallet == "a" && (e.Balance.String() != "0.3" || e.FiatValue.String() != "12345678.22345679") {
+			t.Errorf("Unexpected wallet sums %+v", e)
+		}
+	}
+	if len(series[0].Entries()) != 2 {
+		t.Errorf("Expected 2 wallets got %+v", series[0].Entries())
+	}
+}
+
+func TestDb_Compact(t *testing.T) {
+	d := getTempDb(t)
+	// Hour aligned so tier boundaries fall on bucket boundaries
+	now := time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC)
+	// Snapshots every 15 minutes over the last 4 days
+	for m := 0; m < 4*24*60; m += 15 {
+		status := SnapshotComplete
+		if m%60 == 45 {
+			status = SnapshotPartial
+		}
+		_, err := d.InsertSnapshot(Snapshot{Timestamp: now.Add(-time.Duration(m) * time.Minute), Status: status}, []Balance{
+			{Wallet: "w", Token: "dot", Address: "a", Balance: decimal.NewFromInt(1), FiatValue: decimal.NewFromInt(10)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tiers := []RetentionTier{
+		{Age: time.Hour * 72, Interval: time.Hour * 24},
+		{Age: time.Hour * 24, Interval: time.Hour},
+	}
+	dry, err := d.compact(tiers, true, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.compact(tiers, false, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dry != r || r.Snapshots != r.Balances || r.Snapshots == 0 {
+		t.Errorf("Unexpected compaction result %v dry run %v", r, dry)
+	}
+	snapshots, err := d.GetSnapshots(now.Add(-time.Hour * 24 * 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4 per hour for a day, one per hour for two days plus the bucket of the hourly tier start and two daily
+	// buckets, the last day only covers half of one
+	recent, hourly, daily := 0, 0, 0
+	for _, s := range snapshots {
+		age := now.Sub(s.Timestamp)
+		switch {
+		case age < time.Hour*24:
+			recent++
+		case age < time.Hour*72:
+			hourly++
+			if s.Status != SnapshotComplete {
+				t.Errorf("Partial snapshot kept at %v", s.Timestamp)
+			}
+		default:
+			daily++
+		}
+	}
+	if recent != 96 || hourly != 49 || daily != 2 {
+		t.Errorf("Unexpected snapshots left %d recent %d hourly %d daily", recent, hourly, daily)
+	}
+	// Running again is a no-op
+	r, err = d.compact(tiers, false, now)
+	if err != nil || r.Snapshots != 0 {
+		t.Errorf("Expected nothing to compact got %v %v", r, err)
+	}
+}
+
+func TestDb_DecimalPrecision(t *testing.T) {
+	d := getTempDb(t)
+	balance, _ := decimal.NewFromString("0.123456789012345678")
+	value, _ := decimal.NewFromString("12345678.901234567890")
+	_, err := d.InsertSnapshot(Snapshot{Timestamp: time.Now(), Status: SnapshotComplete}, []Balance{
+		{Wallet: "w", Token: "eth", Address: "a", Balance: balance, FiatValue: value},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.GetBalances(BalanceQueryOptions{Days: 1})
+	if err != nil || len(b.Entries()) != 1 {
+		t.Fatalf("Expected 1 balance got %v %v", b.Entries(), err)
+	}
+	if e := b.Entries()[0]; !e.Balance.Equal(balance) || !e.FiatValue.Equal(value) {
+		t.Errorf("Decimals not preserved, got %v and %v", e.Balance, e.FiatValue)
+	}
+}
+
+func TestDb_Import(t *testing.T) {
+	d := getTempDb(t)
+	ts := time.Now().Add(-time.Hour).Truncate(time.Second)
+	_, err := d.InsertSnapshot(Snapshot{Timestamp: ts, Status: SnapshotComplete, Wallets: 1, Fiat: "EUR"}, []Balance{
+		{Wallet: "w", Token: "dot", Address: "a", Balance: decimal.NewFromInt(1), FiatValue: decimal.NewFromInt(10)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump, err := d.Export(ts.Add(-time.Minute), time.Now())
+	if err != nil || len(dump.Snapshots) != 1 || len(dump.Balances) != 1 {
+		t.Fatalf("Unexpected export %v %v", dump, err)
+	}
+	// Balances without a snapshot get a new one
+	dump.Balances = append(dump.Balances, Balance{
+		Timestamp: ts.Add(-time.Hour), Wallet: "w", Token: "ksm", Balance: decimal.NewFromInt(2),
+	})
+	dump.Prices = []TokenPrice{{Timestamp: ts, Token: "DOT", Fiat: "EUR", Price: decimal.NewFromInt(10)}}
+	r, err := d.Import(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Snapshots != 1 || r.Balances != 1 || r.Prices != 1 || r.Skipped != 2 {
+		t.Errorf("Unexpected import result %+v", r)
+	}
+	// Importing twice writes nothing
+	r, err = d.Import(dump)
+	if err != nil || r.Snapshots != 0 || r.Balances != 0 || r.Prices != 0 || r.Skipped != 4 {
+		t.Errorf("Expected everything skipped got %+v %v", r, err)
+	}
+}
+
+func TestDb_ImportPortfolios(t *testing.T) {
+	source, d := getTempDb(t), getTempDb(t)
+	ts := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, portfolio := range []string{"a", "b"} {
+		_, err := source.InsertSnapshot(Snapshot{Timestamp: ts, Status: SnapshotComplete, Wallets: 1, Portfolio: portfolio}, []Balance{
+			{Wallet: portfolio, Token: "dot", Balance: decimal.NewFromInt(1)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	dump, err := source.Export(ts.Add(-time.Minute), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Links do not rely on ids of the source DB
+	for i := range dump.Balances {
+		dump.Balances[i].SnapshotId = 0
+	}
+	r, err := d.Import(dump)
+	if err != nil || r.Snapshots != 2 || r.Balances != 2 || r.Skipped != 0 {
+		t.Fatalf("Unexpected import result %+v %v", r, err)
+	}
+	for _, portfolio := range []string{"a", "b"} {
+		b, err := d.GetBalancesFromDate(ts.Add(-time.Minute), portfolio)
+		if err != nil || len(b.Entries()) != 1 || b.Entries()[0].Wallet != portfolio {
+			t.Errorf("Expected the %v balance in portfolio %v got %v %v", portfolio, portfolio, b.Entries(), err)
+		}
+	}
+}
+
+func TestDb_BackupRestore(t *testing.T) {
+	d := getTempDb(t)
+	dir := t.TempDir()
+	insert := func() {
+		_, err := d.InsertSnapshot(Snapshot{Timestamp: time.Now(), Status: SnapshotComplete}, []Balance{
+			{Wallet: "w", Token: "dot", Balance: decimal.NewFromInt(1)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert()
+	for i, compress := range []bool{false, true} {
+		path := BackupPath(dir, time.Now().Add(time.Duration(i)*time.Second), compress)
+		if err := d.Backup(path); err != nil {
+			t.Fatal(err)
+		}
+		insert()
+		if err := d.Restore(path); err != nil {
+			t.Fatal(err)
+		}
+		snapshots, err := d.GetSnapshots(time.Now().Add(-time.Hour))
+		if err != nil || len(snapshots) != i+1 {
+			t.Errorf("Expected %d snapshots after restore got %v %v", i+1, snapshots, err)
+		}
+		insert()
+	}
+	// Broken backups are refused
+	broken := filepath.Join(dir, "broken.db")
+	if err := os.WriteFile(broken, []byte("not a db"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Restore(broken); err == nil {
+		t.Error("Expected an error restoring a broken backup")
+	}
+	// Rotation keeps the most recent
+	removed, err := RotateBackups(dir, 1)
+	if err != nil || len(removed) != 1 || filepath.Ext(removed[0]) != ".db" {
+		t.Errorf("Expected the oldest backup removed got %v %v", removed, err)
+	}
+}
+
+func TestDb_InsertTransactions(t *testing.T) {
+	d := getTempDb(t)
+	ts := time.Now().Add(-time.Hour).Truncate(time.Second)
+	txs := []Transaction{
+		{Timestamp: ts, TxId: "a", Type: TxDeposit, Token: "dot", Amount: decimal.NewFromInt(10), Fee: decimal.Zero},
+		{Timestamp: ts.Add(time.Minute), TxId: "b", Type: TxWithdrawal, Token: "ksm", Amount: decimal.NewFromInt(-1), Fee: decimal.RequireFromString("0.01")},
+	}
+	n, err := d.InsertTransactions("w", txs, TransactionCursors{"addr": "100"})
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 transactions got %v %v", n, err)
+	}
+	// Same ids are skipped and cursors move
+	n, err = d.InsertTransactions("w", txs[1:], TransactionCursors{"addr": "120"})
+	if err != nil || n != 0 {
+		t.Errorf("Expected no new transaction got %v %v", n, err)
+	}
+	cursors, err := d.GetTransactionCursors("w")
+	if err != nil || len(cursors) != 1 || cursors["addr"] != "120" {
+		t.Errorf("Unexpected cursors %v %v", cursors, err)
+	}
+	r, err := d.GetTransactions(TransactionQueryOptions{Token: "KSM"})
+	if err != nil || len(r) != 1 || r[0].Wallet != "w" || !r[0].Fee.Equal(decimal.RequireFromString("0.01")) {
+		t.Errorf("Unexpected transactions %v %v", r, err)
+	}
+}
+
+func TestDb_GetLastPriceFromBalances(t *testing.T) {
+	d := getTempDb(t)
+	now := time.Now().Truncate(time.Second)
+	for i, fiat := range []string{"", "EUR", "USD"} {
+		_, err := d.InsertSnapshot(Snapshot{Timestamp: now.Add(time.Duration(i-3) * time.Hour), Status: SnapshotComplete, Fiat: fiat}, []Balance{
+			{Wallet: "w", Token: "dot", Balance: decimal.NewFromInt(2), FiatValue: decimal.NewFromInt(int64(20 + i*2))},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, found, err := d.GetLastPrice("DOT", "eur", time.Hour*24)
+	if err != nil || !found || !p.Price.Equal(decimal.NewFromInt(11)) || p.Fiat != "eur" {
+		t.Errorf("Expected EUR price 11 got %v %v %v", p, found, err)
+	}
+	p, found, err = d.GetLastPrice("DOT", "usd", time.Hour*24)
+	if err != nil || !found || !p.Price.Equal(decimal.NewFromInt(12)) {
+		t.Errorf("Expected USD price 12 got %v %v %v", p, found, err)
+	}
+	// Snapshots without fiat are valued in any
+	p, found, err = d.GetLastPrice("DOT", "chf", time.Hour*24)
+	if err != nil || !found || !p.Price.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Expected price 10 of the snapshot without fiat got %v %v %v", p, found, err)
+	}
+}
+
+func TestDb_GetPriceAt(t *testing.T) {
+	d := getTempDb(t)
+	now := time.Now().Truncate(time.Second)
+	err := d.InsertPrices(TokenPrices{Entries: []TokenPrice{
+		{Timestamp: now.Add(-10 * time.Hour), Token: "DOT", Fiat: "EUR", Price: decimal.NewFromInt(10)},
+		{Timestamp: now.Add(-2 * time.Hour), Token: "DOT", Fiat: "EUR", Price: decimal.NewFromInt(12)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, found, err := d.GetPriceAt("dot", "eur", now.Add(-3*time.Hour), time.Hour*24)
+	if err != nil || !found || !p.Price.Equal(decimal.NewFromInt(12)) {
+		t.Errorf("Expected closest price 12 got %v %v %v", p, found, err)
+	}
+	p, found, err = d.GetPriceAt("dot", "eur", now.Add(-9*time.Hour), time.Hour*24)
+	if err != nil || !found || !p.Price.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Expected closest price 10 got %v %v %v", p, found, err)
+	}
+	if _, found, _ := d.GetPriceAt("dot", "eur", now.Add(-48*time.Hour), time.Hour); found {
+		t.Error("Expected no price older than max age")
+	}
+}
+
+func TestDb_Events(t *testing.T) {
+	d := getTempDb(t)
+	now := time.Now().Truncate(time.Second)
+	err := d.InsertEvents([]Event{
+		{Timestamp: now.Add(-time.Hour * 48), Portfolio: "main", Kind: EventDrop, Wallet: "w", Token: "DOT", Previous: decimal.NewFromInt(10), Current: decimal.NewFromInt(5), FiatValue: decimal.NewFromInt(30)},
+		{Timestamp: now.Add(-time.Hour), Portfolio: "main", Kind: EventMissing, Wallet: "w", Token: "ETH", Previous: decimal.NewFromInt(1), FiatValue: decimal.NewFromInt(2000)},
+		{Timestamp: now, Portfolio: "main", Kind: EventNewToken, Wallet: "w", Token: "ATOM", Current: decimal.NewFromInt(3), FiatValue: decimal.NewFromInt(30)},
+		{Timestamp: now, Portfolio: "kids", Kind: EventDrop, Wallet: "k", Token: "BTC", Previous: decimal.NewFromInt(1), FiatValue: decimal.NewFromInt(20000)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := d.GetEvents(EventQueryOptions{From: now.Add(-time.Hour * 24), Portfolio: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Token != "ATOM" || events[1].Kind != EventMissing || events[1].Change() != -1 {
+		t.Errorf("Unexpected events %+v", events)
+	}
+	if events, _ = d.GetEvents(EventQueryOptions{Kind: EventDrop}); len(events) != 2 {
+		t.Errorf("Expected 2 drops got %+v", events)
+	}
+}
+
+func TestDb_HeldTokens(t *testing.T) {
+	d := getTempDb(t)
+	now := time.Now().Truncate(time.Second)
+	balances := []Balance{
+		{Wallet: "W", Token: "dot", Balance: decimal.NewFromInt(1)},
+		{Wallet: "w", Token: "shib", Balance: decimal.RequireFromString("0.001")},
+		{Wallet: "w", Token: "eth", Balance: decimal.Zero},
+	}
+	for i := 0; i < 2; i++ {
+		if err := d.InsertHeldTokens("main", now.Add(time.Duration(i)*time.Hour), balances); err != nil {
+			t.Fatal(err)
+		}
+	}
+	held, err := d.GetHeldTokens("main")
+	if err != nil || len(held) != 2 || held[0].Wallet != "w" || held[0].Token != "DOT" || !held[0].FirstSeen.Equal(now) {
+		t.Errorf("Unexpected held tokens %+v %v", held, err)
+	}
+	if held, _ = d.GetHeldTokens("kids"); len(held) != 0 {
+		t.Errorf("Expected nothing held by another portfolio got %+v", held)
+	}
+}
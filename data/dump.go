@@ -0,0 +1,222 @@
+package data
+
+import (
+	"fmt"
+	"github.com/scylladb/go-set"
+	"github.com/scylladb/go-set/strset"
+	"github.com/upper/db/v4"
+	"log"
+	"strings"
+	"time"
+)
+
+// Dump holds snapshots, balances and prices of a time range, balances are linked to snapshots by portfolio and
+// timestamp
+type Dump struct {
+	Snapshots []Snapshot
+	Balances  []Balance
+	Prices    []TokenPrice
+}
+
+// ImportResult counts rows written and rows skipped because already present
+type ImportResult struct {
+	Snapshots int
+	Balances  int
+	Prices    int
+	Skipped   int
+}
+
+// Export returns everything stored in [from, to)
+func (d *Db) Export(from time.Time, to time.Time) (Dump, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return Dump{}, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	var r Dump
+	for _, q := range []struct {
+		collection string
+		result     interface{}
+	}{
+		{snapshotCollection, &r.Snapshots},
+		{balanceCollection, &r.Balances},
+		{priceCollection, &r.Prices},
+	} {
+		err := sess.SQL().
+			SelectFrom(q.collection).
+			Where("ts >= ? AND ts < ?", from.Local(), to.Local()).
+			OrderBy("ts ASC").
+			All(q.result)
+		if err != nil {
+			return Dump{}, err
+		}
+	}
+	// Balances are linked to snapshots by portfolio and timestamp outside the DB
+	portfolios := make(map[int64]string)
+	for _, s := range r.Snapshots {
+		portfolios[s.Id] = s.Portfolio
+	}
+	for i, b := range r.Balances {
+		r.Balances[i].Portfolio = portfolios[b.SnapshotId]
+	}
+	log.Printf("Exported %d snapshots, %d balances and %d prices", len(r.Snapshots), len(r.Balances), len(r.Prices))
+	return r, nil
+}
+
+// Import writes a dump in a single transaction, snapshots are matched by portfolio and timestamp and balances by
+// Id so importing the same dump twice writes nothing. Balances without a snapshot get a new complete one
+func (d *Db) Import(dump Dump) (ImportResult, error) {
+	// Group by portfolio and timestamp
+	snapshots := make(map[string]Snapshot)
+	balances := make(map[string][]Balance)
+	keys := make([]string, 0)
+	timestamps := make([]time.Time, 0)
+	add := func(key string, ts time.Time) {
+		if _, ok := snapshots[key]; !ok && len(balances[key]) == 0 {
+			keys = append(keys, key)
+			timestamps = append(timestamps, ts)
+		}
+	}
+	for _, s := range dump.Snapshots {
+		// Dumps written before portfolios
+		if s.Portfolio == "" {
+			s.Portfolio = DefaultPortfolio
+		}
+		key := snapshotKey(s.Portfolio, s.Timestamp)
+		add(key, s.Timestamp)
+		snapshots[key] = s
+	}
+	for _, b := range dump.Balances {
+		if b.Portfolio == "" {
+			b.Portfolio = DefaultPortfolio
+		}
+		key := snapshotKey(b.Portfolio, b.Timestamp)
+		add(key, b.Timestamp)
+		balances[key] = append(balances[key], b)
+	}
+	// Range to check for existing rows
+	all := append([]time.Time{}, timestamps...)
+	for _, p := range dump.Prices {
+		all = append(all, p.Timestamp)
+	}
+	if len(all) == 0 {
+		return ImportResult{}, nil
+	}
+	from, to := all[0], all[0]
+	for _, ts := range all {
+		if ts.Before(from) {
+			from = ts
+		}
+		if ts.After(to) {
+			to = ts
+		}
+	}
+	// Existing rows in range
+	existing, err := d.Export(from.Add(-time.Second), to.Add(time.Second))
+	if err != nil {
+		return ImportResult{}, err
+	}
+	existingSnapshots := make(map[string]Snapshot)
+	for _, s := range existing.Snapshots {
+		existingSnapshots[snapshotKey(s.Portfolio, s.Timestamp)] = s
+	}
+	existingBalances := make(map[int64]*strset.Set)
+	for _, b := range existing.Balances {
+		if _, ok := existingBalances[b.SnapshotId]; !ok {
+			existingBalances[b.SnapshotId] = set.NewStringSet()
+		}
+		existingBalances[b.SnapshotId].Add(b.Id())
+	}
+	existingPrices := set.NewStringSet()
+	for _, p := range existing.Prices {
+		existingPrices.Add(priceKey(p))
+	}
+	// Write
+	sess, err := d.GetSession()
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	var r ImportResult
+	err = sess.Tx(func(tx db.Session) error {
+		r = ImportResult{}
+		for i, key := range keys {
+			ts := timestamps[i]
+			entries := balances[key]
+			snapshot, hasSnapshot := snapshots[key]
+			// Find or create the snapshot
+			target, ok := existingSnapshots[key]
+			if !ok {
+				if !hasSnapshot {
+					snapshot = Snapshot{Timestamp: ts, Status: SnapshotComplete, Wallets: countWallets(entries), Portfolio: entries[0].Portfolio}
+				}
+				snapshot.Id = 0
+				res, err := tx.Collection(snapshotCollection).Insert(snapshot)
+				if err != nil {
+					return err
+				}
+				snapshot.Id = toInt64(res.ID())
+				existingSnapshots[key] = snapshot
+				target = snapshot
+				r.Snapshots++
+			} else if hasSnapshot {
+				r.Skipped++
+			}
+			seen, ok := existingBalances[target.Id]
+			if !ok {
+				seen = set.NewStringSet()
+				existingBalances[target.Id] = seen
+			}
+			for _, b := range entries {
+				if seen.Has(b.Id()) {
+					r.Skipped++
+					continue
+				}
+				b.SnapshotId = target.Id
+				b.Timestamp = target.Timestamp
+				if _, err := tx.Collection(balanceCollection).Insert(b); err != nil {
+					return err
+				}
+				seen.Add(b.Id())
+				r.Balances++
+			}
+		}
+		for _, p := range dump.Prices {
+			if existingPrices.Has(priceKey(p)) {
+				r.Skipped++
+				continue
+			}
+			if _, err := tx.Collection(priceCollection).Insert(p); err != nil {
+				return err
+			}
+			existingPrices.Add(priceKey(p))
+			r.Prices++
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("import failed: %v", err)
+	}
+	log.Printf("Imported %d snapshots, %d balances and %d prices, skipped %d", r.Snapshots, r.Balances, r.Prices, r.Skipped)
+	return r, nil
+}
+
+func snapshotKey(portfolio string, ts time.Time) string {
+	return fmt.Sprintf("%s/%d", strings.ToLower(portfolio), ts.UnixMicro())
+}
+
+func priceKey(p TokenPrice) string {
+	return fmt.Sprintf("%d/%s/%s", p.Timestamp.UnixMicro(), strings.ToUpper(p.Token), strings.ToUpper(p.Fiat))
+}
+
+func countWallets(balances []Balance) int {
+	r := set.NewStringSet()
+	for _, b := range balances {
+		r.Add(b.Wallet)
+	}
+	return r.Size()
+}
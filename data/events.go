@@ -0,0 +1,153 @@
+package data
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/upper/db/v4"
+	"strings"
+	"time"
+)
+
+const (
+	eventCollection = "events"
+	heldCollection  = "held_tokens"
+)
+
+// Event kinds
+const (
+	EventDrop     = "drop"
+	EventMissing  = "missing"
+	EventNewToken = "new_token"
+)
+
+// Event is an anomaly found comparing a snapshot with the previous one, Previous and Current are token quantities
+// and FiatValue what moved valued at the previous price, or at the current one for new tokens
+type Event struct {
+	Id         int64           `db:"id,omitempty" json:"id"`
+	Timestamp  time.Time       `db:"ts" json:"timestamp"`
+	SnapshotId int64           `db:"snapshot_id" json:"snapshot_id"`
+	Portfolio  string          `db:"portfolio" json:"portfolio"`
+	Kind       string          `db:"kind" json:"kind"`
+	Wallet     string          `db:"wallet" json:"wallet"`
+	Token      string          `db:"token" json:"token"`
+	Address    string          `db:"address" json:"address"`
+	Previous   decimal.Decimal `db:"previous_balance" json:"previous"`
+	Current    decimal.Decimal `db:"balance" json:"current"`
+	FiatValue  decimal.Decimal `db:"fiat_value" json:"fiat_value"`
+}
+
+// Change returns the relative quantity change, zero for new tokens
+func (e Event) Change() float64 {
+	if e.Previous.IsZero() {
+		return 0
+	}
+	return e.Current.Sub(e.Previous).Div(e.Previous).InexactFloat64()
+}
+
+// HeldToken is a token a wallet of the portfolio reported since FirstSeen, also when too small to be stored
+type HeldToken struct {
+	Portfolio string    `db:"portfolio" json:"portfolio"`
+	Wallet    string    `db:"wallet" json:"wallet"`
+	Token     string    `db:"token" json:"token"`
+	FirstSeen time.Time `db:"first_seen" json:"first_seen"`
+}
+
+// EventQueryOptions filter events, zero values match everything
+type EventQueryOptions struct {
+	From      time.Time
+	Portfolio string
+	Kind      string
+}
+
+// InsertEvents stores events in a single transaction
+func (d *Db) InsertEvents(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	sess, err := d.GetSession()
+	if err != nil {
+		return err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	return sess.Tx(func(tx db.Session) error {
+		for _, e := range events {
+			e.Id = 0
+			if _, err := tx.Collection(eventCollection).Insert(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetEvents returns stored events, most recent first
+func (d *Db) GetEvents(options EventQueryOptions) ([]Event, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	cond := db.Cond{}
+	if !options.From.IsZero() {
+		cond["ts >="] = options.From.Local()
+	}
+	if options.Portfolio != "" {
+		cond["portfolio"] = options.Portfolio
+	}
+	if options.Kind != "" {
+		cond["kind"] = options.Kind
+	}
+	var r []Event
+	err = sess.Collection(eventCollection).Find(cond).OrderBy("-ts", "-id").All(&r)
+	return r, err
+}
+
+// InsertHeldTokens records tokens of positive balances not held before by the portfolio, wallets are lower case
+// and tokens upper case
+func (d *Db) InsertHeldTokens(portfolio string, ts time.Time, balances []Balance) error {
+	sess, err := d.GetSession()
+	if err != nil {
+		return err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	return sess.Tx(func(tx db.Session) error {
+		var held []HeldToken
+		if err := tx.Collection(heldCollection).Find(db.Cond{"portfolio": portfolio}).All(&held); err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		for _, h := range held {
+			seen[h.Wallet+"/"+h.Token] = true
+		}
+		for _, b := range balances {
+			h := HeldToken{Portfolio: portfolio, Wallet: strings.ToLower(b.Wallet), Token: strings.ToUpper(b.Token), FirstSeen: ts}
+			if !b.Balance.IsPositive() || seen[h.Wallet+"/"+h.Token] {
+				continue
+			}
+			if _, err := tx.Collection(heldCollection).Insert(h); err != nil {
+				return err
+			}
+			seen[h.Wallet+"/"+h.Token] = true
+		}
+		return nil
+	})
+}
+
+// GetHeldTokens returns every token held so far by the portfolio
+func (d *Db) GetHeldTokens(portfolio string) ([]HeldToken, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	var r []HeldToken
+	err = sess.Collection(heldCollection).Find(db.Cond{"portfolio": portfolio}).OrderBy("wallet", "token").All(&r)
+	return r, err
+}
@@ -0,0 +1,289 @@
+package data
+
+import (
+	"fmt"
+	"github.com/upper/db/v4"
+	"log"
+	"time"
+)
+
+const (
+	schemaVersionCollection = "schema_version"
+)
+
+type migration struct {
+	Version int
+	Name    string
+	apply   func(sess db.Session, d dialect) error
+}
+
+// SchemaVersion is a migration applied to the DB
+type SchemaVersion struct {
+	Version int       `db:"version"`
+	Name    string    `db:"name"`
+	Applied time.Time `db:"applied"`
+}
+
+// migrations are applied in order, each one must be idempotent so databases created before versioning
+// can be upgraded safely
+var migrations = []migration{
+	{1, "create balance table", func(sess db.Session, d dialect) error {
+		return execAll(sess, fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %[1]v (
+            ts %[2]v DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			wallet TEXT,
+			token TEXT,
+			address TEXT,
+			balance %[3]v,
+			balance_locked %[3]v,
+			fiat_value %[3]v
+        )`, balanceCollection, d.timestamp, d.real))
+	}},
+	{2, "add balance stale price flag", func(sess db.Session, d dialect) error {
+		return d.addColumn(sess, balanceCollection, "stale_price", d.boolean)
+	}},
+	{3, "create price table", func(sess db.Session, d dialect) error {
+		return execAll(sess, fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %[1]v (
+            ts %[2]v DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			token TEXT,
+			fiat TEXT,
+			price %[3]v
+        )`, priceCollection, d.timestamp, d.real))
+	}},
+	{4, "create gecko symbols cache", func(sess db.Session, d dialect) error {
+		// Old cache picked the first coin with a matching symbol, drop it
+		return execAll(sess, `DROP TABLE IF EXISTS gecko_coins`, fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS gecko_symbols (
+            symbol TEXT,
+			name TEXT,
+			coin_id TEXT,
+			candidates TEXT,
+			source TEXT,
+			updated %v
+        )`, d.timestamp))
+	}},
+	{5, "create kraken assets cache", func(sess db.Session, d dialect) error {
+		return execAll(sess, fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS kraken_assets (
+            name TEXT,
+			alt_name TEXT,
+			updated %v
+        )`, d.timestamp), fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS kraken_pairs (
+            name TEXT,
+			alt_name TEXT,
+			base TEXT,
+			quote TEXT,
+			updated %v
+        )`, d.timestamp))
+	}},
+	{6, "add balance and price indexes", func(sess db.Session, d dialect) error {
+		return execAll(sess,
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS balance_ts ON %v (ts)`, balanceCollection),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS price_token_ts ON %v (token, ts)`, priceCollection),
+		)
+	}},
+	{7, "create hypertables", func(sess db.Session, d dialect) error {
+		if d.hypertable == nil {
+			return nil
+		}
+		for _, table := range []string{balanceCollection, priceCollection} {
+			if err := d.hypertable(sess, table); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{8, "create snapshots table", func(sess db.Session, d dialect) error {
+		err := execAll(sess, fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %v (
+            id %v,
+			ts %v NOT NULL,
+			status TEXT,
+			wallets INTEGER,
+			fiat TEXT
+        )`, snapshotCollection, d.serial, d.timestamp),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS snapshots_ts ON %v (ts)`, snapshotCollection),
+		)
+		if err != nil {
+			return err
+		}
+		if err := d.addColumn(sess, balanceCollection, "snapshot_id", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		// Every distinct timestamp written so far is a snapshot
+		return execAll(sess, fmt.Sprintf(`
+        INSERT INTO %[1]v (ts, status, wallets, fiat)
+            SELECT ts, '%[3]v', COUNT(DISTINCT wallet), '' FROM %[2]v WHERE snapshot_id = 0 GROUP BY ts`,
+			snapshotCollection, balanceCollection, SnapshotComplete,
+		), fmt.Sprintf(`
+        UPDATE %[2]v SET snapshot_id = (SELECT s.id FROM %[1]v s WHERE s.ts = %[2]v.ts)
+            WHERE snapshot_id = 0`,
+			snapshotCollection, balanceCollection,
+		), fmt.Sprintf(`CREATE INDEX IF NOT EXISTS balance_snapshot ON %v (snapshot_id)`, balanceCollection))
+	}},
+	{9, "store amounts and prices as decimals", func(sess db.Session, d dialect) error {
+		if err := d.alterDecimal(sess, balanceCollection, []string{"balance", "balance_locked", "fiat_value"}); err != nil {
+			return err
+		}
+		return d.alterDecimal(sess, priceCollection, []string{"price"})
+	}},
+	{10, "create transactions tables", func(sess db.Session, d dialect) error {
+		return execAll(sess, fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %[1]v (
+            ts %[2]v NOT NULL,
+			wallet TEXT,
+			tx_id TEXT,
+			ref_id TEXT,
+			type TEXT,
+			token TEXT,
+			address TEXT,
+			amount %[3]v,
+			fee %[3]v
+        )`, transactionCollection, d.timestamp, d.decimal),
+			fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS transactions_wallet_tx ON %v (wallet, tx_id)`, transactionCollection),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS transactions_ts ON %v (ts)`, transactionCollection),
+			fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %v (
+            wallet TEXT,
+			source TEXT,
+			cursor TEXT,
+			updated %v
+        )`, cursorCollection, d.timestamp),
+		)
+	}},
+	{11, "add snapshot portfolio", func(sess db.Session, d dialect) error {
+		if err := d.addColumn(sess, snapshotCollection, "portfolio", fmt.Sprintf("TEXT NOT NULL DEFAULT '%v'", DefaultPortfolio)); err != nil {
+			return err
+		}
+		return execAll(sess, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS snapshots_portfolio_ts ON %v (portfolio, ts)`, snapshotCollection))
+	}},
+	{12, "create events table", func(sess db.Session, d dialect) error {
+		return execAll(sess, fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %[1]v (
+            id %[2]v,
+			ts %[3]v NOT NULL,
+			snapshot_id INTEGER,
+			portfolio TEXT,
+			kind TEXT,
+			wallet TEXT,
+			token TEXT,
+			address TEXT,
+			previous_balance %[4]v,
+			balance %[4]v,
+			fiat_value %[4]v
+        )`, eventCollection, d.serial, d.timestamp, d.decimal),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS events_ts ON %v (ts)`, eventCollection),
+		)
+	}},
+	{13, "create held tokens table", func(sess db.Session, d dialect) error {
+		return execAll(sess, fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %[1]v (
+			portfolio TEXT NOT NULL,
+			wallet TEXT NOT NULL,
+			token TEXT NOT NULL,
+			first_seen %[2]v
+        )`, heldCollection, d.timestamp),
+			fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS held_tokens_key ON %v (portfolio, wallet, token)`, heldCollection),
+		)
+	}},
+}
+
+// SchemaVersions returns migrations applied so far
+func (d *Db) SchemaVersions() ([]SchemaVersion, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	if err := createSchemaVersionTable(sess); err != nil {
+		return nil, err
+	}
+	var versions []SchemaVersion
+	err = sess.Collection(schemaVersionCollection).Find().OrderBy("version").All(&versions)
+	return versions, err
+}
+
+// PendingMigrations returns the names of migrations not applied yet
+func (d *Db) PendingMigrations() ([]string, error) {
+	versions, err := d.SchemaVersions()
+	if err != nil {
+		return nil, err
+	}
+	current := 0
+	if len(versions) > 0 {
+		current = versions[len(versions)-1].Version
+	}
+	r := make([]string, 0)
+	for _, m := range migrations {
+		if m.Version > current {
+			r = append(r, fmt.Sprintf("%d %s", m.Version, m.Name))
+		}
+	}
+	return r, nil
+}
+
+// Migrate applies pending migrations in order, each one in its own transaction
+func (d *Db) Migrate() ([]SchemaVersion, error) {
+	versions, err := d.SchemaVersions()
+	if err != nil {
+		return nil, err
+	}
+	current := 0
+	if len(versions) > 0 {
+		current = versions[len(versions)-1].Version
+	}
+	sess, err := d.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	applied := make([]SchemaVersion, 0)
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		log.Printf("Applying migration %d: %s", m.Version, m.Name)
+		v := SchemaVersion{
+			Version: m.Version,
+			Name:    m.Name,
+			Applied: time.Now(),
+		}
+		err := sess.Tx(func(tx db.Session) error {
+			if err := m.apply(tx, d.dialect); err != nil {
+				return err
+			}
+			_, err := tx.Collection(schemaVersionCollection).Insert(v)
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d '%s' failed: %v", m.Version, m.Name, err)
+		}
+		applied = append(applied, v)
+	}
+	return applied, nil
+}
+
+func createSchemaVersionTable(sess db.Session) error {
+	_, err := sess.SQL().Exec(fmt.Sprintf(`
+        CREATE TABLE IF NOT EXISTS %v (
+            version INTEGER PRIMARY KEY,
+			name TEXT,
+			applied TIMESTAMP
+        )`, schemaVersionCollection))
+	return err
+}
+
+func execAll(sess db.Session, statements ...string) error {
+	for _, s := range statements {
+		if _, err := sess.SQL().Exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDb_Migrate(t *testing.T) {
+	d, err := FromFile(filepath.Join(t.TempDir(), "coinwatch.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := d.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("Expected %d migrations got %d", len(migrations), len(applied))
+	}
+	// Second run is a no-op
+	applied, err = d.Migrate()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Expected no migrations got %v %v", applied, err)
+	}
+	pending, err := d.PendingMigrations()
+	if err != nil || len(pending) != 0 {
+		t.Errorf("Expected no pending migrations got %v %v", pending, err)
+	}
+}
+
+func TestDb_MigrateLegacy(t *testing.T) {
+	d, err := FromFile(filepath.Join(t.TempDir(), "coinwatch.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, err := d.GetSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Schema created before versioning
+	_, err = sess.SQL().Exec(`CREATE TABLE balance (ts TIMESTAMP, wallet TEXT, token TEXT, address TEXT,
+		balance REAL, balance_locked REAL, fiat_value REAL)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sess.SQL().Exec(`INSERT INTO balance VALUES ('2022-05-30 14:15:00+00:00', 'w', 'dot', 'a', 1, 0, 9)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sess.Close()
+	if _, err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.GetBalances(BalanceQueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Entries()) != 1 || b.Entries()[0].StalePrice || b.Entries()[0].SnapshotId == 0 ||
+		b.Entries()[0].FiatValue.String() != "9" {
+		t.Errorf("Unexpected balances after migration %v", b.Entries())
+	}
+}
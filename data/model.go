@@ -3,34 +3,69 @@ package data
 import (
 	"fmt"
 	"github.com/scylladb/go-set"
+	"github.com/shopspring/decimal"
 	"github.com/zooper-corp/CoinWatch/tools"
 	"log"
 	"strings"
 	"time"
 )
 
+// Decimals are encoded as exact JSON numbers by every encoder of the process, API responses, webhooks and JSON
+// Lines exports alike. Decoding accepts both numbers and strings so older exports still import
+func init() {
+	decimal.MarshalJSONWithoutQuotes = true
+}
+
+// Balance of a token on an address, StalePrice is set when valued with a stored price or at zero for lack of any
 type Balance struct {
-	Timestamp     time.Time `db:"ts" json:"timestamp"`
-	Wallet        string    `db:"wallet" json:"wallet"`
-	Token         string    `db:"token" json:"token"`
-	Address       string    `db:"address" json:"address"`
-	Balance       float64   `db:"balance" json:"balance"`
-	BalanceLocked float64   `db:"balance_locked" json:"balance_locked"`
-	FiatValue     float64   `db:"fiat_value" json:"fiat_value"`
+	Timestamp     time.Time       `db:"ts" json:"timestamp"`
+	Wallet        string          `db:"wallet" json:"wallet"`
+	Token         string          `db:"token" json:"token"`
+	Address       string          `db:"address" json:"address"`
+	Balance       decimal.Decimal `db:"balance" json:"balance"`
+	BalanceLocked decimal.Decimal `db:"balance_locked" json:"balance_locked"`
+	FiatValue     decimal.Decimal `db:"fiat_value" json:"fiat_value"`
+	StalePrice    bool            `db:"stale_price" json:"stale_price"`
+	SnapshotId    int64           `db:"snapshot_id" json:"snapshot_id"`
+	// Portfolio of the snapshot, only set by Export
+	Portfolio string `db:"-" json:"portfolio,omitempty"`
+}
+
+// Snapshot groups all balances written by one update
+type Snapshot struct {
+	Id        int64     `db:"id,omitempty" json:"id"`
+	Timestamp time.Time `db:"ts" json:"timestamp"`
+	Status    string    `db:"status" json:"status"`
+	Wallets   int       `db:"wallets" json:"wallets"`
+	Fiat      string    `db:"fiat" json:"fiat"`
+	Portfolio string    `db:"portfolio" json:"portfolio"`
 }
 
+// DefaultPortfolio holds every wallet when no portfolio is configured and owns snapshots written before portfolios
+const DefaultPortfolio = "default"
+
+// Snapshot statuses
+const (
+	SnapshotComplete = "complete"
+	SnapshotPartial  = "partial"
+)
+
 type TokenBalance struct {
 	Wallet  string
 	Symbol  string
 	Address string
-	Balance float64
-	Locked  float64
+	Balance decimal.Decimal
+	Locked  decimal.Decimal
 }
 
 type TokenPrice struct {
-	Token string
-	Price float32
-	Fiat  string
+	Timestamp time.Time       `db:"ts" json:"timestamp"`
+	Token     string          `db:"token" json:"token"`
+	Price     decimal.Decimal `db:"price" json:"price"`
+	Fiat      string          `db:"fiat" json:"fiat"`
+	Stale     bool            `db:"-" json:"-"`
+	// Cached prices were fetched by an earlier call and are already stored
+	Cached bool `db:"-" json:"-"`
 }
 
 type TokenPrices struct {
@@ -41,6 +76,11 @@ type Balances struct {
 	entries []Balance
 }
 
+// NewBalances wraps entries, newest first like the DB returns them
+func NewBalances(entries []Balance) Balances {
+	return Balances{entries: entries}
+}
+
 // ShortAddr returns the address
 func (b Balance) ShortAddr() string {
 	l := len(b.Address)
@@ -55,9 +95,20 @@ func (b Balance) Id() string {
 	return fmt.Sprintf("%v/%v/%v", b.Wallet, b.Token, b.Address)
 }
 
-// PricePerToken returns price per token in fiat value
-func (b Balance) PricePerToken() float64 {
-	return b.FiatValue / b.Balance
+// PricePerToken returns price per token in fiat value, zero for an empty balance
+func (b Balance) PricePerToken() decimal.Decimal {
+	if b.Balance.IsZero() {
+		return decimal.Zero
+	}
+	return b.FiatValue.Div(b.Balance)
+}
+
+// sameSnapshot is true if both balances were written by the same update
+func (b Balance) sameSnapshot(x Balance) bool {
+	if b.SnapshotId != 0 || x.SnapshotId != 0 {
+		return b.SnapshotId == x.SnapshotId
+	}
+	return b.Timestamp.UnixMilli() == x.Timestamp.UnixMilli()
 }
 
 // Add creates a new balance with a sum of the two
@@ -67,31 +118,18 @@ func (b Balance) Add(x Balance) Balance {
 		Wallet:        "Grouped",
 		Token:         b.Token,
 		Address:       "Grouped",
-		Balance:       b.Balance + x.Balance,
-		BalanceLocked: b.BalanceLocked + x.BalanceLocked,
-		FiatValue:     b.FiatValue + x.FiatValue,
-	}
-}
-
-// GetTimeSeries will return a set of balances over a given amount of intervals
-func (b Balances) GetTimeSeries(amount int, interval time.Duration) []Balances {
-	r := make([]Balances, 0)
-	duration := time.Duration(0)
-	for i := 1; i < amount; i++ {
-		r = append(r, b.ClosestSample(duration))
-		duration = duration + interval
+		Balance:       b.Balance.Add(x.Balance),
+		BalanceLocked: b.BalanceLocked.Add(x.BalanceLocked),
+		FiatValue:     b.FiatValue.Add(x.FiatValue),
+		StalePrice:    b.StalePrice || x.StalePrice,
+		SnapshotId:    b.SnapshotId,
 	}
-	return r
 }
 
-// TotalFiatValueChange will return total fiat value change in pct (-1.0 to 1.0) between now and x days ago
-func (b Balances) TotalFiatValueChange(days int) float64 {
-	startTotal := b.LastSample().TotalFiatValue()
-	endTotal := b.ClosestSample(time.Hour * time.Duration(24*days)).TotalFiatValue()
-	if startTotal == endTotal {
-		return 0
-	}
-	return (1.0 / endTotal * startTotal) - 1
+// TotalFiatValueChange will return the time weighted return in pct (-1.0 to 1.0) between now and x days ago,
+// flows in or out of the portfolio are not counted as a change
+func (b Balances) TotalFiatValueChange(days int, flows []Flow) float64 {
+	return b.Performance(days, flows).TimeWeighted
 }
 
 // FiatValueChange will return fiat value change in pct (-1.0 to 1.0) between now and x days ago for token
@@ -105,7 +143,7 @@ func (b Balances) FiatValueChange(token string, days int) float64 {
 	}
 	startValue := tuple[0].FiatValue
 	endValue := tuple[len(tuple)-1].FiatValue
-	return (1.0 / endValue * startValue) - 1
+	return changePct(startValue, endValue)
 }
 
 // PricePerTokenChange will return token price value change in pct (-1.0 to 1.0) between now and x days ago for token
@@ -119,7 +157,7 @@ func (b Balances) PricePerTokenChange(token string, days int) float64 {
 	}
 	startPrice := tuple[0].PricePerToken()
 	endPrice := tuple[len(tuple)-1].PricePerToken()
-	return (1.0 / endPrice * startPrice) - 1
+	return changePct(startPrice, endPrice)
 }
 
 // BalanceChange will return change for balance with given id in pct (-1.0 to 1.0) between now and x days ago
@@ -133,7 +171,15 @@ func (b Balances) BalanceChange(id string, days int) float64 {
 	}
 	startBalance := tuple[0].Balance
 	endBalance := tuple[len(tuple)-1].Balance
-	return (1.0 / endBalance * startBalance) - 1
+	return changePct(startBalance, endBalance)
+}
+
+// changePct returns the change from end to start in pct (-1.0 to 1.0), 0 if end is zero
+func changePct(start decimal.Decimal, end decimal.Decimal) float64 {
+	if end.IsZero() {
+		return 0
+	}
+	return start.Div(end).Sub(decimal.NewFromInt(1)).InexactFloat64()
 }
 
 // FilterId will return entries filtered by id
@@ -192,6 +238,17 @@ func (b Balances) Tokens() []string {
 	return r.List()
 }
 
+// SeriesTokens will return all tokens found in a time series
+func SeriesTokens(series []Balances) []string {
+	r := set.NewStringSet()
+	for _, b := range series {
+		for _, bs := range b.entries {
+			r.Add(strings.ToUpper(bs.Token))
+		}
+	}
+	return r.List()
+}
+
 // Wallets will return all tokens in this series
 func (b Balances) Wallets() []string {
 	if len(b.entries) == 0 {
@@ -234,20 +291,20 @@ func (b Balances) ClosestSample(duration time.Duration) Balances {
 	}
 	targetTs := time.Now().Add(-duration)
 	bestDelta := tools.AbsDuration(targetTs.Sub(b.entries[0].Timestamp))
-	bestTs := b.entries[0].Timestamp
+	best := b.entries[0]
 	// Find closest TS first
 	for _, be := range b.entries {
 		beDelta := tools.AbsDuration(targetTs.Sub(be.Timestamp))
 		// We are closer, update bestDelta
 		if beDelta < bestDelta {
 			bestDelta = beDelta
-			bestTs = be.Timestamp
+			best = be
 		}
 	}
-	// Append series
+	// Append series, rows written before snapshots existed are matched by timestamp
 	r := make([]Balance, 0)
 	for _, be := range b.entries {
-		if be.Timestamp.UnixMilli() == bestTs.UnixMilli() {
+		if be.sameSnapshot(best) {
 			r = append(r, be)
 		}
 	}
@@ -261,18 +318,18 @@ func (b Balances) GroupBySymbol() Balances {
 		return Balances{}
 	}
 	r := make([]Balance, 0)
-	ts := time.UnixMilli(0)
+	current := b.entries[0]
 	br := make(map[string]Balance, 0)
 	for _, bs := range b.entries {
-		// TS Changed
-		if bs.Timestamp.UnixMilli() != ts.UnixMilli() {
+		// Snapshot changed
+		if !bs.sameSnapshot(current) {
 			if len(br) > 0 {
 				for _, v := range br {
 					r = append(r, v)
 				}
 			}
 			br = make(map[string]Balance, 0)
-			ts = bs.Timestamp
+			current = bs
 		}
 		// Map
 		token := strings.ToUpper(bs.Token)
@@ -292,6 +349,42 @@ func (b Balances) GroupBySymbol() Balances {
 	return Balances{entries: r}
 }
 
+// GroupByKeys sums values of every snapshot by the keys of each balance, a balance with several keys is counted
+// in each of them. Grouped balances use the key as token so token functions work on groups
+func (b Balances) GroupByKeys(keys func(Balance) []string) Balances {
+	if len(b.entries) == 0 {
+		return Balances{}
+	}
+	r := make([]Balance, 0)
+	start := 0
+	for i := 1; i <= len(b.entries); i++ {
+		if i < len(b.entries) && b.entries[i].sameSnapshot(b.entries[start]) {
+			continue
+		}
+		groups := make(map[string]Balance)
+		order := make([]string, 0)
+		for _, bs := range b.entries[start:i] {
+			for _, key := range keys(bs) {
+				g, ok := groups[key]
+				if !ok {
+					g = Balance{Timestamp: bs.Timestamp, Wallet: "Grouped", Token: key, Address: "Grouped", SnapshotId: bs.SnapshotId}
+					order = append(order, key)
+				}
+				g.Balance = g.Balance.Add(bs.Balance)
+				g.BalanceLocked = g.BalanceLocked.Add(bs.BalanceLocked)
+				g.FiatValue = g.FiatValue.Add(bs.FiatValue)
+				g.StalePrice = g.StalePrice || bs.StalePrice
+				groups[key] = g
+			}
+		}
+		for _, key := range order {
+			r = append(r, groups[key])
+		}
+		start = i
+	}
+	return Balances{entries: r}
+}
+
 func (b Balances) FilterByWallet(name string) Balances {
 	r := make([]Balance, 0)
 	for _, balance := range b.entries {
@@ -307,36 +400,44 @@ func (b Balances) Entries() []Balance {
 	return a
 }
 
-func (b Balances) TotalFiatValue() float64 {
-	total := 0.0
+func (b Balances) TotalFiatValue() decimal.Decimal {
+	total := decimal.Zero
 	seen := set.NewStringSet()
 	for _, be := range b.entries {
 		key := be.Id()
 		if !seen.Has(key) {
 			seen.Add(key)
-			total += be.FiatValue
+			total = total.Add(be.FiatValue)
 		}
 	}
 	return total
 }
 
-func (b Balances) TokenBalance(token string) float64 {
-	total := 0.0
+func (b Balances) TokenBalance(token string) decimal.Decimal {
+	total := decimal.Zero
 	for _, balance := range b.entries {
 		if strings.EqualFold(balance.Token, token) {
-			total += balance.Balance
+			total = total.Add(balance.Balance)
 		}
 	}
 	return total
 }
 
 // GetPrice returns price for a given token or 0 if not found
-func (tp *TokenPrices) GetPrice(token string) float64 {
+func (tp *TokenPrices) GetPrice(token string) decimal.Decimal {
+	if p, ok := tp.Get(token); ok {
+		return p.Price
+	}
+	log.Printf("Price not found %s", token)
+	return decimal.Zero
+}
+
+// Get returns the price entry for a given token
+func (tp *TokenPrices) Get(token string) (TokenPrice, bool) {
 	for _, p := range tp.Entries {
 		if strings.EqualFold(p.Token, token) {
-			return float64(p.Price)
+			return p, true
 		}
 	}
-	log.Printf("Price not found %s", token)
-	return 0
+	return TokenPrice{}, false
 }
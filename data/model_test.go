@@ -0,0 +1,52 @@
+package data
+
+import (
+	"encoding/json"
+	"github.com/shopspring/decimal"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBalances_GroupByKeys(t *testing.T) {
+	now := time.Now()
+	entries := make([]Balance, 0)
+	for i, ts := range []time.Time{now, now.Add(-time.Hour * 24)} {
+		id := int64(2 - i)
+		entries = append(entries,
+			Balance{Timestamp: ts, Wallet: "kraken", Token: "BTC", FiatValue: decimal.NewFromInt(100 * id), SnapshotId: id},
+			Balance{Timestamp: ts, Wallet: "kraken", Token: "DOT", FiatValue: decimal.NewFromInt(50), SnapshotId: id},
+			Balance{Timestamp: ts, Wallet: "ledger", Token: "BTC", FiatValue: decimal.NewFromInt(200), SnapshotId: id},
+		)
+	}
+	tags := map[string][]string{"kraken": {"exchange"}, "ledger": {"cold", "hardware"}}
+	grouped := NewBalances(entries).GroupByKeys(func(b Balance) []string {
+		return tags[b.Wallet]
+	})
+	last := grouped.LastSample()
+	if len(last.Entries()) != 3 || len(grouped.Entries()) != 6 {
+		t.Fatalf("Expected 3 groups per snapshot got %v", grouped.Entries())
+	}
+	if v := last.FilterToken("exchange").TotalFiatValue(); !v.Equal(decimal.NewFromInt(250)) {
+		t.Errorf("Expected 250 on exchange got %v", v)
+	}
+	if v := last.FilterToken("hardware").TotalFiatValue(); !v.Equal(decimal.NewFromInt(200)) {
+		t.Errorf("Expected 200 on hardware got %v", v)
+	}
+	// 150 a day ago
+	if c := grouped.FiatValueChange("exchange", 1); c < 0.66 || c > 0.67 {
+		t.Errorf("Expected exchange change of 66%% got %v", c)
+	}
+}
+
+func TestBalance_JSON(t *testing.T) {
+	b := Balance{Balance: decimal.RequireFromString("0.123456789012345678")}
+	out, err := json.Marshal(b)
+	if err != nil || !strings.Contains(string(out), `"balance":0.123456789012345678,`) {
+		t.Fatalf("Expected an exact JSON number got %s %v", out, err)
+	}
+	var quoted Balance
+	if err := json.Unmarshal([]byte(`{"balance":"0.5"}`), &quoted); err != nil || quoted.Balance.String() != "0.5" {
+		t.Errorf("Expected quoted decimals to decode got %v %v", quoted.Balance, err)
+	}
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"fmt"
+	"github.com/shopspring/decimal"
+	"math"
+	"sort"
+	"time"
+)
+
+// Flow is fiat value moved into (positive) or out of (negative) the portfolio, it is not performance
+type Flow struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Value     decimal.Decimal `json:"value"`
+}
+
+// Performance of the portfolio over a period, returns are for the whole period and not annualized
+type Performance struct {
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"`
+	Start         decimal.Decimal `json:"start"`
+	End           decimal.Decimal `json:"end"`
+	NetFlows      decimal.Decimal `json:"net_flows"`
+	TimeWeighted  float64         `json:"time_weighted"`
+	MoneyWeighted float64         `json:"money_weighted"`
+}
+
+// Gain is the value change not explained by flows
+func (p Performance) Gain() decimal.Decimal {
+	return p.End.Sub(p.Start).Sub(p.NetFlows)
+}
+
+// snapshotTotal is the total value of one snapshot
+type snapshotTotal struct {
+	Timestamp time.Time
+	Value     decimal.Decimal
+}
+
+// snapshotTotals returns totals of every snapshot, oldest first
+func (b Balances) snapshotTotals() []snapshotTotal {
+	r := make([]snapshotTotal, 0)
+	start := 0
+	for i := 1; i <= len(b.entries); i++ {
+		if i == len(b.entries) || !b.entries[i].sameSnapshot(b.entries[start]) {
+			r = append(r, snapshotTotal{
+				Timestamp: b.entries[start].Timestamp,
+				Value:     Balances{entries: b.entries[start:i]}.TotalFiatValue(),
+			})
+			start = i
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Timestamp.Before(r[j].Timestamp)
+	})
+	return r
+}
+
+// Performance returns time and money weighted returns between now and x days ago, flows outside the period are
+// ignored
+func (b Balances) Performance(days int, flows []Flow) Performance {
+	totals := b.snapshotTotals()
+	if len(totals) == 0 {
+		return Performance{}
+	}
+	from := b.ClosestSample(time.Hour * time.Duration(24*days)).entries[0].Timestamp
+	window := make([]snapshotTotal, 0)
+	for _, s := range totals {
+		if !s.Timestamp.Before(from) {
+			window = append(window, s)
+		}
+	}
+	first, last := window[0], window[len(window)-1]
+	p := Performance{From: first.Timestamp, To: last.Timestamp, Start: first.Value, End: last.Value}
+	inPeriod := make([]Flow, 0)
+	for _, f := range flows {
+		if f.Timestamp.After(first.Timestamp) && !f.Timestamp.After(last.Timestamp) {
+			inPeriod = append(inPeriod, f)
+			p.NetFlows = p.NetFlows.Add(f.Value)
+		}
+	}
+	p.TimeWeighted = timeWeightedReturn(window, inPeriod)
+	if r, err := moneyWeightedReturn(first, last, inPeriod); err == nil {
+		p.MoneyWeighted = r
+	}
+	return p
+}
+
+// timeWeightedReturn chains returns of every interval between snapshots, empty snapshots are skipped and an
+// interval spans from the last non empty one
+func timeWeightedReturn(totals []snapshotTotal, flows []Flow) float64 {
+	r := 1.0
+	prev := snapshotTotal{}
+	for _, cur := range totals {
+		if !cur.Value.IsPositive() {
+			continue
+		}
+		if prev.Value.IsZero() {
+			prev = cur
+			continue
+		}
+		if ir, ok := IntervalReturn(prev.Timestamp, prev.Value.InexactFloat64(), cur.Timestamp, cur.Value.InexactFloat64(), flows); ok {
+			r *= 1 + ir
+		}
+		prev = cur
+	}
+	return r - 1
+}
+
+// IntervalReturn is the gain between two values over the start value plus flows in between, weighted by the part
+// of the interval they were invested (modified Dietz). Flows outside the interval are ignored, ok is false if
+// nothing was invested
+func IntervalReturn(from time.Time, start float64, to time.Time, end float64, flows []Flow) (float64, bool) {
+	interval := to.Sub(from).Seconds()
+	gain := end - start
+	invested := start
+	for _, f := range flows {
+		if f.Timestamp.After(from) && !f.Timestamp.After(to) {
+			gain -= f.Value.InexactFloat64()
+			invested += f.Value.InexactFloat64() * to.Sub(f.Timestamp).Seconds() / interval
+		}
+	}
+	if invested <= 0 {
+		return 0, false
+	}
+	return gain / invested, true
+}
+
+// moneyWeightedReturn finds the period rate r for which the start value and flows grown at r until the end
+// match the end value, each flow grows for the fraction of the period it was invested
+func moneyWeightedReturn(first snapshotTotal, last snapshotTotal, flows []Flow) (float64, error) {
+	period := last.Timestamp.Sub(first.Timestamp).Seconds()
+	start := first.Value.InexactFloat64()
+	end := last.Value.InexactFloat64()
+	if period <= 0 {
+		return 0, fmt.Errorf("period is empty")
+	}
+	// Value at the end minus actual end value for a rate
+	excess := func(rate float64) float64 {
+		v := start * (1 + rate)
+		for _, f := range flows {
+			weight := last.Timestamp.Sub(f.Timestamp).Seconds() / period
+			v += f.Value.InexactFloat64() * math.Pow(1+rate, weight)
+		}
+		return v - end
+	}
+	lo, hi := -0.999999, 1.0
+	for excess(hi) < 0 && hi < 1e6 {
+		hi *= 10
+	}
+	if excess(lo) > 0 || excess(hi) < 0 {
+		return 0, fmt.Errorf("no money weighted return for start %v, end %v and %d flows", start, end, len(flows))
+	}
+	for i := 0; i < 200 && hi-lo > 1e-10; i++ {
+		mid := (lo + hi) / 2
+		if excess(mid) < 0 {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2, nil
+}
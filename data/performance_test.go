@@ -0,0 +1,66 @@
+package data
+
+import (
+	"github.com/shopspring/decimal"
+	"math"
+	"testing"
+	"time"
+)
+
+func testPerformanceBalances(values ...int64) Balances {
+	now := time.Now()
+	r := make([]Balance, 0)
+	// Newest first like the DB returns them, one day apart
+	for i := len(values) - 1; i >= 0; i-- {
+		ts := now.Add(-time.Hour * 24 * time.Duration(len(values)-1-i))
+		r = append(r,
+			Balance{Timestamp: ts, Wallet: "a", Token: "BTC", FiatValue: decimal.NewFromInt(values[i] / 2), SnapshotId: int64(i + 1)},
+			Balance{Timestamp: ts, Wallet: "b", Token: "DOT", FiatValue: decimal.NewFromInt(values[i] - values[i]/2), SnapshotId: int64(i + 1)},
+		)
+	}
+	return Balances{entries: r}
+}
+
+func TestBalances_Performance(t *testing.T) {
+	// 1000 gains 10%, then 1000 is deposited halfway through the second day
+	bs := testPerformanceBalances(1000, 1100, 2310)
+	deposit := Flow{Timestamp: time.Now().Add(-time.Hour * 12), Value: decimal.NewFromInt(1000)}
+	naive := bs.TotalFiatValueChange(2, nil)
+	if math.Abs(naive-1.31) > 1e-9 {
+		t.Errorf("Expected change without flows to be 131%% got %v", naive)
+	}
+	p := bs.Performance(2, []Flow{deposit})
+	if !p.Start.Equal(decimal.NewFromInt(1000)) || !p.End.Equal(decimal.NewFromInt(2310)) {
+		t.Errorf("Unexpected start %v and end %v", p.Start, p.End)
+	}
+	if !p.NetFlows.Equal(decimal.NewFromInt(1000)) || !p.Gain().Equal(decimal.NewFromInt(310)) {
+		t.Errorf("Unexpected flows %v and gain %v", p.NetFlows, p.Gain())
+	}
+	// Second day gained 210 on 1100 plus half the deposit
+	if math.Abs(p.TimeWeighted-(1.1*(1+210.0/1600)-1)) > 1e-6 {
+		t.Errorf("Expected time weighted return of 24.4%% got %v", p.TimeWeighted)
+	}
+	// The deposit was invested for a quarter of the period: 1000 * (1+r) + 1000 * (1+r)^0.25 = 2310
+	mwr := 1000*(1+p.MoneyWeighted) + 1000*math.Pow(1+p.MoneyWeighted, 0.25)
+	if math.Abs(mwr-2310) > 1e-4 || p.MoneyWeighted < 0.2 || p.MoneyWeighted > 0.3 {
+		t.Errorf("Unexpected money weighted return %v", p.MoneyWeighted)
+	}
+	// Flows older than the period do not count
+	old := Flow{Timestamp: time.Now().Add(-time.Hour * 36), Value: decimal.NewFromInt(1000)}
+	if r := bs.TotalFiatValueChange(1, []Flow{old}); math.Abs(r-1.1) > 1e-9 {
+		t.Errorf("Expected last day return of 110%% got %v", r)
+	}
+}
+
+func TestBalances_PerformanceWithdrawal(t *testing.T) {
+	// Half is withdrawn and the value does not move
+	bs := testPerformanceBalances(1000, 500)
+	withdrawal := Flow{Timestamp: time.Now().Add(-time.Hour), Value: decimal.NewFromInt(-500)}
+	p := bs.Performance(1, []Flow{withdrawal})
+	if math.Abs(p.TimeWeighted) > 1e-9 || math.Abs(p.MoneyWeighted) > 1e-6 {
+		t.Errorf("Expected no performance got %v and %v", p.TimeWeighted, p.MoneyWeighted)
+	}
+	if (Balances{}).Performance(7, nil).TimeWeighted != 0 {
+		t.Errorf("Expected no performance without balances")
+	}
+}
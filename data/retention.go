@@ -0,0 +1,163 @@
+package data
+
+import (
+	"fmt"
+	"github.com/upper/db/v4"
+	"log"
+	"sort"
+	"time"
+)
+
+const compactBatchSize = 500
+
+// RetentionTier thins snapshots older than Age down to one every Interval
+type RetentionTier struct {
+	Age      time.Duration
+	Interval time.Duration
+}
+
+// CompactResult counts what a compaction removed or would remove
+type CompactResult struct {
+	Snapshots int
+	Balances  int
+	Kept      int
+}
+
+// Compact downsamples snapshots according to tiers, each snapshot falls in the tier with the largest Age
+// it exceeds and only one snapshot per Interval and portfolio is kept, complete snapshots are preferred then
+// the most recent. Buckets are aligned to the epoch so running it again removes nothing new
+func (d *Db) Compact(tiers []RetentionTier, dryRun bool) (CompactResult, error) {
+	return d.compact(tiers, dryRun, time.Now())
+}
+
+// compact is Compact with ages measured from now
+func (d *Db) compact(tiers []RetentionTier, dryRun bool, now time.Time) (CompactResult, error) {
+	if len(tiers) == 0 {
+		return CompactResult{}, nil
+	}
+	tiers = sortTiers(tiers)
+	sess, err := d.GetSession()
+	if err != nil {
+		return CompactResult{}, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	// Only snapshots covered by a tier
+	var snapshots []Snapshot
+	err = sess.SQL().
+		SelectFrom(snapshotCollection).
+		Where("ts < ?", now.Add(-tiers[0].Age).Local()).
+		OrderBy("ts DESC").
+		All(&snapshots)
+	if err != nil {
+		return CompactResult{}, err
+	}
+	drop := compactSnapshots(snapshots, tiers, now)
+	result := CompactResult{
+		Snapshots: len(drop),
+		Kept:      len(snapshots) - len(drop),
+	}
+	if len(drop) == 0 {
+		return result, nil
+	}
+	// Count balances
+	for _, batch := range batchIds(drop) {
+		n, err := sess.Collection(balanceCollection).Find(db.Cond{"snapshot_id IN": batch}).Count()
+		if err != nil {
+			return result, err
+		}
+		result.Balances += int(n)
+	}
+	if dryRun {
+		return result, nil
+	}
+	// Delete in batches, one transaction each so a long compaction does not block updates
+	for _, batch := range batchIds(drop) {
+		err := sess.Tx(func(tx db.Session) error {
+			if err := tx.Collection(balanceCollection).Find(db.Cond{"snapshot_id IN": batch}).Delete(); err != nil {
+				return err
+			}
+			return tx.Collection(snapshotCollection).Find(db.Cond{"id IN": batch}).Delete()
+		})
+		if err != nil {
+			return result, fmt.Errorf("unable to delete snapshots: %v", err)
+		}
+	}
+	log.Printf("Compacted %d snapshots and %d balances, kept %d", result.Snapshots, result.Balances, result.Kept)
+	return result, nil
+}
+
+// Vacuum gives space freed by deleted rows back to the OS
+func (d *Db) Vacuum() error {
+	sess, err := d.GetSession()
+	if err != nil {
+		return err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	_, err = sess.SQL().Exec("VACUUM")
+	return err
+}
+
+// compactSnapshots returns the ids of snapshots to drop, snapshots must be sorted most recent first
+func compactSnapshots(snapshots []Snapshot, tiers []RetentionTier, now time.Time) []int64 {
+	type bucket struct {
+		portfolio string
+		tier      int
+		index     int64
+	}
+	kept := make(map[bucket]Snapshot)
+	drop := make([]int64, 0)
+	for _, s := range snapshots {
+		tier := -1
+		for i, t := range tiers {
+			if now.Sub(s.Timestamp) >= t.Age {
+				tier = i
+			}
+		}
+		if tier < 0 {
+			continue
+		}
+		interval := int64(tiers[tier].Interval.Seconds())
+		if interval < 1 {
+			continue
+		}
+		key := bucket{s.Portfolio, tier, s.Timestamp.Unix() / interval}
+		k, ok := kept[key]
+		if !ok {
+			kept[key] = s
+			continue
+		}
+		// Swap a partial snapshot for a complete one
+		if k.Status != SnapshotComplete && s.Status == SnapshotComplete {
+			kept[key] = s
+			drop = append(drop, k.Id)
+		} else {
+			drop = append(drop, s.Id)
+		}
+	}
+	return drop
+}
+
+func sortTiers(tiers []RetentionTier) []RetentionTier {
+	r := make([]RetentionTier, len(tiers))
+	copy(r, tiers)
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Age < r[j].Age
+	})
+	return r
+}
+
+func batchIds(ids []int64) [][]int64 {
+	r := make([][]int64, 0)
+	for start := 0; start < len(ids); start += compactBatchSize {
+		end := start + compactBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		r = append(r, ids[start:end])
+	}
+	return r
+}
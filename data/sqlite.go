@@ -0,0 +1,235 @@
+//go:build !nosqlite
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"github.com/upper/db/v4"
+	"github.com/upper/db/v4/adapter/sqlite"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	sqliteBackupPages = 256
+	sqliteBackupPause = time.Millisecond * 10
+)
+
+// sqliteDialect stores decimals as text, any numeric affinity would round them to a double. SUM of text returns a
+// double as well so sums are done in Go
+var sqliteDialect = dialect{
+	name:      "sqlite",
+	real:      "REAL",
+	decimal:   "TEXT",
+	boolean:   "INTEGER NOT NULL DEFAULT 0",
+	serial:    "INTEGER PRIMARY KEY AUTOINCREMENT",
+	timestamp: "TIMESTAMP",
+	sqlSum:    false,
+	epoch: func(column string) string {
+		return fmt.Sprintf("CAST(strftime('%%s', %v) AS INTEGER)", column)
+	},
+	number: func(column string) string {
+		return fmt.Sprintf("CAST(%v AS REAL)", column)
+	},
+	anyTrue: func(column string) string {
+		return fmt.Sprintf("MAX(%v)", column)
+	},
+	addColumn: func(sess db.Session, table string, column string, definition string) error {
+		columns, err := sqliteColumns(sess, table)
+		if err != nil {
+			return err
+		}
+		for _, c := range columns {
+			if c.name == column {
+				return nil
+			}
+		}
+		return execAll(sess, fmt.Sprintf("ALTER TABLE %v ADD COLUMN %v %v", table, column, definition))
+	},
+	alterDecimal: func(sess db.Session, table string, columns []string) error {
+		// SQLite can't change column types, the table is rebuilt with the same columns and indexes
+		existing, err := sqliteColumns(sess, table)
+		if err != nil {
+			return err
+		}
+		var indexes []string
+		rows, err := sess.SQL().Query("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var q string
+			if err := rows.Scan(&q); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			indexes = append(indexes, q)
+		}
+		_ = rows.Close()
+		definitions := make([]string, 0)
+		names := make([]string, 0)
+		values := make([]string, 0)
+		for _, c := range existing {
+			names = append(names, c.name)
+			if tools.StringInSlice(c.name, columns) {
+				definitions = append(definitions, fmt.Sprintf("%v TEXT NOT NULL DEFAULT '0'", c.name))
+				values = append(values, fmt.Sprintf("CAST(COALESCE(%v, 0) AS TEXT)", c.name))
+				continue
+			}
+			definition := fmt.Sprintf("%v %v", c.name, c.ctype)
+			if c.notNull {
+				definition += " NOT NULL"
+			}
+			if c.defaultValue != nil {
+				definition += fmt.Sprintf(" DEFAULT %v", c.defaultValue)
+			}
+			definitions = append(definitions, definition)
+			values = append(values, c.name)
+		}
+		statements := []string{
+			fmt.Sprintf("CREATE TABLE %v_new (%v)", table, strings.Join(definitions, ", ")),
+			fmt.Sprintf("INSERT INTO %v_new (%v) SELECT %v FROM %v", table, strings.Join(names, ", "), strings.Join(values, ", "), table),
+			fmt.Sprintf("DROP TABLE %v", table),
+			fmt.Sprintf("ALTER TABLE %[1]v_new RENAME TO %[1]v", table),
+		}
+		return execAll(sess, append(statements, indexes...)...)
+	},
+	backup: sqliteBackup,
+	check:  sqliteCheck,
+}
+
+type sqliteColumn struct {
+	name         string
+	ctype        string
+	notNull      bool
+	defaultValue interface{}
+}
+
+func sqliteColumns(sess db.Session, table string) ([]sqliteColumn, error) {
+	rows, err := sess.SQL().Query(fmt.Sprintf("PRAGMA table_info(%v)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	r := make([]sqliteColumn, 0)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var c sqliteColumn
+		if err := rows.Scan(&cid, &c.name, &c.ctype, &notNull, &c.defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		c.notNull = notNull != 0
+		r = append(r, c)
+	}
+	return r, rows.Err()
+}
+
+// FromFile returns a SQLite backed store
+func FromFile(path string) (Db, error) {
+	var settings = sqlite.ConnectionURL{
+		Database: tools.ExpandPath(path),
+	}
+	d := Db{
+		dialect: sqliteDialect,
+		open: func() (db.Session, error) {
+			return sqlite.Open(settings)
+		},
+		path: settings.Database,
+	}
+	exists, err := tools.PathExists(settings.Database)
+	if exists {
+		sess, err := sqlite.Open(settings)
+		if err != nil {
+			// Still return the store so a backup can be restored over it
+			return d, fmt.Errorf("unable to open DB '%v' it might be corrupted, see 'coinwatch db restore': %v", settings.Database, err)
+		}
+		_ = sess.Close()
+	}
+	return d, err
+}
+
+// sqliteBackup copies src to dst with the online backup API, writers on src only wait for a single step
+func sqliteBackup(src string, dst string) error {
+	srcDb, err := sql.Open("sqlite3", src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = srcDb.Close()
+	}()
+	dstDb, err := sql.Open("sqlite3", dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dstDb.Close()
+	}()
+	ctx := context.Background()
+	srcConn, err := srcDb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = srcConn.Close()
+	}()
+	dstConn, err := dstDb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = dstConn.Close()
+	}()
+	return dstConn.Raw(func(dstDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			to, ok := dstDriver.(*sqlite3.SQLiteConn)
+			from, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("unexpected SQLite driver connection")
+			}
+			b, err := to.Backup("main", from, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := b.Step(sqliteBackupPages)
+				if err != nil {
+					_ = b.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+				// Let writers in, the backup restarts by itself if they change copied pages
+				time.Sleep(sqliteBackupPause)
+			}
+			log.Printf("Copied %d pages from %v to %v", b.PageCount(), src, dst)
+			return b.Finish()
+		})
+	})
+}
+
+// sqliteCheck fails if path is not a readable SQLite DB
+func sqliteCheck(path string) error {
+	conn, err := sql.Open("sqlite3", fmt.Sprintf("file:%v?mode=ro", path))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	var result string
+	if err := conn.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %v", result)
+	}
+	return nil
+}
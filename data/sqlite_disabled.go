@@ -0,0 +1,10 @@
+//go:build nosqlite
+
+package data
+
+import "fmt"
+
+// FromFile is not available in builds without CGO SQLite support
+func FromFile(path string) (Db, error) {
+	return Db{}, fmt.Errorf("SQLite support not compiled in, use a postgres:// DSN instead of '%v'", path)
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"github.com/upper/db/v4"
+	"strings"
+	"time"
+)
+
+// Store is the storage backend holding balances, prices and metadata caches
+type Store interface {
+	// GetSession opens a session for metadata caches, callers must close it
+	GetSession() (db.Session, error)
+	InsertSnapshot(snapshot Snapshot, balances []Balance) (Snapshot, error)
+	GetSnapshots(from time.Time) ([]Snapshot, error)
+	GetTimeSeries(options TimeSeriesOptions) ([]Balances, error)
+	GetBalances(options BalanceQueryOptions) (Balances, error)
+	GetBalancesFromDate(from time.Time, portfolio string) (Balances, error)
+	InsertPrices(prices TokenPrices) error
+	GetLastPrice(token string, fiat string, maxAge time.Duration) (TokenPrice, bool, error)
+	GetPriceAt(token string, fiat string, at time.Time, maxAge time.Duration) (TokenPrice, bool, error)
+	GetTransactionCursors(wallet string) (TransactionCursors, error)
+	InsertTransactions(wallet string, transactions []Transaction, cursors TransactionCursors) (int, error)
+	GetTransactions(options TransactionQueryOptions) ([]Transaction, error)
+	InsertEvents(events []Event) error
+	GetEvents(options EventQueryOptions) ([]Event, error)
+	InsertHeldTokens(portfolio string, ts time.Time, balances []Balance) error
+	GetHeldTokens(portfolio string) ([]HeldToken, error)
+	Export(from time.Time, to time.Time) (Dump, error)
+	Import(dump Dump) (ImportResult, error)
+	Compact(tiers []RetentionTier, dryRun bool) (CompactResult, error)
+	Vacuum() error
+	Backup(path string) error
+	Restore(path string) error
+	Migrate() ([]SchemaVersion, error)
+	SchemaVersions() ([]SchemaVersion, error)
+	PendingMigrations() ([]string, error)
+}
+
+// dialect holds SQL differences between backends
+type dialect struct {
+	name      string
+	real      string
+	decimal   string
+	boolean   string
+	timestamp string
+	serial    string
+	// sqlSum is true when SUM of decimal columns is exact
+	sqlSum       bool
+	epoch        func(column string) string
+	number       func(column string) string
+	anyTrue      func(column string) string
+	addColumn    func(sess db.Session, table string, column string, definition string) error
+	alterDecimal func(sess db.Session, table string, columns []string) error
+	hypertable   func(sess db.Session, table string) error
+	backup       func(src string, dst string) error
+	check        func(path string) error
+}
+
+// Open returns a PostgreSQL store for postgres:// DSNs and a SQLite one for anything else
+func Open(dsn string) (Store, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		d, err := FromPostgres(dsn)
+		return &d, err
+	}
+	d, err := FromFile(dsn)
+	return &d, err
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"fmt"
+	"github.com/upper/db/v4"
+	"log"
+	"strings"
+	"time"
+)
+
+// Time series grouping, tag, chain and provider come from the config and only group loaded balances
+const (
+	GroupByNone     = ""
+	GroupByToken    = "token"
+	GroupByWallet   = "wallet"
+	GroupByTag      = "tag"
+	GroupByChain    = "chain"
+	GroupByProvider = "provider"
+)
+
+// TimeSeriesOptions selects Amount buckets of Interval going back from now, bucket 0 being the most recent,
+// snapshots of every portfolio are picked when Portfolio is empty
+type TimeSeriesOptions struct {
+	Amount    int
+	Interval  time.Duration
+	GroupBy   string
+	Portfolio string
+}
+
+type bucketBalance struct {
+	Bucket  int `db:"bucket"`
+	Balance `db:",inline"`
+}
+
+// GetTimeSeries picks the snapshot closest to each bucket and returns its balances aggregated in SQL,
+// buckets without a snapshot are filled with the closest non empty one
+func (d *Db) GetTimeSeries(options TimeSeriesOptions) ([]Balances, error) {
+	if options.Amount <= 0 {
+		return []Balances{}, nil
+	}
+	interval := int64(options.Interval.Seconds())
+	if interval < 1 {
+		interval = 1
+	}
+	now := time.Now()
+	from := now.Add(-time.Duration(interval*int64(options.Amount-1)+interval/2) * time.Second)
+	sess, err := d.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	// Closest snapshot for each bucket
+	where := "ts >= ?"
+	args := []interface{}{interval, interval / 2, interval, now.Unix(), from.Local()}
+	if options.Portfolio != "" {
+		where += " AND portfolio = ?"
+		args = append(args, options.Portfolio)
+	}
+	args = append(args, options.Amount)
+	picks := fmt.Sprintf(`
+        SELECT id, bucket FROM (
+            SELECT id, bucket, ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY ABS(age - bucket * ?)) AS rn FROM (
+                SELECT id, age, (age + ?) / ? AS bucket FROM (
+                    SELECT id, ? - %v AS age FROM %v WHERE %v
+                ) a
+            ) b
+        ) c WHERE rn = 1 AND bucket < ?`, d.dialect.epoch("ts"), snapshotCollection, where)
+	groupBy := options.GroupBy
+	if !d.dialect.sqlSum {
+		groupBy = GroupByNone
+	}
+	var q string
+	switch groupBy {
+	case GroupByToken:
+		q = fmt.Sprintf(`
+        SELECT p.bucket, b.snapshot_id, b.ts, 'Grouped' AS wallet, UPPER(b.token) AS token,
+            'Grouped' AS address, SUM(b.balance) AS balance, SUM(b.balance_locked) AS balance_locked,
+            SUM(b.fiat_value) AS fiat_value, %v AS stale_price
+        FROM %v b JOIN (%v) p ON b.snapshot_id = p.id
+        GROUP BY p.bucket, b.snapshot_id, b.ts, UPPER(b.token)`, d.dialect.anyTrue("b.stale_price"), balanceCollection, picks)
+	case GroupByWallet:
+		q = fmt.Sprintf(`
+        SELECT p.bucket, b.snapshot_id, b.ts, b.wallet, UPPER(b.token) AS token,
+            'Grouped' AS address, SUM(b.balance) AS balance, SUM(b.balance_locked) AS balance_locked,
+            SUM(b.fiat_value) AS fiat_value, %v AS stale_price
+        FROM %v b JOIN (%v) p ON b.snapshot_id = p.id
+        GROUP BY p.bucket, b.snapshot_id, b.ts, b.wallet, UPPER(b.token)`, d.dialect.anyTrue("b.stale_price"), balanceCollection, picks)
+	default:
+		q = fmt.Sprintf(`
+        SELECT p.bucket, b.* FROM %v b JOIN (%v) p ON b.snapshot_id = p.id`, balanceCollection, picks)
+	}
+	rows, err := sess.SQL().Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	var result []bucketBalance
+	if err := sess.SQL().NewIterator(rows).All(&result); err != nil {
+		return nil, err
+	}
+	log.Printf("Time series query returned %d rows for %d buckets", len(result), options.Amount)
+	// Split in buckets
+	buckets := make([][]Balance, options.Amount)
+	for _, r := range result {
+		if r.Bucket >= 0 && r.Bucket < options.Amount {
+			buckets[r.Bucket] = append(buckets[r.Bucket], r.Balance)
+		}
+	}
+	if groupBy != options.GroupBy {
+		for i := range buckets {
+			buckets[i] = sumBalances(buckets[i], options.GroupBy)
+		}
+	}
+	return fillBuckets(buckets), nil
+}
+
+// sumBalances groups balances of a single snapshot like the SQL queries of GetTimeSeries
+func sumBalances(balances []Balance, groupBy string) []Balance {
+	groups := make(map[string]Balance)
+	order := make([]string, 0)
+	for _, b := range balances {
+		token := strings.ToUpper(b.Token)
+		key, wallet := token, "Grouped"
+		if groupBy == GroupByWallet {
+			key, wallet = b.Wallet+"/"+token, b.Wallet
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = Balance{Timestamp: b.Timestamp, Wallet: wallet, Token: token, Address: "Grouped", SnapshotId: b.SnapshotId}
+			order = append(order, key)
+		}
+		g.Balance = g.Balance.Add(b.Balance)
+		g.BalanceLocked = g.BalanceLocked.Add(b.BalanceLocked)
+		g.FiatValue = g.FiatValue.Add(b.FiatValue)
+		g.StalePrice = g.StalePrice || b.StalePrice
+		groups[key] = g
+	}
+	r := make([]Balance, 0, len(order))
+	for _, key := range order {
+		r = append(r, groups[key])
+	}
+	return r
+}
+
+// fillBuckets replaces empty buckets with the closest non empty one
+func fillBuckets(buckets [][]Balance) []Balances {
+	r := make([]Balances, len(buckets))
+	for i := range buckets {
+		for delta := 0; delta < len(buckets); delta++ {
+			if i-delta >= 0 && len(buckets[i-delta]) > 0 {
+				r[i] = Balances{entries: buckets[i-delta]}
+				break
+			}
+			if i+delta < len(buckets) && len(buckets[i+delta]) > 0 {
+				r[i] = Balances{entries: buckets[i+delta]}
+				break
+			}
+		}
+	}
+	return r
+}
@@ -0,0 +1,181 @@
+package data
+
+import (
+	"fmt"
+	"github.com/scylladb/go-set"
+	"github.com/shopspring/decimal"
+	"github.com/upper/db/v4"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	transactionCollection = "transactions"
+	cursorCollection      = "transaction_cursors"
+)
+
+// Transaction types
+const (
+	TxDeposit    = "deposit"
+	TxWithdrawal = "withdrawal"
+	TxTrade      = "trade"
+	TxFee        = "fee"
+	TxReward     = "reward"
+	TxTransfer   = "transfer"
+)
+
+// Transaction is a single token movement in a wallet, both sides of a trade are stored with the same RefId.
+// Amount is positive when tokens enter the wallet and Fee is paid in the same token on top of it
+type Transaction struct {
+	Timestamp time.Time       `db:"ts" json:"timestamp"`
+	Wallet    string          `db:"wallet" json:"wallet"`
+	TxId      string          `db:"tx_id" json:"tx_id"`
+	RefId     string          `db:"ref_id" json:"ref_id"`
+	Type      string          `db:"type" json:"type"`
+	Token     string          `db:"token" json:"token"`
+	Address   string          `db:"address" json:"address"`
+	Amount    decimal.Decimal `db:"amount" json:"amount"`
+	Fee       decimal.Decimal `db:"fee" json:"fee"`
+}
+
+// IsExternal is true for movements in or out of the portfolio, as opposed to trades and internal transfers
+func (t Transaction) IsExternal() bool {
+	return t.Type == TxDeposit || t.Type == TxWithdrawal
+}
+
+// TransactionCursors tell providers where each of their sources stopped, values are provider specific
+type TransactionCursors map[string]string
+
+type transactionCursor struct {
+	Wallet  string    `db:"wallet"`
+	Source  string    `db:"source"`
+	Cursor  string    `db:"cursor"`
+	Updated time.Time `db:"updated"`
+}
+
+// TransactionQueryOptions filter transactions, zero values match everything
+type TransactionQueryOptions struct {
+	From    time.Time
+	To      time.Time
+	Wallet  string
+	Wallets []string
+	Token   string
+}
+
+// GetTransactionCursors returns the cursors stored with the last transactions of a wallet
+func (d *Db) GetTransactionCursors(wallet string) (TransactionCursors, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	var cursors []transactionCursor
+	if err := sess.Collection(cursorCollection).Find(db.Cond{"wallet": wallet}).All(&cursors); err != nil {
+		return nil, err
+	}
+	r := make(TransactionCursors)
+	for _, c := range cursors {
+		r[c.Source] = c.Cursor
+	}
+	return r, nil
+}
+
+// InsertTransactions stores new transactions of a wallet and its cursors in a single transaction, transactions
+// already stored with the same TxId are skipped. Returns the number of inserted transactions
+func (d *Db) InsertTransactions(wallet string, transactions []Transaction, cursors TransactionCursors) (int, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return 0, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	inserted := 0
+	err = sess.Tx(func(tx db.Session) error {
+		inserted = 0
+		// Check existing ids in batches
+		ids := make([]interface{}, 0)
+		for _, t := range transactions {
+			ids = append(ids, t.TxId)
+		}
+		existing := set.NewStringSet()
+		for start := 0; start < len(ids); start += compactBatchSize {
+			end := start + compactBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			var rows []Transaction
+			err := tx.Collection(transactionCollection).
+				Find(db.Cond{"wallet": wallet, "tx_id IN": ids[start:end]}).
+				Select("tx_id").
+				All(&rows)
+			if err != nil {
+				return err
+			}
+			for _, r := range rows {
+				existing.Add(r.TxId)
+			}
+		}
+		for _, t := range transactions {
+			if existing.Has(t.TxId) {
+				continue
+			}
+			t.Wallet = wallet
+			if _, err := tx.Collection(transactionCollection).Insert(t); err != nil {
+				return err
+			}
+			existing.Add(t.TxId)
+			inserted++
+		}
+		// Move cursors
+		for source, cursor := range cursors {
+			if err := tx.Collection(cursorCollection).Find(db.Cond{"wallet": wallet, "source": source}).Delete(); err != nil {
+				return err
+			}
+			c := transactionCursor{Wallet: wallet, Source: source, Cursor: cursor, Updated: time.Now()}
+			if _, err := tx.Collection(cursorCollection).Insert(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to store transactions of '%v': %v", wallet, err)
+	}
+	log.Printf("Stored %d new transactions for wallet '%v'", inserted, wallet)
+	return inserted, nil
+}
+
+// GetTransactions returns transactions matching options, oldest first
+func (d *Db) GetTransactions(options TransactionQueryOptions) ([]Transaction, error) {
+	sess, err := d.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer func(sess db.Session) {
+		_ = sess.Close()
+	}(sess)
+	cond := db.Cond{}
+	if !options.From.IsZero() {
+		cond["ts >="] = options.From.Local()
+	}
+	if !options.To.IsZero() {
+		cond["ts <"] = options.To.Local()
+	}
+	if options.Wallet != "" {
+		cond["wallet"] = options.Wallet
+	}
+	if len(options.Wallets) > 0 {
+		cond["wallet IN"] = options.Wallets
+	}
+	conds := []interface{}{cond}
+	if options.Token != "" {
+		conds = append(conds, db.Raw("UPPER(token) = ?", strings.ToUpper(options.Token)))
+	}
+	var r []Transaction
+	err = sess.Collection(transactionCollection).Find(conds...).OrderBy("ts", "tx_id").All(&r)
+	return r, err
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/wcharczuk/go-chart"
+	"github.com/zooper-corp/CoinWatch/analytics"
 	"github.com/zooper-corp/CoinWatch/client"
 	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/tools"
@@ -13,10 +14,12 @@ import (
 	"time"
 )
 
+// BmpGraphStyle sets the chart size, Benchmarks draws what holding BTC, ETH or configured baskets would be worth
 type BmpGraphStyle struct {
 	Width      int
 	Height     int
 	MaxEntries int
+	Benchmarks bool
 }
 
 func GetDefaultBmpGraphStyle() BmpGraphStyle {
@@ -29,22 +32,27 @@ func GetDefaultBmpGraphStyle() BmpGraphStyle {
 
 func TotalBmpGraph(c *client.Client, days int, filterTokens string, cfg BmpGraphStyle) (*bytes.Buffer, error) {
 	maxEntries := mathutil.Max(1, cfg.MaxEntries)
-	bs, err := c.QueryBalance(data.BalanceQueryOptions{Days: days})
+	entries, err := c.GetTimeSeries(data.TimeSeriesOptions{
+		Amount:   days,
+		Interval: time.Hour * 24,
+		GroupBy:  data.GroupByToken,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("Unable to query balances %v\n", err)
 	}
 	// Get tokens
-	unsortedTokens := bs.Tokens()
+	unsortedTokens := data.SeriesTokens(entries)
 	// Override tokens if provided
 	if len(filterTokens) > 0 {
 		unsortedTokens = strings.Split(strings.ToUpper(filterTokens), ",")
-		bs = bs.FilterTokens(unsortedTokens)
+		for i := range entries {
+			entries[i] = entries[i].FilterTokens(unsortedTokens)
+		}
 	}
 	// Sort tokens by total value
-	entries := bs.GetTimeSeries(days, time.Hour*24)
 	lastSampleTotals := make([]float64, len(unsortedTokens))
 	for i, t := range unsortedTokens {
-		lastSampleTotals[i] = entries[0].FilterToken(t).TotalFiatValue()
+		lastSampleTotals[i] = entries[0].FilterToken(t).TotalFiatValue().InexactFloat64()
 	}
 	order := tools.ReverseIntArray(tools.SortAndReturnIndex(lastSampleTotals))
 	tokens := make([]string, len(unsortedTokens))
@@ -70,12 +78,12 @@ func TotalBmpGraph(c *client.Client, days int, filterTokens string, cfg BmpGraph
 		entry := entries[i]
 		if len(entry.Entries()) > 0 {
 			ts := entry.Entries()[0].Timestamp
-			tv := entry.TotalFiatValue()
+			tv := entry.TotalFiatValue().InexactFloat64()
 			// For each token we stack the total value at given time
 			for si := 0; si < len(series); si++ {
 				series[si].XValues = append(series[si].XValues, ts)
 				series[si].YValues = append(series[si].YValues, tv)
-				tv -= math.Max(0, entry.FilterToken(tokens[si]).TotalFiatValue())
+				tv -= math.Max(0, entry.FilterToken(tokens[si]).TotalFiatValue().InexactFloat64())
 			}
 		}
 	}
@@ -110,6 +118,30 @@ func TotalBmpGraph(c *client.Client, days int, filterTokens string, cfg BmpGraph
 		s.Style.FillColor = graph.GetColorPalette().GetSeriesColor(i).WithAlpha(50)
 		gs[i] = s
 	}
+	// Benchmarks only match the total of all tokens
+	if cfg.Benchmarks && len(filterTokens) == 0 {
+		comparison, err := c.GetBenchmarks(days)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to compute benchmarks %v\n", err)
+		}
+		for i, b := range comparison.Benchmarks {
+			bs := chart.TimeSeries{
+				Name: fmt.Sprintf("%s %s", b.Name, tools.HumanSignedPercent(b.Return)),
+				Style: chart.Style{
+					Show:            true,
+					StrokeWidth:     2,
+					StrokeColor:     graph.GetColorPalette().GetSeriesColor(len(series) + i),
+					StrokeDashArray: []float64{5, 5},
+				},
+			}
+			for _, p := range b.Points {
+				bs.XValues = append(bs.XValues, p.Timestamp)
+				bs.YValues = append(bs.YValues, p.Value)
+			}
+			gs = append(gs, bs)
+		}
+		graph.Title = fmt.Sprintf("Total %d days %s vs benchmarks", days, tools.HumanSignedPercent(comparison.Portfolio.Return))
+	}
 	graph.Series = gs
 	// Legend
 	graph.Elements = []chart.Renderable{
@@ -120,3 +152,73 @@ func TotalBmpGraph(c *client.Client, days int, filterTokens string, cfg BmpGraph
 	err = graph.Render(chart.PNG, buffer)
 	return buffer, err
 }
+
+// ProjectionBmpGraph draws the median projected value between the 10th and 90th percentiles, what was invested and
+// the goal
+func ProjectionBmpGraph(p analytics.Projection, cfg BmpGraphStyle) (*bytes.Buffer, error) {
+	if len(p.Bands) < 2 {
+		return nil, fmt.Errorf("Empty projection\n")
+	}
+	line := func(name string, value func(b analytics.Band) float64, style chart.Style) chart.TimeSeries {
+		s := chart.TimeSeries{Name: name, Style: style}
+		for _, b := range p.Bands {
+			s.XValues = append(s.XValues, b.Timestamp)
+			s.YValues = append(s.YValues, value(b))
+		}
+		return s
+	}
+	graph := chart.Chart{
+		Title: fmt.Sprintf("Projection %s from %d runs", DaysToShortName(len(p.Bands)-1), p.Runs),
+		TitleStyle: chart.Style{
+			Show:     true,
+			FontSize: 10,
+		},
+		Background: chart.Style{
+			Padding: chart.Box{
+				Top: 50,
+			},
+		},
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		XAxis: chart.XAxis{
+			Style:          chart.StyleShow(),
+			ValueFormatter: chart.TimeDateValueFormatter,
+		},
+		YAxis: chart.YAxis{
+			Style: chart.StyleShow(),
+			ValueFormatter: func(v interface{}) string {
+				return chart.FloatValueFormatterWithFormat(v, "%.0f")
+			},
+		},
+	}
+	palette := graph.GetColorPalette()
+	graph.Series = []chart.Series{
+		line("High", func(b analytics.Band) float64 { return b.High }, chart.Style{
+			Show: true, StrokeColor: palette.GetSeriesColor(0), FillColor: palette.GetSeriesColor(0).WithAlpha(30),
+		}),
+		line("Low", func(b analytics.Band) float64 { return b.Low }, chart.Style{
+			Show: true, StrokeColor: palette.GetSeriesColor(0), FillColor: chart.ColorWhite,
+		}),
+		line("Median", func(b analytics.Band) float64 { return b.Median }, chart.Style{
+			Show: true, StrokeWidth: 2, StrokeColor: palette.GetSeriesColor(1),
+		}),
+		line("Invested", func(b analytics.Band) float64 { return b.Invested }, chart.Style{
+			Show: true, StrokeColor: palette.GetSeriesColor(2), StrokeDashArray: []float64{5, 5},
+		}),
+	}
+	if g := p.Goal; g != nil {
+		graph.Series = append(graph.Series, line(
+			fmt.Sprintf("Goal %s", tools.HumanPercent(g.Probability)),
+			func(b analytics.Band) float64 { return g.Goal },
+			chart.Style{Show: true, StrokeColor: palette.GetSeriesColor(3), StrokeDashArray: []float64{2, 4}},
+		))
+	}
+	// Legend
+	graph.Elements = []chart.Renderable{
+		chart.Legend(&graph),
+	}
+	// Render
+	buffer := bytes.NewBuffer([]byte{})
+	err := graph.Render(chart.PNG, buffer)
+	return buffer, err
+}
@@ -22,14 +22,17 @@ func GetDefaultAsciiGraphStyle() AsciiGraphStyle {
 }
 
 func TotalAsciiGraph(c *client.Client, days int, cfg AsciiGraphStyle) (string, error) {
-	bs, err := c.QueryBalance(data.BalanceQueryOptions{Days: days})
+	series, err := c.GetTimeSeries(data.TimeSeriesOptions{
+		Amount:   cfg.Width,
+		Interval: time.Hour * 24 * time.Duration(days) / time.Duration(cfg.Width),
+		GroupBy:  data.GroupByToken,
+	})
 	if err != nil {
 		return "", fmt.Errorf("Unable to query balances %v\n", err)
 	}
-	series := bs.GetTimeSeries(cfg.Width, time.Hour*time.Duration(days)/time.Duration(cfg.Width))
 	d := make([]float64, 0)
 	for _, entry := range series {
-		d = append(d, entry.TotalFiatValue())
+		d = append(d, entry.TotalFiatValue().InexactFloat64())
 	}
 	d = tools.NormalizeFloat64Series(d)
 	tools.ReverseFloat64Array(d)
@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/analytics"
 	"github.com/zooper-corp/CoinWatch/client"
 	"github.com/zooper-corp/CoinWatch/data"
 	"github.com/zooper-corp/CoinWatch/tools"
+	"log"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -43,9 +47,14 @@ func SummaryAsciiTable(c *client.Client, days int, cfg AsciiTableStyle) (string,
 		ts = entries[0].Timestamp
 	}
 	fmt.Printf("Updated: %v\n", ts.String())
+	// Deposits and withdrawals are not performance
+	flows, err := c.GetFlows(time.Now().AddDate(0, 0, -days-1))
+	if err != nil {
+		log.Printf("Unable to get flows, total change includes them: %v", err)
+	}
 	// Sort by value
 	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].FiatValue > entries[j].FiatValue
+		return entries[i].FiatValue.GreaterThan(entries[j].FiatValue)
 	})
 	// Create table
 	t := table.NewWriter()
@@ -71,11 +80,11 @@ func SummaryAsciiTable(c *client.Client, days int, cfg AsciiTableStyle) (string,
 			// Address
 			b.ShortAddr(),
 			// Balance
-			tools.HumanFloat64(b.Balance),
+			tools.HumanDecimal(b.Balance),
 			// Price
-			fmt.Sprintf("%s%s", tools.HumanFloat64(b.PricePerToken()), c.GetFiatSymbol()),
+			fmt.Sprintf("%s%s%s", tools.HumanDecimal(b.PricePerToken()), c.GetFiatSymbol(), staleMark(b)),
 			// Total
-			fmt.Sprintf("%d%s", int(b.FiatValue), c.GetFiatSymbol()),
+			fmt.Sprintf("%d%s", b.FiatValue.IntPart(), c.GetFiatSymbol()),
 			// Fiat change 1 D
 			tools.HumanSignedPercent(bs.FiatValueChange(b.Token, 1)),
 			// Fiat change 1 W
@@ -91,16 +100,32 @@ func SummaryAsciiTable(c *client.Client, days int, cfg AsciiTableStyle) (string,
 		// Balance
 		"",
 		// Total
-		fmt.Sprintf("%d%s", int(bs.LastSample().TotalFiatValue()), c.GetFiatSymbol()),
+		fmt.Sprintf("%d%s", bs.LastSample().TotalFiatValue().IntPart(), c.GetFiatSymbol()),
 		// Fiat change 1 D
-		tools.HumanSignedPercent(bs.TotalFiatValueChange(1)),
+		tools.HumanSignedPercent(bs.TotalFiatValueChange(1, flows)),
 		// Fiat change 1 W
-		tools.HumanSignedPercent(bs.TotalFiatValueChange(days)),
+		tools.HumanSignedPercent(bs.TotalFiatValueChange(days, flows)),
 	})
 	// Done
 	return t.Render(), nil
 }
 
+// PerformanceText describes flow adjusted returns over days on one line
+func PerformanceText(c *client.Client, days int) (string, error) {
+	p, err := c.GetPerformance(days)
+	if err != nil {
+		return "", fmt.Errorf("Unable to compute performance %v\n", err)
+	}
+	return fmt.Sprintf(
+		"%s TWR %s MWR %s Flows %d%s Gain %d%s",
+		DaysToShortName(days),
+		tools.HumanSignedPercent(p.TimeWeighted),
+		tools.HumanSignedPercent(p.MoneyWeighted),
+		p.NetFlows.IntPart(), c.GetFiatSymbol(),
+		p.Gain().IntPart(), c.GetFiatSymbol(),
+	), nil
+}
+
 func AllocationAsciiTable(c *client.Client, days int, cfg AsciiTableStyle) (string, error) {
 	bs, err := c.QueryBalance(data.BalanceQueryOptions{Days: days})
 	if err != nil {
@@ -115,33 +140,51 @@ func AllocationAsciiTable(c *client.Client, days int, cfg AsciiTableStyle) (stri
 	fmt.Printf("Updated: %v\n", ts.String())
 	// Sort by value
 	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].FiatValue > entries[j].FiatValue
+		return entries[i].FiatValue.GreaterThan(entries[j].FiatValue)
 	})
 	// Create table
 	t := table.NewWriter()
 	t.SetStyle(getTableStyle(cfg))
 	lh := DaysToShortName(days)
-	t.AppendHeader(table.Row{"T", "Pct", "Bal", "Price", "1D", lh})
+	t.AppendHeader(table.Row{"T", "Pct", "Bal", "Price", "APY", "1D", lh})
 	cc := []table.ColumnConfig{
 		{Name: "T"},
 		{Name: "Allocation"},
 		{Name: "Balance"},
 		{Name: "Price"},
+		{Name: "APY"},
 		{Name: "1D"},
 		{Name: lh},
 	}
 	t.SetColumnConfigs(cc)
+	// Staking yield over the same days
+	ledger, err := c.GetLedger(time.Now().AddDate(0, 0, -days-1))
+	if err != nil {
+		return "", fmt.Errorf("Unable to query transactions %v\n", err)
+	}
+	yields := analytics.StakingYieldsByToken(bs, ledger)
 	// Add rows
+	total := bs.TotalFiatValue()
 	for _, b := range entries {
+		allocation := 0.0
+		if !total.IsZero() {
+			allocation = b.FiatValue.Div(total).InexactFloat64()
+		}
+		apy := ""
+		if y, ok := yields[strings.ToUpper(b.Token)]; ok {
+			apy = tools.HumanPercent(y.Apy)
+		}
 		t.AppendRow(table.Row{
 			// Token
 			strings.ToUpper(b.Token),
 			// Address
-			tools.HumanPercent(1.0 / bs.TotalFiatValue() * b.FiatValue),
+			tools.HumanPercent(allocation),
 			// Balance
-			tools.HumanFloat64(b.Balance),
+			tools.HumanDecimal(b.Balance),
 			// Price
-			fmt.Sprintf("%s%s", tools.HumanFloat64(b.PricePerToken()), c.GetFiatSymbol()),
+			fmt.Sprintf("%s%s", tools.HumanDecimal(b.PricePerToken()), c.GetFiatSymbol()),
+			// Staking yield
+			apy,
 			// Fiat change 1 D
 			tools.HumanSignedPercent(bs.PricePerTokenChange(b.Token, 1)),
 			// Fiat change 1 W
@@ -151,6 +194,315 @@ func AllocationAsciiTable(c *client.Client, days int, cfg AsciiTableStyle) (stri
 	return t.Render(), nil
 }
 
+// GroupAsciiTable shows value and allocation per wallet, tag, chain or provider, groupBy token is the same as the
+// allocation table
+func GroupAsciiTable(c *client.Client, days int, groupBy string, cfg AsciiTableStyle) (string, error) {
+	bs, err := c.QueryBalance(data.BalanceQueryOptions{Days: days})
+	if err != nil {
+		return "", fmt.Errorf("Unable to query balances %v\n", err)
+	}
+	grouped, err := c.GroupBalances(bs, groupBy)
+	if err != nil {
+		return "", err
+	}
+	entries := grouped.LastSample().Entries()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].FiatValue.GreaterThan(entries[j].FiatValue)
+	})
+	t := table.NewWriter()
+	t.SetStyle(getTableStyle(cfg))
+	lh := DaysToShortName(days)
+	header := "Token"
+	if groupBy != data.GroupByNone {
+		header = strings.ToUpper(groupBy[:1]) + strings.ToLower(groupBy[1:])
+	}
+	t.AppendHeader(table.Row{header, c.GetFiat(), "Pct", "1D", lh})
+	total := bs.LastSample().TotalFiatValue()
+	for _, b := range entries {
+		allocation := 0.0
+		if !total.IsZero() {
+			allocation = b.FiatValue.Div(total).InexactFloat64()
+		}
+		t.AppendRow(table.Row{
+			b.Token,
+			fmt.Sprintf("%d%s", b.FiatValue.IntPart(), c.GetFiatSymbol()),
+			tools.HumanPercent(allocation),
+			tools.HumanSignedPercent(grouped.FiatValueChange(b.Token, 1)),
+			tools.HumanSignedPercent(grouped.FiatValueChange(b.Token, days)),
+		})
+	}
+	t.AppendFooter(table.Row{"Total", fmt.Sprintf("%d%s", total.IntPart(), c.GetFiatSymbol()), "", "", ""})
+	if strings.EqualFold(groupBy, data.GroupByTag) {
+		t.SetCaption("Balances with several tags are counted in each")
+	}
+	return t.Render(), nil
+}
+
+func DoctorAsciiTable(c *client.Client, cfg AsciiTableStyle) (string, error) {
+	sources, err := c.CheckPriceSources()
+	if err != nil {
+		return "", err
+	}
+	t := table.NewWriter()
+	t.SetStyle(getTableStyle(cfg))
+	t.AppendHeader(table.Row{"Token", "Source", "Id", "Note"})
+	for _, s := range sources {
+		note := ""
+		switch {
+		case s.Ambiguous():
+			note = fmt.Sprintf("ambiguous %v, set geckoid in tokens", strings.Join(s.Candidates, ","))
+		case s.Id == "" && s.Source != "rule":
+			note = "no CoinGecko price, needs Kraken pair or pricing rule"
+		}
+		t.AppendRow(table.Row{s.Symbol, s.Source, s.Id, note})
+	}
+	return t.Render(), nil
+}
+
+func TransactionsAsciiTable(c *client.Client, options data.TransactionQueryOptions, cfg AsciiTableStyle) (string, error) {
+	transactions, err := c.GetTransactions(options)
+	if err != nil {
+		return "", err
+	}
+	t := table.NewWriter()
+	t.SetStyle(getTableStyle(cfg))
+	t.AppendHeader(table.Row{"Date", "Wallet", "Type", "Token", "Amount", "Fee", "Address"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "Wallet", Hidden: cfg.Style == Default},
+		{Name: "Amount", Align: text.AlignRight},
+		{Name: "Fee", Align: text.AlignRight, Hidden: cfg.Style == Default},
+		{Name: "Address", Hidden: cfg.Style == Default},
+	})
+	for _, tx := range transactions {
+		t.AppendRow(table.Row{
+			tx.Timestamp.Format("2006-01-02 15:04"),
+			tx.Wallet,
+			tx.Type,
+			strings.ToUpper(tx.Token),
+			tx.Amount.String(),
+			tx.Fee.String(),
+			tx.Address,
+		})
+	}
+	return t.Render(), nil
+}
+
+func CostBasisAsciiTable(c *client.Client, method string, cfg AsciiTableStyle) (string, error) {
+	report, err := c.GetCostBasis(method)
+	if err != nil {
+		return "", err
+	}
+	fiat := c.GetFiatSymbol()
+	money := func(v decimal.Decimal) string {
+		return fmt.Sprintf("%d%s", v.IntPart(), fiat)
+	}
+	t := table.NewWriter()
+	t.SetStyle(getTableStyle(cfg))
+	t.AppendHeader(table.Row{"Token", "Balance", "Avg", "Cost", "Value", "Unrealized", "Realized"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "Balance", Hidden: cfg.Style == Default},
+		{Name: "Avg", Hidden: cfg.Style == Default},
+		{Name: "Value", Hidden: cfg.Style == Default},
+	})
+	for _, p := range report.Positions {
+		t.AppendRow(table.Row{
+			p.Token,
+			tools.HumanDecimal(p.Quantity),
+			fmt.Sprintf("%s%s", tools.HumanDecimal(p.AverageCost()), fiat),
+			money(p.Cost),
+			money(p.Value),
+			money(p.Unrealized()),
+			money(p.Realized),
+		})
+	}
+	total := report.Total()
+	t.AppendFooter(table.Row{
+		"Total", "", "", money(total.Cost), money(total.Value), money(total.Unrealized()), money(total.Realized),
+	})
+	if report.Missing > 0 {
+		t.SetCaption("%d transactions without a price are valued at zero", report.Missing)
+	}
+	return t.Render(), nil
+}
+
+// StatsAsciiTable shows risk figures of the last days and how the portfolio follows BTC and ETH
+func StatsAsciiTable(c *client.Client, days int, window int, riskFree float64, cfg AsciiTableStyle) (string, error) {
+	s, err := c.GetStats(days, window, riskFree)
+	if err != nil {
+		return "", fmt.Errorf("Unable to compute stats %v\n", err)
+	}
+	ratio := func(v float64) string {
+		// Sortino without any losing period
+		if math.IsInf(v, 1) {
+			return "∞"
+		}
+		return fmt.Sprintf("%.2f", v)
+	}
+	t := table.NewWriter()
+	t.SetStyle(getTableStyle(cfg))
+	t.AppendHeader(table.Row{"Stat", "Value"})
+	t.AppendRow(table.Row{"Return", tools.HumanSignedPercent(s.Return)})
+	t.AppendRow(table.Row{"Max drawdown", tools.HumanSignedPercent(s.MaxDrawdown)})
+	if s.MaxDrawdown < 0 {
+		t.AppendRow(table.Row{"Drawdown dates", fmt.Sprintf("%s - %s", s.DrawdownPeak.Format("2006-01-02"), s.DrawdownTrough.Format("2006-01-02"))})
+	}
+	t.AppendRow(table.Row{"Volatility", tools.HumanPercent(s.Volatility)})
+	if l := len(s.RollingVolatility); l > 0 {
+		t.AppendRow(table.Row{fmt.Sprintf("Volatility %dD", window), tools.HumanPercent(s.RollingVolatility[l-1].Value)})
+	}
+	t.AppendRow(table.Row{"Sharpe", ratio(s.Sharpe)})
+	t.AppendRow(table.Row{"Sortino", ratio(s.Sortino)})
+	for _, b := range s.Benchmarks {
+		t.AppendRow(table.Row{fmt.Sprintf("%s return", b.Token), tools.HumanSignedPercent(b.Return)})
+		t.AppendRow(table.Row{fmt.Sprintf("%s beta", b.Token), ratio(b.Beta)})
+		t.AppendRow(table.Row{fmt.Sprintf("%s correlation", b.Token), ratio(b.Correlation)})
+	}
+	t.SetCaption("%d returns since %s, annualized from their mean period", s.Periods, s.From.Format("2006-01-02"))
+	return t.Render(), nil
+}
+
+// BenchmarkAsciiTable compares the portfolio with holding BTC, ETH or configured baskets over the last days
+func BenchmarkAsciiTable(c *client.Client, days int, cfg AsciiTableStyle) (string, error) {
+	comparison, err := c.GetBenchmarks(days)
+	if err != nil {
+		return "", fmt.Errorf("Unable to compute benchmarks %v\n", err)
+	}
+	last := func(s analytics.Series) string {
+		if len(s.Points) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%.0f%s", s.Points[len(s.Points)-1].Value, c.GetFiatSymbol())
+	}
+	t := table.NewWriter()
+	t.SetStyle(getTableStyle(cfg))
+	t.AppendHeader(table.Row{"Name", "Value", "Return", "Excess"})
+	p := comparison.Portfolio
+	t.AppendRow(table.Row{p.Name, last(p), tools.HumanSignedPercent(p.Return), ""})
+	for _, b := range comparison.Benchmarks {
+		t.AppendRow(table.Row{b.Name, last(b), tools.HumanSignedPercent(b.Return), tools.HumanSignedPercent(p.Return - b.Return)})
+	}
+	if len(comparison.Missing) > 0 {
+		t.SetCaption("No stored price for %s", strings.Join(comparison.Missing, ", "))
+	}
+	return t.Render(), nil
+}
+
+// RebalanceAsciiTable shows how far each target drifted and what to trade to get back to it
+func RebalanceAsciiTable(c *client.Client, cfg AsciiTableStyle) (string, error) {
+	r, err := c.GetRebalance()
+	if err != nil {
+		return "", err
+	}
+	t := table.NewWriter()
+	t.SetStyle(getTableStyle(cfg))
+	t.AppendHeader(table.Row{"Target", "Tokens", "Value", "Now", "Goal", "Drift", "Trade"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "Tokens", Hidden: cfg.Style == Default},
+		{Name: "Value", Hidden: cfg.Style == Default},
+	})
+	for _, d := range r.Drifts {
+		trade := ""
+		if d.OutOfBand() {
+			action := "Buy"
+			if d.Trade.IsNegative() {
+				action = "Sell"
+			}
+			trade = fmt.Sprintf("%s %d%s", action, d.Trade.Abs().IntPart(), c.GetFiatSymbol())
+		}
+		t.AppendRow(table.Row{
+			d.Name,
+			strings.Join(d.Tokens, ","),
+			fmt.Sprintf("%d%s", d.Value.IntPart(), c.GetFiatSymbol()),
+			tools.HumanPercent(d.Current),
+			tools.HumanPercent(d.Target),
+			tools.HumanSignedPercent(d.Drift),
+			trade,
+		})
+	}
+	t.SetCaption("Trades once drift exceeds %s", tools.HumanPercent(r.Band))
+	return t.Render(), nil
+}
+
+// ProjectionAsciiTable shows projected value bands at five dates of the horizon and when the goal is reached
+func ProjectionAsciiTable(c *client.Client, p analytics.Projection, cfg AsciiTableStyle) (string, error) {
+	if len(p.Bands) < 2 {
+		return "", fmt.Errorf("Empty projection\n")
+	}
+	money := func(v float64) string {
+		return fmt.Sprintf("%.0f%s", v, c.GetFiatSymbol())
+	}
+	t := table.NewWriter()
+	t.SetStyle(getTableStyle(cfg))
+	t.AppendHeader(table.Row{"Date", "Invested", "Low", "Median", "High"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "Invested", Hidden: cfg.Style == Default},
+	})
+	days := len(p.Bands) - 1
+	step := days / 5
+	if step < 1 {
+		step = 1
+	}
+	for day := step; day <= days; day += step {
+		// Always end on the horizon
+		if days-day < step {
+			day = days
+		}
+		b := p.Bands[day]
+		t.AppendRow(table.Row{b.Timestamp.Format("2006-01-02"), money(b.Invested), money(b.Low), money(b.Median), money(b.High)})
+	}
+	caption := fmt.Sprintf("%d runs from %d daily returns, 10th to 90th percentile", p.Runs, p.Returns)
+	if g := p.Goal; g != nil {
+		caption += fmt.Sprintf("\nGoal %s reached by %s of runs", money(g.Goal), tools.HumanPercent(g.Probability))
+		if g.Median >= 0 {
+			caption += fmt.Sprintf(", median %s", DaysToShortName(g.Median))
+		}
+	}
+	t.SetCaption(caption)
+	return t.Render(), nil
+}
+
+// EventsAsciiTable lists balance anomalies, changes are token quantities and values use the price before the change
+func EventsAsciiTable(c *client.Client, events []data.Event, cfg AsciiTableStyle) (string, error) {
+	t := table.NewWriter()
+	t.SetStyle(getTableStyle(cfg))
+	t.AppendHeader(table.Row{"Date", "Kind", "Wallet", "Token", "Previous", "Current", "Change", "Value", "Address"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Name: "Wallet", Hidden: cfg.Style == Default},
+		{Name: "Previous", Align: text.AlignRight, Hidden: cfg.Style == Default},
+		{Name: "Current", Align: text.AlignRight, Hidden: cfg.Style == Default},
+		{Name: "Change", Align: text.AlignRight},
+		{Name: "Value", Align: text.AlignRight},
+		{Name: "Address", Hidden: cfg.Style == Default},
+	})
+	for _, e := range events {
+		change := "new"
+		if e.Kind != data.EventNewToken {
+			// Drops and missing balances only go down
+			change = "-" + tools.HumanPercent(e.Change())
+		}
+		t.AppendRow(table.Row{
+			e.Timestamp.Format("2006-01-02 15:04"),
+			strings.ReplaceAll(e.Kind, "_", " "),
+			e.Wallet,
+			e.Token,
+			tools.HumanDecimal(e.Previous),
+			tools.HumanDecimal(e.Current),
+			change,
+			fmt.Sprintf("%d%s", e.FiatValue.IntPart(), c.GetFiatSymbol()),
+			e.Address,
+		})
+	}
+	return t.Render(), nil
+}
+
+// staleMark flags balances valued with a stored price instead of a live one, or unpriced
+func staleMark(b data.Balance) string {
+	if b.StalePrice {
+		return "*"
+	}
+	return ""
+}
+
 func getTableStyle(cfg AsciiTableStyle) table.Style {
 	style := table.StyleLight
 	if !cfg.Borders {
@@ -0,0 +1,168 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var csvColumns = map[string][]string{
+	snapshotsKind: {"timestamp", "status", "wallets", "fiat", "portfolio"},
+	balancesKind:  {"timestamp", "wallet", "token", "address", "balance", "balance_locked", "fiat_value", "stale_price", "portfolio"},
+	pricesKind:    {"timestamp", "token", "fiat", "price"},
+}
+
+type csvCodec struct{}
+
+func (c csvCodec) write(path string, kind string, dump data.Dump) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	w := csv.NewWriter(f)
+	if err := w.Write(csvColumns[kind]); err != nil {
+		return err
+	}
+	switch kind {
+	case snapshotsKind:
+		for _, s := range dump.Snapshots {
+			err = w.Write([]string{formatTime(s.Timestamp), s.Status, strconv.Itoa(s.Wallets), s.Fiat, s.Portfolio})
+			if err != nil {
+				return err
+			}
+		}
+	case balancesKind:
+		for _, b := range dump.Balances {
+			err = w.Write([]string{
+				formatTime(b.Timestamp), b.Wallet, b.Token, b.Address, b.Balance.String(),
+				b.BalanceLocked.String(), b.FiatValue.String(), strconv.FormatBool(b.StalePrice), b.Portfolio,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	case pricesKind:
+		for _, p := range dump.Prices {
+			if err = w.Write([]string{formatTime(p.Timestamp), p.Token, p.Fiat, p.Price.String()}); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// read matches columns by header name so spreadsheets only need timestamp, token and balance
+func (c csvCodec) read(path string, kind string, dump *data.Dump) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	header := make(map[string]int)
+	for i, h := range rows[0] {
+		header[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for i, row := range rows[1:] {
+		r := csvRow{header: header, row: row}
+		if err := r.decode(kind, dump); err != nil {
+			return fmt.Errorf("line %d: %v", i+2, err)
+		}
+	}
+	return nil
+}
+
+type csvRow struct {
+	header map[string]int
+	row    []string
+	err    error
+}
+
+func (r *csvRow) decode(kind string, dump *data.Dump) error {
+	switch kind {
+	case snapshotsKind:
+		wallets, _ := strconv.Atoi(r.get("wallets", "0"))
+		dump.Snapshots = append(dump.Snapshots, data.Snapshot{
+			Timestamp: r.timestamp("timestamp"),
+			Status:    r.get("status", data.SnapshotComplete),
+			Wallets:   wallets,
+			Fiat:      r.get("fiat", ""),
+			Portfolio: r.get("portfolio", data.DefaultPortfolio),
+		})
+	case balancesKind:
+		stale, _ := strconv.ParseBool(r.get("stale_price", "false"))
+		dump.Balances = append(dump.Balances, data.Balance{
+			Timestamp:     r.timestamp("timestamp"),
+			Wallet:        r.get("wallet", "Imported"),
+			Token:         r.required("token"),
+			Address:       r.get("address", ""),
+			Balance:       r.amount("balance", ""),
+			BalanceLocked: r.amount("balance_locked", "0"),
+			FiatValue:     r.amount("fiat_value", "0"),
+			StalePrice:    stale,
+			Portfolio:     r.get("portfolio", data.DefaultPortfolio),
+		})
+	case pricesKind:
+		dump.Prices = append(dump.Prices, data.TokenPrice{
+			Timestamp: r.timestamp("timestamp"),
+			Token:     r.required("token"),
+			Fiat:      r.required("fiat"),
+			Price:     r.amount("price", ""),
+		})
+	}
+	return r.err
+}
+
+// get returns the named column or fallback when missing or empty
+func (r *csvRow) get(name string, fallback string) string {
+	i, ok := r.header[name]
+	if !ok || i >= len(r.row) || strings.TrimSpace(r.row[i]) == "" {
+		return fallback
+	}
+	return strings.TrimSpace(r.row[i])
+}
+
+func (r *csvRow) required(name string) string {
+	v := r.get(name, "")
+	if v == "" && r.err == nil {
+		r.err = fmt.Errorf("missing %v", name)
+	}
+	return v
+}
+
+func (r *csvRow) timestamp(name string) time.Time {
+	t, err := parseTime(r.required(name))
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return t
+}
+
+func (r *csvRow) amount(name string, fallback string) decimal.Decimal {
+	v := r.get(name, fallback)
+	if v == "" {
+		v = r.required(name)
+	}
+	d, err := decimal.NewFromString(v)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid %v '%v'", name, v)
+	}
+	return d
+}
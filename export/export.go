@@ -0,0 +1,154 @@
+package export
+
+import (
+	"fmt"
+	"github.com/zooper-corp/CoinWatch/data"
+	"github.com/zooper-corp/CoinWatch/tools"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Supported formats
+const (
+	FormatCsv     = "csv"
+	FormatJsonl   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// Dump files, one per kind of row
+const (
+	snapshotsKind = "snapshots"
+	balancesKind  = "balances"
+	pricesKind    = "prices"
+)
+
+var kinds = []string{snapshotsKind, balancesKind, pricesKind}
+
+// codec reads and writes one kind of rows in a given format
+type codec interface {
+	write(path string, kind string, dump data.Dump) error
+	read(path string, kind string, dump *data.Dump) error
+}
+
+var codecs = map[string]codec{
+	FormatCsv:     csvCodec{},
+	FormatJsonl:   jsonlCodec{},
+	FormatParquet: parquetCodec{},
+}
+
+// FormatFromPath returns the format matching a file extension
+func FormatFromPath(path string) (string, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	switch ext {
+	case "json", "ndjson":
+		return FormatJsonl, nil
+	case "pq":
+		return FormatParquet, nil
+	}
+	if _, ok := codecs[ext]; ok {
+		return ext, nil
+	}
+	return "", fmt.Errorf("unable to guess format of '%v', use one of csv, jsonl or parquet", path)
+}
+
+// Write stores a dump in dir as snapshots, balances and prices files, returns the written paths
+func Write(dump data.Dump, dir string, format string) ([]string, error) {
+	c, ok := codecs[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format '%v'", format)
+	}
+	dir = tools.ExpandPath(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	r := make([]string, 0)
+	for _, kind := range kinds {
+		path := filepath.Join(dir, fmt.Sprintf("%s.%s", kind, format))
+		if err := c.write(path, kind, dump); err != nil {
+			return r, fmt.Errorf("unable to write %v: %v", path, err)
+		}
+		log.Printf("Exported %v", path)
+		r = append(r, path)
+	}
+	return r, nil
+}
+
+// Read loads a dump from a directory written by Write or from a single file, files are told apart by
+// name and any other file is read as balances. Format is guessed from extensions when empty
+func Read(path string, format string) (data.Dump, error) {
+	path = tools.ExpandPath(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return data.Dump{}, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return data.Dump{}, err
+		}
+		files = make([]string, 0)
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+	var dump data.Dump
+	for _, f := range files {
+		fileFormat := format
+		if fileFormat == "" {
+			if fileFormat, err = FormatFromPath(f); err != nil {
+				// Skip unrelated files in directories
+				if info.IsDir() {
+					continue
+				}
+				return data.Dump{}, err
+			}
+		} else if info.IsDir() && !strings.HasSuffix(strings.ToLower(f), "."+format) {
+			continue
+		}
+		c, ok := codecs[fileFormat]
+		if !ok {
+			return data.Dump{}, fmt.Errorf("unknown format '%v'", fileFormat)
+		}
+		kind := balancesKind
+		name := strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+		if tools.StringInSlice(strings.ToLower(name), kinds) {
+			kind = strings.ToLower(name)
+		}
+		log.Printf("Reading %v from %v", kind, f)
+		if err := c.read(f, kind, &dump); err != nil {
+			return data.Dump{}, fmt.Errorf("unable to read %v: %v", f, err)
+		}
+	}
+	return dump, nil
+}
+
+// timeLayouts are accepted when reading timestamps, spreadsheets rarely write RFC 3339
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp '%v'", value)
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,74 @@
+package export
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/zooper-corp/CoinWatch/data"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testDump() data.Dump {
+	ts := time.Date(2022, 3, 1, 12, 30, 0, 0, time.Local)
+	balance, _ := decimal.NewFromString("0.123456789012345678")
+	return data.Dump{
+		Snapshots: []data.Snapshot{{Id: 1, Timestamp: ts, Status: data.SnapshotComplete, Wallets: 1, Fiat: "EUR"}},
+		Balances: []data.Balance{{
+			SnapshotId: 1, Timestamp: ts, Wallet: "w", Token: "eth", Address: "a", Balance: balance,
+			BalanceLocked: decimal.NewFromInt(1), FiatValue: decimal.RequireFromString("1234.5"), StalePrice: true,
+		}},
+		Prices: []data.TokenPrice{{Timestamp: ts, Token: "ETH", Fiat: "EUR", Price: decimal.RequireFromString("2500.01")}},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	in := testDump()
+	for _, format := range []string{FormatCsv, FormatJsonl, FormatParquet} {
+		dir := t.TempDir()
+		files, err := Write(in, dir, format)
+		if err != nil || len(files) != 3 {
+			t.Fatalf("%v: unable to write %v %v", format, files, err)
+		}
+		out, err := Read(dir, "")
+		if err != nil {
+			t.Fatalf("%v: unable to read %v", format, err)
+		}
+		if len(out.Snapshots) != 1 || len(out.Balances) != 1 || len(out.Prices) != 1 {
+			t.Fatalf("%v: unexpected dump %v", format, out)
+		}
+		s, b, p := out.Snapshots[0], out.Balances[0], out.Prices[0]
+		if !s.Timestamp.Equal(in.Snapshots[0].Timestamp) || s.Wallets != 1 || s.Fiat != "EUR" {
+			t.Errorf("%v: unexpected snapshot %v", format, s)
+		}
+		if b.Id() != in.Balances[0].Id() || !b.Balance.Equal(in.Balances[0].Balance) ||
+			!b.FiatValue.Equal(in.Balances[0].FiatValue) || !b.StalePrice || !b.Timestamp.Equal(in.Balances[0].Timestamp) {
+			t.Errorf("%v: unexpected balance %v", format, b)
+		}
+		if !p.Price.Equal(in.Prices[0].Price) || p.Token != "ETH" {
+			t.Errorf("%v: unexpected price %v", format, p)
+		}
+	}
+}
+
+func TestRead_Spreadsheet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.csv")
+	content := "Token,Balance,Timestamp\nBTC,0.5,2021-06-01\nETH,2,2021-06-01 10:00\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dump, err := Read(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Balances) != 2 || dump.Balances[0].Wallet != "Imported" || !dump.Balances[1].Balance.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("Unexpected balances %v", dump.Balances)
+	}
+	// Missing required column
+	if err := os.WriteFile(path, []byte("Balance\n1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path, ""); err == nil {
+		t.Error("Expected an error for rows without timestamp")
+	}
+}
@@ -0,0 +1,125 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/zooper-corp/CoinWatch/data"
+	"os"
+	"strings"
+)
+
+// jsonlCodec writes one JSON object per line using the model JSON fields, amounts are strings to stay exact
+type jsonlCodec struct{}
+
+func (c jsonlCodec) write(path string, kind string, dump data.Dump) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	switch kind {
+	case snapshotsKind:
+		for _, s := range dump.Snapshots {
+			s.Id = 0
+			if err := enc.Encode(jsonlSnapshot{s}); err != nil {
+				return err
+			}
+		}
+	case balancesKind:
+		for _, b := range dump.Balances {
+			if err := enc.Encode(jsonlBalance{b}); err != nil {
+				return err
+			}
+		}
+	case pricesKind:
+		for _, p := range dump.Prices {
+			if err := enc.Encode(p); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+func (c jsonlCodec) read(path string, kind string, dump *data.Dump) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var err error
+		switch kind {
+		case snapshotsKind:
+			var s data.Snapshot
+			if err = json.Unmarshal([]byte(text), &s); err == nil {
+				s.Id = 0
+				dump.Snapshots = append(dump.Snapshots, s)
+			}
+		case balancesKind:
+			var b data.Balance
+			if err = json.Unmarshal([]byte(text), &b); err == nil {
+				b.SnapshotId = 0
+				dump.Balances = append(dump.Balances, b)
+			}
+		case pricesKind:
+			var p data.TokenPrice
+			if err = json.Unmarshal([]byte(text), &p); err == nil {
+				dump.Prices = append(dump.Prices, p)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// jsonlSnapshot drops the DB id, it means nothing in another DB
+type jsonlSnapshot struct {
+	data.Snapshot
+}
+
+func (s jsonlSnapshot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"timestamp": s.Timestamp,
+		"status":    s.Status,
+		"wallets":   s.Wallets,
+		"fiat":      s.Fiat,
+		"portfolio": s.Portfolio,
+	})
+}
+
+// jsonlBalance drops the snapshot id, balances are linked to snapshots by portfolio and timestamp
+type jsonlBalance struct {
+	data.Balance
+}
+
+func (b jsonlBalance) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"timestamp":      b.Timestamp,
+		"wallet":         b.Wallet,
+		"token":          b.Token,
+		"address":        b.Address,
+		"balance":        b.Balance.Balance,
+		"balance_locked": b.BalanceLocked,
+		"fiat_value":     b.FiatValue,
+		"stale_price":    b.StalePrice,
+		"portfolio":      b.Portfolio,
+	})
+}
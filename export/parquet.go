@@ -0,0 +1,217 @@
+package export
+
+import (
+	"github.com/shopspring/decimal"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	"github.com/zooper-corp/CoinWatch/data"
+	"os"
+	"reflect"
+	"time"
+)
+
+// Parquet rows, amounts are strings to stay exact and timestamps are UTC microseconds
+type parquetSnapshot struct {
+	Timestamp int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Status    string `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Wallets   int32  `parquet:"name=wallets, type=INT32"`
+	Fiat      string `parquet:"name=fiat, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Portfolio string `parquet:"name=portfolio, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type parquetBalance struct {
+	Timestamp     int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Wallet        string `parquet:"name=wallet, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Token         string `parquet:"name=token, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Address       string `parquet:"name=address, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Balance       string `parquet:"name=balance, type=BYTE_ARRAY, convertedtype=UTF8"`
+	BalanceLocked string `parquet:"name=balance_locked, type=BYTE_ARRAY, convertedtype=UTF8"`
+	FiatValue     string `parquet:"name=fiat_value, type=BYTE_ARRAY, convertedtype=UTF8"`
+	StalePrice    bool   `parquet:"name=stale_price, type=BOOLEAN"`
+	Portfolio     string `parquet:"name=portfolio, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type parquetPrice struct {
+	Timestamp int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Token     string `parquet:"name=token, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Fiat      string `parquet:"name=fiat, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Price     string `parquet:"name=price, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type parquetCodec struct{}
+
+func (c parquetCodec) write(path string, kind string, dump data.Dump) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var pw *writer.ParquetWriter
+	switch kind {
+	case snapshotsKind:
+		if pw, err = writer.NewParquetWriterFromWriter(f, new(parquetSnapshot), 1); err != nil {
+			return err
+		}
+		for _, s := range dump.Snapshots {
+			err := pw.Write(parquetSnapshot{
+				Timestamp: s.Timestamp.UnixMicro(),
+				Status:    s.Status,
+				Wallets:   int32(s.Wallets),
+				Fiat:      s.Fiat,
+				Portfolio: s.Portfolio,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	case balancesKind:
+		if pw, err = writer.NewParquetWriterFromWriter(f, new(parquetBalance), 1); err != nil {
+			return err
+		}
+		for _, b := range dump.Balances {
+			err := pw.Write(parquetBalance{
+				Timestamp:     b.Timestamp.UnixMicro(),
+				Wallet:        b.Wallet,
+				Token:         b.Token,
+				Address:       b.Address,
+				Balance:       b.Balance.String(),
+				BalanceLocked: b.BalanceLocked.String(),
+				FiatValue:     b.FiatValue.String(),
+				StalePrice:    b.StalePrice,
+				Portfolio:     b.Portfolio,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	case pricesKind:
+		if pw, err = writer.NewParquetWriterFromWriter(f, new(parquetPrice), 1); err != nil {
+			return err
+		}
+		for _, p := range dump.Prices {
+			err := pw.Write(parquetPrice{
+				Timestamp: p.Timestamp.UnixMicro(),
+				Token:     p.Token,
+				Fiat:      p.Fiat,
+				Price:     p.Price.String(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return pw.WriteStop()
+}
+
+func (c parquetCodec) read(path string, kind string, dump *data.Dump) error {
+	pf, err := openParquetFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = pf.Close()
+	}()
+	switch kind {
+	case snapshotsKind:
+		var rows []parquetSnapshot
+		if err := readParquet(pf, new(parquetSnapshot), &rows); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			dump.Snapshots = append(dump.Snapshots, data.Snapshot{
+				Timestamp: time.UnixMicro(r.Timestamp),
+				Status:    r.Status,
+				Wallets:   int(r.Wallets),
+				Fiat:      r.Fiat,
+				Portfolio: r.Portfolio,
+			})
+		}
+	case balancesKind:
+		var rows []parquetBalance
+		if err := readParquet(pf, new(parquetBalance), &rows); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			b := data.Balance{
+				Timestamp:  time.UnixMicro(r.Timestamp),
+				Wallet:     r.Wallet,
+				Token:      r.Token,
+				Address:    r.Address,
+				StalePrice: r.StalePrice,
+				Portfolio:  r.Portfolio,
+			}
+			if b.Balance, err = decimal.NewFromString(r.Balance); err != nil {
+				return err
+			}
+			if b.BalanceLocked, err = decimal.NewFromString(r.BalanceLocked); err != nil {
+				return err
+			}
+			if b.FiatValue, err = decimal.NewFromString(r.FiatValue); err != nil {
+				return err
+			}
+			dump.Balances = append(dump.Balances, b)
+		}
+	case pricesKind:
+		var rows []parquetPrice
+		if err := readParquet(pf, new(parquetPrice), &rows); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			price, err := decimal.NewFromString(r.Price)
+			if err != nil {
+				return err
+			}
+			dump.Prices = append(dump.Prices, data.TokenPrice{
+				Timestamp: time.UnixMicro(r.Timestamp),
+				Token:     r.Token,
+				Fiat:      r.Fiat,
+				Price:     price,
+			})
+		}
+	}
+	return nil
+}
+
+func readParquet(pf source.ParquetFile, schema interface{}, rows interface{}) error {
+	pr, err := reader.NewParquetReader(pf, schema, 1)
+	if err != nil {
+		return err
+	}
+	defer pr.ReadStop()
+	// Reader fills as many rows as the slice holds
+	v := reflect.ValueOf(rows).Elem()
+	v.Set(reflect.MakeSlice(v.Type(), int(pr.GetNumRows()), int(pr.GetNumRows())))
+	return pr.Read(rows)
+}
+
+// parquetFile is a local source.ParquetFile, the reader opens the file again for every column
+type parquetFile struct {
+	*os.File
+	path string
+}
+
+func openParquetFile(path string) (source.ParquetFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return parquetFile{f, path}, nil
+}
+
+func (f parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name == "" {
+		name = f.path
+	}
+	return openParquetFile(name)
+}
+
+func (f parquetFile) Create(name string) (source.ParquetFile, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return parquetFile{file, name}, nil
+}
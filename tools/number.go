@@ -75,6 +75,11 @@ func HumanFloat64(v float64) string {
 	}
 }
 
+// HumanDecimal formats a decimal like HumanFloat64, precision is only lost for display
+func HumanDecimal(v decimal.Decimal) string {
+	return HumanFloat64(v.InexactFloat64())
+}
+
 func NormalizeFloat64Series(series []float64) []float64 {
 	r := make([]float64, len(series))
 	if len(series) == 0 {
@@ -111,9 +116,6 @@ func ToDecimal(ivalue interface{}, decimals int) decimal.Decimal {
 		value = v
 	}
 
-	mul := decimal.NewFromFloat(float64(10)).Pow(decimal.NewFromFloat(float64(decimals)))
-	num, _ := decimal.NewFromString(value.String())
-	result := num.Div(mul)
-
-	return result
+	// Shift is exact, dividing would round to DivisionPrecision digits
+	return decimal.NewFromBigInt(value, int32(-decimals))
 }